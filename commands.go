@@ -0,0 +1,230 @@
+//go:build !js
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"example.com/lambda"
+)
+
+// commands are the subcommands run instead of the server when named
+// by the first argument. Each returns the exit status.
+var commands = map[string]func(args []string) int{
+	"fmt":        fmtCommand,
+	"run":        runCommand,
+	"watch":      watchCommand,
+	"kernelspec": kernelspecCommand,
+	"stubs":      stubsCommand,
+}
+
+// fmtCommand formats .lam files, or standard input when none are
+// given, like gofmt.
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of standard output")
+	list := flags.Bool("l", false, "list the files whose formatting differs instead of printing them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: lambda fmt [-l] [-w] [file.lam ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read standard input:", err)
+			return 1
+		}
+		formatted, err := lambda.Format(string(src))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "<stdin>:", err)
+			return 1
+		}
+		os.Stdout.WriteString(formatted)
+		return 0
+	}
+
+	status := 0
+	for _, name := range flags.Args() {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		formatted, err := lambda.Format(string(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = 1
+			continue
+		}
+		changed := !bytes.Equal(src, []byte(formatted))
+		if *list && changed {
+			fmt.Println(name)
+		}
+		if *write && changed {
+			if err := os.WriteFile(name, []byte(formatted), 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 1
+			}
+		}
+		if !*list && !*write {
+			os.Stdout.WriteString(formatted)
+		}
+	}
+	return status
+}
+
+// runCommand evaluates .lam files top to bottom, printing the normal
+// form of each term. It fails if any term does not parse or reach a
+// normal form within the limits.
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	timeout := flags.Duration("timeout", 10*time.Second, "upper bound for evaluating a single term")
+	maxSteps := flags.Int("max-steps", 1000000, "upper bound for the reduction steps of a single term, or 0 for none")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: lambda run [-timeout d] [-max-steps n] file.lam ...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, name := range flags.Args() {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		for _, result := range lambda.EvaluateFile(context.Background(), string(src), *timeout, *maxSteps) {
+			if result.Err != nil {
+				fmt.Fprintf(os.Stderr, "%s:%d: %v\n", name, result.Line, result.Err)
+				status = 1
+				continue
+			}
+			fmt.Println(result.Result)
+		}
+	}
+	return status
+}
+
+// watchCommand evaluates a .lam file like run, then again whenever it
+// changes, printing how the results differ from the previous run.
+func watchCommand(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	timeout := flags.Duration("timeout", 10*time.Second, "upper bound for evaluating a single term")
+	maxSteps := flags.Int("max-steps", 1000000, "upper bound for the reduction steps of a single term, or 0 for none")
+	interval := flags.Duration("interval", 500*time.Millisecond, "how often to check the file for changes")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: lambda watch [-timeout d] [-max-steps n] [-interval d] file.lam")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || *interval <= 0 {
+		flags.Usage()
+		return 2
+	}
+	name := flags.Arg(0)
+
+	var (
+		previous      map[string]string
+		previousOrder []string
+		modified      time.Time
+		size          int64 = -1
+	)
+	for ; ; time.Sleep(*interval) {
+		info, err := os.Stat(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if info.ModTime().Equal(modified) && info.Size() == size {
+			continue
+		}
+		modified, size = info.ModTime(), info.Size()
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		current := map[string]string{}
+		var order []string
+		for _, result := range lambda.EvaluateFile(context.Background(), string(src), *timeout, *maxSteps) {
+			// Terms are told apart by their source, so results follow
+			// them when lines move.
+			key := result.Source
+			for n := 2; hasKey(current, key); n++ {
+				key = fmt.Sprintf("%s (#%d)", result.Source, n)
+			}
+			current[key] = result.Result
+			if result.Err != nil {
+				current[key] = "error: " + result.Err.Error()
+			}
+			order = append(order, key)
+		}
+
+		fmt.Printf("== %s at %s\n", name, modified.Format("15:04:05"))
+		for _, key := range order {
+			old, seen := previous[key]
+			switch {
+			case previous == nil:
+				fmt.Printf("  %s => %s\n", key, current[key])
+			case !seen:
+				fmt.Printf("+ %s => %s\n", key, current[key])
+			case old != current[key]:
+				fmt.Printf("~ %s => %s (was %s)\n", key, current[key], old)
+			}
+		}
+		for _, key := range previousOrder {
+			if _, ok := current[key]; !ok {
+				fmt.Printf("- %s => %s\n", key, previous[key])
+			}
+		}
+		previous, previousOrder = current, order
+	}
+}
+
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// kernelspecCommand prints the kernel.json of a Jupyter kernel running
+// this binary, to be installed as in
+//
+//	lambda kernelspec > ~/.local/share/jupyter/kernels/lambda/kernel.json
+func kernelspecCommand(args []string) int {
+	flags := flag.NewFlagSet("kernelspec", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: lambda kernelspec")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to locate the lambda binary:", err)
+		return 1
+	}
+	spec, _ := json.MarshalIndent(map[string]interface{}{
+		"argv":           []string{executable, "-jupyter", "{connection_file}"},
+		"display_name":   "Lambda calculus",
+		"language":       "lambda",
+		"interrupt_mode": "message",
+	}, "", "  ")
+	fmt.Println(string(spec))
+	return 0
+}
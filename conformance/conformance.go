@@ -0,0 +1,203 @@
+// Package conformance checks that a server speaks the lambda server's
+// wire protocol: line-delimited JSON requests and responses over any
+// stream transport. Implementations and forks run it from a test of
+// their own:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func() (io.ReadWriteCloser, error) {
+//			return net.Dial("unix", socket)
+//		})
+//	}
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// A Case is a request and what a conforming server answers to it.
+type Case struct {
+	Name    string
+	Request string
+
+	// Response is matched against the response: each member of an
+	// object must be in the response, with a matching value, while
+	// members it leaves out, such as timings in meta, may be anything.
+	// Arrays and other values must be equal.
+	Response string
+}
+
+// Cases are the requests a conforming server must answer as shown, each
+// on a fresh connection.
+var Cases = []Case{
+	{
+		Name:     "identity",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"(\\x.x) y"}}`,
+		Response: `{"id":1,"result":{"expression":"y"},"meta":{"steps":1}}`,
+	},
+	{
+		Name:     "normal form",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"x"}}`,
+		Response: `{"id":1,"result":{"expression":"x"},"meta":{"steps":0,"headNormalForm":true}}`,
+	},
+	{
+		Name:     "capture-avoiding substitution",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"(\\x.\\y.x y) y"}}`,
+		Response: `{"id":1,"result":{"expression":"(!y1.(y y1))"}}`,
+	},
+	{
+		Name:     "church arithmetic",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"(\\n f x.f (n f x)) (\\f x.f x)"}}`,
+		Response: `{"id":1,"result":{"expression":"(!f.(!x.(f (f x))))"}}`,
+	},
+	{
+		Name:     "string id",
+		Request:  `{"id":"a","method":"evaluate","params":{"expression":"x"}}`,
+		Response: `{"id":"a","result":{"expression":"x"}}`,
+	},
+	{
+		Name:     "step limit",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"(\\x.x x) (\\x.x x)","maxSteps":10}}`,
+		Response: `{"id":1,"error":{"code":-32002}}`,
+	},
+	{
+		Name:     "timeout",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"(\\x.x x) (\\x.x x)","timeoutMs":50}}`,
+		Response: `{"id":1,"error":{"code":-32001}}`,
+	},
+	{
+		Name:     "missing expression",
+		Request:  `{"id":1,"method":"evaluate","params":{}}`,
+		Response: `{"id":1,"error":{"code":-32602}}`,
+	},
+	{
+		Name:     "params not an object",
+		Request:  `{"id":1,"method":"evaluate","params":[1]}`,
+		Response: `{"id":1,"error":{"code":-32602}}`,
+	},
+	{
+		Name:     "syntax error",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"(x"}}`,
+		Response: `{"id":1,"error":{"code":-32602}}`,
+	},
+	{
+		Name:     "bad timeout",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"x","timeoutMs":-1}}`,
+		Response: `{"id":1,"error":{"code":-32602}}`,
+	},
+	{
+		Name:     "bad priority",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"x","priority":"urgent"}}`,
+		Response: `{"id":1,"error":{"code":-32602}}`,
+	},
+	{
+		Name:     "invalid id",
+		Request:  `{"id":{},"method":"evaluate","params":{"expression":"x"}}`,
+		Response: `{"id":null,"error":{"code":-32600}}`,
+	},
+	{
+		Name:     "unknown method",
+		Request:  `{"id":1,"method":"noSuchMethod","params":{"a":1}}`,
+		Response: `{"id":1,"result":{"a":1}}`,
+	},
+	{
+		Name:     "parse",
+		Request:  `{"id":1,"method":"parse","params":{"expression":"\\x.x"}}`,
+		Response: `{"id":1,"result":{"expression":"(!x.x)"}}`,
+	},
+	{
+		Name:     "strategies",
+		Request:  `{"id":1,"method":"evaluate","params":{"expression":"(\\x.y) ((\\x.x x) (\\x.x x))","strategy":"normal"}}`,
+		Response: `{"id":1,"result":{"expression":"y"}}`,
+	},
+}
+
+// Timeout bounds how long Run waits for each response.
+var Timeout = 10 * time.Second
+
+// Run runs every case of Cases as a subtest of t, on a connection from
+// dial.
+func Run(t *testing.T, dial func() (io.ReadWriteCloser, error)) {
+	for _, c := range Cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if err := Check(dial, c); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Check sends the request of c on a connection from dial and reports
+// how the response does not match.
+func Check(dial func() (io.ReadWriteCloser, error), c Case) error {
+	var want interface{}
+	if err := json.Unmarshal([]byte(c.Response), &want); err != nil {
+		return fmt.Errorf("bad case: %v", err)
+	}
+
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, c.Request+"\n"); err != nil {
+		return err
+	}
+
+	received := make(chan error, 1)
+	var got interface{}
+	go func() {
+		received <- json.NewDecoder(conn).Decode(&got)
+	}()
+	select {
+	case err := <-received:
+		if err != nil {
+			return fmt.Errorf("reading response: %v", err)
+		}
+	case <-time.After(Timeout):
+		return fmt.Errorf("no response within %s", Timeout)
+	}
+
+	if problem := match(want, got, "response"); problem != "" {
+		raw, _ := json.Marshal(got)
+		return fmt.Errorf("%s\ngot %s", problem, raw)
+	}
+	return nil
+}
+
+// match describes how got does not match want, found at where, or
+// returns "".
+func match(want, got interface{}, where string) string {
+	wantObject, ok := want.(map[string]interface{})
+	if !ok {
+		if !reflect.DeepEqual(want, got) {
+			return fmt.Sprintf("%s: got %v, want %v", where, got, want)
+		}
+		return ""
+	}
+	gotObject, ok := got.(map[string]interface{})
+	if !ok {
+		return fmt.Sprintf("%s: got %v, want an object", where, got)
+	}
+	names := make([]string, 0, len(wantObject))
+	for name := range wantObject {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, present := gotObject[name]
+		if !present {
+			return fmt.Sprintf("%s.%s: missing", where, name)
+		}
+		if problem := match(wantObject[name], value, where+"."+name); problem != "" {
+			return problem
+		}
+	}
+	return ""
+}
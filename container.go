@@ -0,0 +1,116 @@
+//go:build !js
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/lambda"
+)
+
+// Defaults of the container mode, which has no /var/run to put a socket
+// file in.
+const (
+	containerSocketPath = "tcp::7070"
+	containerHealthAddr = ":8081"
+)
+
+const tcpPrefix = "tcp:"
+
+// envName is the environment variable that sets the flag name.
+func envName(name string) string {
+	return "LAMBDA_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// flagsFromEnv sets every flag not given on the command line from its
+// environment variable, if set, so that a container can be configured
+// without overriding its command.
+func flagsFromEnv(lookup func(string) (string, bool)) error {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		value, ok := lookup(envName(f.Name))
+		if !ok {
+			return
+		}
+		if e := flag.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("invalid %s: %w", envName(f.Name), e)
+		}
+	})
+	return err
+}
+
+// isSet reports whether the flag name was given, on the command line or
+// in the environment.
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// listenAddress listens on address: TCP for tcp:host:port, otherwise
+// the local transport.
+func listenAddress(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, tcpPrefix) {
+		return net.Listen("tcp", strings.TrimPrefix(address, tcpPrefix))
+	}
+	return listen(address)
+}
+
+// jsonLog writes each line logged to it as a JSON object, for log
+// collectors that read a container's standard output.
+type jsonLog struct {
+	w io.Writer
+}
+
+func (l jsonLog) Write(p []byte) (int, error) {
+	line, err := json.Marshal(struct {
+		Time    string `json:"time"`
+		Message string `json:"message"`
+	}{time.Now().UTC().Format(time.RFC3339Nano), strings.TrimRight(string(p), "\n")})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// serveHealth serves /healthz on listener: 200 while the server accepts
+// connections, and 503 once it is shutting down, so that a load
+// balancer stops routing to it during the grace period.
+func serveHealth(listener net.Listener, s *lambda.Server) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status, code := "ok", http.StatusOK
+		if s.IsShuttingDown() {
+			status, code = "shutting down", http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+	})
+	if err := http.Serve(listener, mux); err != nil {
+		log.Println("Failed to serve health checks:", err)
+	}
+}
@@ -0,0 +1,480 @@
+// Package e2e runs the server binary end to end over its socket.
+//
+//	go test ./e2e
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/conformance"
+)
+
+const token = "e2e-token"
+
+var binary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "lambda-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	binary = filepath.Join(dir, "lambda")
+	build := exec.Command("go", "build", "-o", binary, "..")
+	// Without cgo, so that -sandbox works.
+	build.Env = append(os.Environ(), "CGO_ENABLED=0")
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "building server:", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+type server struct {
+	socket string
+	cmd    *exec.Cmd
+	exited chan struct{}
+	log    *serverLog
+}
+
+// serverLog collects what the server writes to stderr.
+type serverLog struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *serverLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *serverLog) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Contains(l.buf.String(), s)
+}
+
+// startServer runs the binary on a fresh socket and waits for its
+// ready notification.
+func startServer(t *testing.T, args ...string) *server {
+	t.Helper()
+	s, err := launch(t, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// launch is startServer reporting a server that never became ready as
+// an error, after it exits; its log then says why.
+func launch(t *testing.T, args ...string) (*server, error) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "sock")
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readyRead.Close()
+
+	args = append([]string{"-socket", socket, "-ready-fd", "3", "-shutdown-token", token}, args...)
+	cmd := exec.Command(binary, args...)
+	cmd.ExtraFiles = []*os.File{readyWrite}
+	// The log is read off a pipe of our own rather than through
+	// cmd.Stderr, as a restarted server inherits it and Wait would wait
+	// for that one too.
+	log := &serverLog{}
+	logRead, logWrite, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Stderr = logWrite
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	readyWrite.Close()
+	logWrite.Close()
+	logged := make(chan struct{})
+	go func() {
+		io.Copy(log, logRead)
+		logRead.Close()
+		close(logged)
+	}()
+
+	s := &server{socket: socket, cmd: cmd, exited: make(chan struct{}), log: log}
+	go func() {
+		cmd.Wait()
+		close(s.exited)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-s.exited
+	})
+
+	readyRead.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := readyRead.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		<-s.exited
+		<-logged
+		return s, fmt.Errorf("server did not become ready: %v", err)
+	}
+	return s, nil
+}
+
+type client struct {
+	conn    net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+type response struct {
+	ID     interface{}            `json:"id"`
+	Result json.RawMessage        `json:"result"`
+	Error  *rpcError              `json:"error"`
+	Meta   map[string]interface{} `json:"meta"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *server) dial(t *testing.T) *client {
+	t.Helper()
+	conn, err := net.Dial("unix", s.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	return &client{conn, json.NewEncoder(conn), json.NewDecoder(conn)}
+}
+
+func (c *client) send(t *testing.T, id interface{}, method string, params interface{}) {
+	t.Helper()
+	request := map[string]interface{}{"id": id, "method": method, "params": params}
+	if err := c.encoder.Encode(request); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *client) receive(t *testing.T) response {
+	t.Helper()
+	var r response
+	if err := c.decoder.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func (c *client) call(t *testing.T, method string, params interface{}) response {
+	t.Helper()
+	c.send(t, 1, method, params)
+	return c.receive(t)
+}
+
+func expression(t *testing.T, r response) string {
+	t.Helper()
+	if r.Error != nil {
+		t.Fatalf("unexpected error %d: %s", r.Error.Code, r.Error.Message)
+	}
+	var result struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal(r.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Expression
+}
+
+func TestEvaluate(t *testing.T) {
+	s := startServer(t)
+	c := s.dial(t)
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{`x`, `x`},
+		{`(\x.x) y`, `y`},
+		{`(\x y.x) a b`, `a`},
+		{`(\x.\y.x y) y`, `(!y1.(y y1))`},
+		{`(\n f x.f (n f x)) (\f x.f x)`, `(!f.(!x.(f (f x))))`},
+	}
+	for _, test := range tests {
+		r := c.call(t, "evaluate", map[string]interface{}{"expression": test.expression})
+		if got := expression(t, r); got != test.want {
+			t.Errorf("evaluate %q = %q, want %q", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	s := startServer(t)
+	conformance.Run(t, func() (io.ReadWriteCloser, error) {
+		return net.Dial("unix", s.socket)
+	})
+}
+
+func TestInvalidRequests(t *testing.T) {
+	s := startServer(t)
+	c := s.dial(t)
+
+	tests := []struct {
+		name   string
+		params interface{}
+		code   int
+	}{
+		{"params not an object", []int{1}, -32602},
+		{"missing expression", map[string]interface{}{}, -32602},
+		{"unbalanced parentheses", map[string]interface{}{"expression": "(x"}, -32602},
+		{"bad character", map[string]interface{}{"expression": "x % y"}, -32602},
+		{"bad timeout", map[string]interface{}{"expression": "x", "timeoutMs": -1}, -32602},
+		{"bad priority", map[string]interface{}{"expression": "x", "priority": "urgent"}, -32602},
+	}
+	for _, test := range tests {
+		r := c.call(t, "evaluate", test.params)
+		if r.Error == nil || r.Error.Code != test.code {
+			t.Errorf("%s: got error %+v, want code %d", test.name, r.Error, test.code)
+		}
+	}
+
+	// The connection survives all of the above.
+	if got := expression(t, c.call(t, "evaluate", map[string]interface{}{"expression": "y"})); got != "y" {
+		t.Errorf("evaluate after errors = %q, want y", got)
+	}
+}
+
+func TestTimeoutCancelsEvaluation(t *testing.T) {
+	s := startServer(t)
+	c := s.dial(t)
+
+	start := time.Now()
+	r := c.call(t, "evaluate", map[string]interface{}{
+		"expression": `(\x.x x) (\x.x x)`,
+		"timeoutMs":  50,
+	})
+	if r.Error == nil || r.Error.Code != -32001 {
+		t.Fatalf("got error %+v, want timeout", r.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout took %s", elapsed)
+	}
+}
+
+func TestPipelinedRequestsMatchByID(t *testing.T) {
+	s := startServer(t)
+	c := s.dial(t)
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		c.send(t, i, "evaluate", map[string]interface{}{"expression": fmt.Sprintf(`(\x.x) v%d`, i)})
+	}
+	seen := map[int]bool{}
+	for i := 0; i < n; i++ {
+		r := c.receive(t)
+		id := int(r.ID.(float64))
+		if want := fmt.Sprintf("v%d", id); expression(t, r) != want {
+			t.Errorf("response %d = %q, want %q", id, expression(t, r), want)
+		}
+		seen[id] = true
+	}
+	if len(seen) != n {
+		t.Errorf("got %d distinct responses, want %d", len(seen), n)
+	}
+}
+
+func TestConcurrentConnections(t *testing.T) {
+	s := startServer(t)
+
+	clients := make([]*client, 16)
+	for i := range clients {
+		clients[i] = s.dial(t)
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			want := fmt.Sprintf("c%d", i)
+			request := map[string]interface{}{
+				"id":     i,
+				"method": "evaluate",
+				"params": map[string]interface{}{"expression": `(\x y.y) a ` + want},
+			}
+			var r struct {
+				Result struct {
+					Expression string `json:"expression"`
+				} `json:"result"`
+			}
+			if err := c.encoder.Encode(request); err != nil {
+				t.Errorf("connection %d: %v", i, err)
+				return
+			}
+			if err := c.decoder.Decode(&r); err != nil {
+				t.Errorf("connection %d: %v", i, err)
+				return
+			}
+			if r.Result.Expression != want {
+				t.Errorf("connection %d got %q, want %q", i, r.Result.Expression, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestShutdown(t *testing.T) {
+	s := startServer(t)
+	c := s.dial(t)
+
+	r := c.call(t, "shutdown", map[string]interface{}{"token": "wrong"})
+	if r.Error == nil || r.Error.Code != -32003 {
+		t.Fatalf("shutdown with a bad token: got error %+v", r.Error)
+	}
+
+	r = c.call(t, "shutdown", map[string]interface{}{"token": token})
+	if r.Error != nil {
+		t.Fatalf("shutdown: %s", r.Error.Message)
+	}
+
+	select {
+	case <-s.exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("server still running after shutdown")
+	}
+	if _, err := os.Stat(s.socket); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	s := startServer(t)
+	c := s.dial(t)
+
+	r := c.call(t, "restart", map[string]interface{}{"token": "wrong"})
+	if r.Error == nil || r.Error.Code != -32003 {
+		t.Fatalf("restart with a bad token: got error %+v", r.Error)
+	}
+	r = c.call(t, "restart", map[string]interface{}{"token": token})
+	if r.Error != nil {
+		t.Fatalf("restart: %s", r.Error.Message)
+	}
+
+	// The old process hands the socket over before it exits.
+	select {
+	case <-s.exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("old server still running after restart")
+	}
+	c = s.dial(t)
+	if got := expression(t, c.call(t, "evaluate", map[string]interface{}{"expression": `(\x.x) a`})); got != "a" {
+		t.Errorf("evaluate after restart: got %s, want a", got)
+	}
+
+	// The new process is no child of the test, so it is stopped by
+	// the shutdown method rather than killed.
+	if r := c.call(t, "shutdown", map[string]interface{}{"token": token}); r.Error != nil {
+		t.Fatalf("shutdown: %s", r.Error.Message)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(s.socket); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("new server still running after shutdown")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	s := startServer(t, "-strict")
+	c := s.dial(t)
+
+	for _, line := range []string{
+		`{"id": 1, "method": "evaluate", "params": {"expression": "x"}}`,
+		`{"jsonrpc": "1.0", "id": 1, "method": "evaluate", "params": {"expression": "x"}}`,
+		`{"jsonrpc": "2.0", "id": 1, "method": "evaluate", "params": {"expression": "x"}, "extra": true}`,
+		`{"jsonrpc": "2.0", "id": 1, "method": "evaluate", "params": "x"}`,
+	} {
+		if _, err := io.WriteString(c.conn, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		if r := c.receive(t); r.Error == nil || r.Error.Code != -32600 {
+			t.Errorf("%s: got error %+v, want an invalid request error", line, r.Error)
+		}
+	}
+
+	if _, err := io.WriteString(c.conn, `{"jsonrpc": "2.0", "id": 2, "method": "evaluate", "params": {"expression": "(\\x.x) a"}}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	var r struct {
+		JSONRPC string `json:"jsonrpc"`
+		response
+	}
+	if err := c.decoder.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if got := expression(t, r.response); got != "a" || r.JSONRPC != "2.0" {
+		t.Errorf("conforming request: got %q with jsonrpc %q, want a with 2.0", got, r.JSONRPC)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	traceDir := t.TempDir()
+	s, err := launch(t, "-sandbox", "-trace-dir", traceDir)
+	if err != nil {
+		if s.log.contains("Failed to sandbox") {
+			t.Skip("Landlock is not available here")
+		}
+		t.Fatal(err)
+	}
+	c := s.dial(t)
+
+	// Trace files may still be written, in the trace directory only.
+	r := c.call(t, "evaluate", map[string]interface{}{"expression": `(\x.x) a`, "traceFile": true})
+	if got := expression(t, r); got != "a" {
+		t.Errorf("evaluate: got %s, want a", got)
+	}
+	if files, err := os.ReadDir(traceDir); err != nil || len(files) != 1 {
+		t.Errorf("trace directory holds %d files (%v), want 1", len(files), err)
+	}
+
+	// Restarting executes the binary, which the sandbox forbids; the
+	// server carries on instead.
+	if r := c.call(t, "restart", map[string]interface{}{"token": token}); r.Error != nil {
+		t.Fatalf("restart: %s", r.Error.Message)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !s.log.contains("Failed to restart") {
+		if time.Now().After(deadline) {
+			t.Fatal("restart under the sandbox did not fail")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	c = s.dial(t)
+	if got := expression(t, c.call(t, "evaluate", map[string]interface{}{"expression": `(\x.x) b`})); got != "b" {
+		t.Errorf("evaluate after a failed restart: got %s, want b", got)
+	}
+}
@@ -2,4 +2,4 @@ module example.com
 
 go 1.18
 
-require github.com/oleiade/lane v1.0.1 // indirect
+require github.com/oleiade/lane v1.0.1
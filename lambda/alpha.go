@@ -0,0 +1,49 @@
+package lambda
+
+// alphaEquivalent reports whether a and b are the same term up to the
+// names of bound variables.
+func alphaEquivalent(a, b expression) bool {
+	return alphaEqual(a, b, nil, nil)
+}
+
+// alphaEqual compares a and b under the binder stacks boundA and
+// boundB, innermost last.
+func alphaEqual(a, b expression, boundA, boundB []string) bool {
+	switch x := a.(type) {
+	case *variable:
+		y, ok := b.(*variable)
+		if !ok {
+			return false
+		}
+		i, j := bindingDepth(boundA, x.name), bindingDepth(boundB, y.name)
+		if i < 0 && j < 0 {
+			return x.name == y.name
+		}
+		return i == j
+	case *abstraction:
+		y, ok := b.(*abstraction)
+		if !ok {
+			return false
+		}
+		return alphaEqual(x.body, y.body, append(boundA, x.parameter.name), append(boundB, y.parameter.name))
+	case *application:
+		y, ok := b.(*application)
+		if !ok {
+			return false
+		}
+		return alphaEqual(x.left, y.left, boundA, boundB) && alphaEqual(x.right, y.right, boundA, boundB)
+	default:
+		return false
+	}
+}
+
+// bindingDepth returns the de Bruijn index of name in bound, or -1 when
+// name is free.
+func bindingDepth(bound []string, name string) int {
+	for i := len(bound) - 1; i >= 0; i-- {
+		if bound[i] == name {
+			return len(bound) - 1 - i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,54 @@
+package lambda
+
+// applicativeOrder contracts the leftmost-innermost redex, so that
+// arguments are reduced to normal form before they are substituted.
+// Unlike normal order it can diverge on terms that have a normal form:
+// (\x y.x) a ((\x.x x) (\x.x x)) loops on the discarded argument.
+type applicativeOrder struct{}
+
+func init() {
+	registerStrategy(applicativeOrder{})
+}
+
+func (applicativeOrder) name() string {
+	return "applicative"
+}
+
+func (applicativeOrder) description() string {
+	return "leftmost-innermost; evaluates arguments first and may diverge where normal order terminates"
+}
+
+func (applicativeOrder) step(expr expression) (expression, path, bool) {
+	at, ok := innermostRedex(expr)
+	if !ok {
+		return expr, nil, false
+	}
+	next, _ := contractAt(expr, at)
+	return next, at, true
+}
+
+func (applicativeOrder) isNormal(expr expression) bool {
+	_, ok := innermostRedex(expr)
+	return !ok
+}
+
+// innermostRedex finds the leftmost redex that contains no other redex.
+func innermostRedex(expr expression) (path, bool) {
+	switch e := expr.(type) {
+	case *abstraction:
+		if p, ok := innermostRedex(e.body); ok {
+			return append(path{0}, p...), true
+		}
+	case *application:
+		if p, ok := innermostRedex(e.left); ok {
+			return append(path{0}, p...), true
+		}
+		if p, ok := innermostRedex(e.right); ok {
+			return append(path{1}, p...), true
+		}
+		if _, ok := e.left.(*abstraction); ok {
+			return path{}, true
+		}
+	}
+	return nil, false
+}
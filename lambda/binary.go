@@ -0,0 +1,224 @@
+package lambda
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// binaryVersion is the first byte of every binary encoding.
+const binaryVersion = 1
+
+// The binary encoding of a term is its version, then its free variable
+// names, as a count followed by length-prefixed strings, then its nodes
+// in prefix order, each an unsigned varint tag:
+//
+//	0        abstraction, followed by its body
+//	1        application, followed by its two sides
+//	2 + 2*i  bound variable with de Bruijn index i
+//	3 + 2*j  free variable j of the name table
+//
+// Binder names are not kept; decoding names binders x0, x1, ...
+const (
+	tagAbstraction = 0
+	tagApplication = 1
+)
+
+func encodeBinary(expr expression) []byte {
+	free := freeVariables(expr)
+	names := make([]string, 0, len(free))
+	for name := range free {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	index := map[string]int{}
+	for i, name := range names {
+		index[name] = i
+	}
+
+	b := []byte{binaryVersion}
+	b = appendUvarint(b, uint64(len(names)))
+	for _, name := range names {
+		b = appendUvarint(b, uint64(len(name)))
+		b = append(b, name...)
+	}
+
+	var write func(expression, []string)
+	write = func(expr expression, bound []string) {
+		switch e := expr.(type) {
+		case *variable:
+			if depth := bindingDepth(bound, e.name); depth >= 0 {
+				b = appendUvarint(b, 2+2*uint64(depth))
+			} else {
+				b = appendUvarint(b, 3+2*uint64(index[e.name]))
+			}
+		case *abstraction:
+			b = appendUvarint(b, tagAbstraction)
+			write(e.body, append(bound, e.parameter.name))
+		case *application:
+			b = appendUvarint(b, tagApplication)
+			write(e.left, bound)
+			write(e.right, bound)
+		}
+	}
+	write(expr, nil)
+	return b
+}
+
+func appendUvarint(b []byte, n uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], n)]...)
+}
+
+var errBinaryTruncated = errors.New("truncated encoding")
+
+func decodeBinary(b []byte) (expression, error) {
+	if len(b) == 0 || b[0] != binaryVersion {
+		return nil, errors.New("unknown encoding version")
+	}
+	b = b[1:]
+	uvarint := func() (uint64, error) {
+		n, size := binary.Uvarint(b)
+		if size <= 0 {
+			return 0, errBinaryTruncated
+		}
+		b = b[size:]
+		return n, nil
+	}
+
+	count, err := uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(b)) {
+		return nil, errBinaryTruncated
+	}
+	names := make([]string, count)
+	free := map[string]bool{}
+	for i := range names {
+		length, err := uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if length > uint64(len(b)) {
+			return nil, errBinaryTruncated
+		}
+		names[i] = string(b[:length])
+		b = b[length:]
+		if !validName(names[i]) {
+			return nil, fmt.Errorf("invalid free variable name %q", names[i])
+		}
+		free[names[i]] = true
+	}
+
+	next := 0
+	fresh := func() string {
+		for {
+			name := "x" + strconv.Itoa(next)
+			next++
+			if !free[name] {
+				return name
+			}
+		}
+	}
+
+	var read func([]string) (expression, error)
+	read = func(bound []string) (expression, error) {
+		tag, err := uvarint()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tag == tagAbstraction:
+			parameter := fresh()
+			body, err := read(append(bound, parameter))
+			if err != nil {
+				return nil, err
+			}
+			return &abstraction{parameter: variable{name: parameter}, body: body}, nil
+		case tag == tagApplication:
+			left, err := read(bound)
+			if err != nil {
+				return nil, err
+			}
+			right, err := read(bound)
+			if err != nil {
+				return nil, err
+			}
+			return &application{left: left, right: right}, nil
+		case tag%2 == 0:
+			i := (tag - 2) / 2
+			if i >= uint64(len(bound)) {
+				return nil, fmt.Errorf("de Bruijn index %d out of range", i)
+			}
+			return &variable{name: bound[uint64(len(bound))-1-i]}, nil
+		default:
+			j := (tag - 3) / 2
+			if j >= uint64(len(names)) {
+				return nil, fmt.Errorf("free variable %d out of range", j)
+			}
+			return &variable{name: names[j]}, nil
+		}
+	}
+	expr, err := read(nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 {
+		return nil, errors.New("trailing bytes after term")
+	}
+	return expr, nil
+}
+
+// encodeTerm returns the binary encoding of an expression, in base64.
+func (c *connection) encodeTerm(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	encoded := encodeBinary(expr)
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Encoding string `json:"encoding"`
+			Bytes    int    `json:"bytes"`
+		}{
+			Encoding: base64.StdEncoding.EncodeToString(encoded),
+			Bytes:    len(encoded),
+		},
+	}
+}
+
+// decodeTerm prints a term given in the binary encoding, in base64.
+func decodeTerm(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	source, ok := params["encoding"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid encoding parameter")
+	}
+	print, err := printStyleParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	encoded, err := base64.StdEncoding.DecodeString(source)
+	if err != nil {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid encoding parameter: not base64")
+	}
+	expr, err := decodeBinary(encoded)
+	if err != nil {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid encoding parameter: "+err.Error())
+	}
+	return Response{ID: request.ID, Result: struct {
+		Expression string `json:"expression"`
+	}{print(expr)}}
+}
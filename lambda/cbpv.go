@@ -0,0 +1,357 @@
+package lambda
+
+import (
+	"fmt"
+	"strings"
+)
+
+// This file holds an experimental call-by-push-value calculus, after
+// Levy. Values are variables and thunks of computations; computations
+// return a value, sequence one computation into another with to, take
+// an argument with λ, apply to a value or force a thunk. Lambda terms
+// are translated in by their call-by-value or call-by-name embedding,
+// which makes evaluation order explicit in the term itself. The cbpv
+// method sits behind the -experimental-cbpv flag.
+
+const defaultCBPVSteps = 10000
+
+type cbpvTerm interface{ isCBPV() }
+
+type cbpvVariable struct{ name string }
+
+type cbpvThunk struct{ body cbpvTerm }
+
+type cbpvReturn struct{ value cbpvTerm }
+
+// cbpvTo is M to x. N, which runs M and binds what it returns to x in
+// N.
+type cbpvTo struct {
+	computation cbpvTerm
+	name        string
+	body        cbpvTerm
+}
+
+type cbpvLambda struct {
+	name string
+	body cbpvTerm
+}
+
+type cbpvApply struct{ function, argument cbpvTerm }
+
+type cbpvForce struct{ value cbpvTerm }
+
+func (*cbpvVariable) isCBPV() {}
+func (*cbpvThunk) isCBPV()    {}
+func (*cbpvReturn) isCBPV()   {}
+func (*cbpvTo) isCBPV()       {}
+func (*cbpvLambda) isCBPV()   {}
+func (*cbpvApply) isCBPV()    {}
+func (*cbpvForce) isCBPV()    {}
+
+// cbpvTranslations embed lambda terms as computations. fresh names the
+// variables the translation introduces.
+var cbpvTranslations = map[string]func(expr expression, fresh func(string) string) cbpvTerm{
+	"cbv": cbvTranslation,
+	"cbn": cbnTranslation,
+}
+
+// cbvTranslation evaluates the function and then the argument of each
+// application to values before applying; an abstraction returns a
+// thunk of its body.
+func cbvTranslation(expr expression, fresh func(string) string) cbpvTerm {
+	switch e := expr.(type) {
+	case *variable:
+		return &cbpvReturn{&cbpvVariable{e.name}}
+	case *abstraction:
+		return &cbpvReturn{&cbpvThunk{&cbpvLambda{e.parameter.name, cbvTranslation(e.body, fresh)}}}
+	case *application:
+		f, a := fresh("f"), fresh("a")
+		call := &cbpvApply{&cbpvForce{&cbpvVariable{f}}, &cbpvVariable{a}}
+		return &cbpvTo{cbvTranslation(e.left, fresh), f, &cbpvTo{cbvTranslation(e.right, fresh), a, call}}
+	}
+	panic("Invalid expression")
+}
+
+// cbnTranslation passes each argument as a thunk, which every use of
+// the variable forces anew.
+func cbnTranslation(expr expression, fresh func(string) string) cbpvTerm {
+	switch e := expr.(type) {
+	case *variable:
+		return &cbpvForce{&cbpvVariable{e.name}}
+	case *abstraction:
+		return &cbpvLambda{e.parameter.name, cbnTranslation(e.body, fresh)}
+	case *application:
+		return &cbpvApply{cbnTranslation(e.left, fresh), &cbpvThunk{cbnTranslation(e.right, fresh)}}
+	}
+	panic("Invalid expression")
+}
+
+func cbpvFree(t cbpvTerm, free map[string]bool) {
+	switch e := t.(type) {
+	case *cbpvVariable:
+		free[e.name] = true
+	case *cbpvThunk:
+		cbpvFree(e.body, free)
+	case *cbpvReturn:
+		cbpvFree(e.value, free)
+	case *cbpvForce:
+		cbpvFree(e.value, free)
+	case *cbpvApply:
+		cbpvFree(e.function, free)
+		cbpvFree(e.argument, free)
+	case *cbpvTo:
+		cbpvFree(e.computation, free)
+		inner := map[string]bool{}
+		cbpvFree(e.body, inner)
+		delete(inner, e.name)
+		for name := range inner {
+			free[name] = true
+		}
+	case *cbpvLambda:
+		inner := map[string]bool{}
+		cbpvFree(e.body, inner)
+		delete(inner, e.name)
+		for name := range inner {
+			free[name] = true
+		}
+	}
+}
+
+// cbpvSubstitute replaces the free occurrences of x in t by v, renaming
+// binders that would capture a free variable of v.
+func cbpvSubstitute(t cbpvTerm, x string, v cbpvTerm) cbpvTerm {
+	// binder substitutes under a binder of name, returning the name
+	// and body to use.
+	binder := func(name string, body cbpvTerm) (string, cbpvTerm) {
+		if name == x {
+			return name, body
+		}
+		free := map[string]bool{}
+		cbpvFree(v, free)
+		if free[name] {
+			cbpvFree(body, free)
+			free[x] = true
+			renamed := freshName(name, free)
+			body = cbpvSubstitute(body, name, &cbpvVariable{renamed})
+			name = renamed
+		}
+		return name, cbpvSubstitute(body, x, v)
+	}
+	switch e := t.(type) {
+	case *cbpvVariable:
+		if e.name == x {
+			return v
+		}
+		return e
+	case *cbpvThunk:
+		return &cbpvThunk{cbpvSubstitute(e.body, x, v)}
+	case *cbpvReturn:
+		return &cbpvReturn{cbpvSubstitute(e.value, x, v)}
+	case *cbpvForce:
+		return &cbpvForce{cbpvSubstitute(e.value, x, v)}
+	case *cbpvApply:
+		return &cbpvApply{cbpvSubstitute(e.function, x, v), cbpvSubstitute(e.argument, x, v)}
+	case *cbpvTo:
+		name, body := binder(e.name, e.body)
+		return &cbpvTo{cbpvSubstitute(e.computation, x, v), name, body}
+	case *cbpvLambda:
+		name, body := binder(e.name, e.body)
+		return &cbpvLambda{name, body}
+	}
+	panic("Invalid term")
+}
+
+// cbpvStep takes one step of the computation m, returning the rule
+// applied. Terminal computations, return V and λx.M, take none, and
+// neither do those stuck on a free variable.
+func cbpvStep(m cbpvTerm) (cbpvTerm, string, bool) {
+	switch e := m.(type) {
+	case *cbpvTo:
+		if r, ok := e.computation.(*cbpvReturn); ok {
+			return cbpvSubstitute(e.body, e.name, r.value), "to", true
+		}
+		if next, rule, ok := cbpvStep(e.computation); ok {
+			return &cbpvTo{next, e.name, e.body}, rule, true
+		}
+	case *cbpvApply:
+		if fn, ok := e.function.(*cbpvLambda); ok {
+			return cbpvSubstitute(fn.body, fn.name, e.argument), "beta", true
+		}
+		if next, rule, ok := cbpvStep(e.function); ok {
+			return &cbpvApply{next, e.argument}, rule, true
+		}
+	case *cbpvForce:
+		if thunk, ok := e.value.(*cbpvThunk); ok {
+			return thunk.body, "force", true
+		}
+	}
+	return m, "", false
+}
+
+func printCBPV(t cbpvTerm) string {
+	var b strings.Builder
+	writeCBPV(&b, t, 0)
+	return b.String()
+}
+
+// writeCBPV prints t at a level: 0 allows anything, 1 anything but λ
+// and to, which extend as far right as they can, and 2 only variables
+// and parenthesized terms.
+func writeCBPV(b *strings.Builder, t cbpvTerm, level int) {
+	var at int
+	switch t.(type) {
+	case *cbpvVariable:
+		at = 2
+	case *cbpvLambda, *cbpvTo:
+		at = 0
+	default:
+		at = 1
+	}
+	if at < level {
+		b.WriteString("(")
+		defer b.WriteString(")")
+	}
+	switch e := t.(type) {
+	case *cbpvVariable:
+		b.WriteString(e.name)
+	case *cbpvThunk:
+		b.WriteString("thunk ")
+		writeCBPV(b, e.body, 2)
+	case *cbpvReturn:
+		b.WriteString("return ")
+		writeCBPV(b, e.value, 2)
+	case *cbpvForce:
+		b.WriteString("force ")
+		writeCBPV(b, e.value, 2)
+	case *cbpvApply:
+		writeCBPV(b, e.function, 1)
+		b.WriteString(" ")
+		writeCBPV(b, e.argument, 2)
+	case *cbpvTo:
+		writeCBPV(b, e.computation, 1)
+		fmt.Fprintf(b, " to %s. ", e.name)
+		writeCBPV(b, e.body, 0)
+	case *cbpvLambda:
+		fmt.Fprintf(b, `\%s.`, e.name)
+		writeCBPV(b, e.body, 0)
+	}
+}
+
+type cbpvTraceStep struct {
+	Step int    `json:"step"`
+	Term string `json:"term"`
+
+	// Rule is the rule applied to get to the next step: to, beta or
+	// force. The last step has none.
+	Rule string `json:"rule,omitempty"`
+}
+
+type cbpvResult struct {
+	Translation string `json:"translation"`
+
+	// Term is the translated expression and Result the computation it
+	// steps to, terminal when it returns a value or is an abstraction
+	// and stuck on a free variable otherwise.
+	Term     string          `json:"term"`
+	Result   string          `json:"result"`
+	Terminal bool            `json:"terminal"`
+	Trace    []cbpvTraceStep `json:"trace,omitempty"`
+}
+
+// cbpv translates an expression into call-by-push-value, by the
+// translation parameter, cbv by default, and runs the computation.
+// With trace, every step is returned.
+func (c *connection) cbpv(request Request) Response {
+	if !c.server.experimentalCBPV {
+		return errorResponse(request.ID, codeMethodNotFound, "call-by-push-value is disabled; start the server with -experimental-cbpv")
+	}
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	name := "cbv"
+	if raw, present := params["translation"]; present {
+		name, _ = raw.(string)
+	}
+	translate, ok := cbpvTranslations[name]
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid translation parameter: want cbv or cbn, got %q", name))
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := c.server.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if maxSteps == 0 {
+		maxSteps = defaultCBPVSteps
+	}
+	trace, _ := params["trace"].(bool)
+
+	used := variableNames(expr)
+	fresh := func(base string) string {
+		name := freshName(base, used)
+		used[name] = true
+		return name
+	}
+	term := translate(expr, fresh)
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+	done := ctx.Done()
+
+	result := cbpvResult{Translation: name, Term: printCBPV(term)}
+	m, steps := term, 0
+	defer func() { meterSteps(ctx, steps) }()
+	for {
+		select {
+		case <-done:
+			return errorResponse(request.ID, codeTimeout, fmt.Sprintf("reduction timed out after %s (%d steps)", timeout, steps))
+		default:
+		}
+		next, rule, ok := cbpvStep(m)
+		if trace && len(result.Trace) < maxTraceSteps {
+			result.Trace = append(result.Trace, cbpvTraceStep{Step: steps, Term: printCBPV(m), Rule: rule})
+		}
+		if !ok {
+			break
+		}
+		if steps == maxSteps {
+			return errorResponse(request.ID, codeLimitExceeded, fmt.Sprintf("reduction stopped at the limit of %d steps", steps))
+		}
+		m = next
+		steps++
+	}
+	switch m.(type) {
+	case *cbpvReturn, *cbpvLambda:
+		result.Terminal = true
+	}
+	result.Result = printCBPV(m)
+	return Response{ID: request.ID, Result: result, Meta: map[string]interface{}{"steps": steps}}
+}
+
+// variableNames returns every variable name in expr, bound or free.
+func variableNames(expr expression) map[string]bool {
+	names := map[string]bool{}
+	var walk func(expression)
+	walk = func(expr expression) {
+		switch e := expr.(type) {
+		case *variable:
+			names[e.name] = true
+		case *abstraction:
+			names[e.parameter.name] = true
+			walk(e.body)
+		case *application:
+			walk(e.left)
+			walk(e.right)
+		}
+	}
+	walk(expr)
+	return names
+}
@@ -0,0 +1,132 @@
+package lambda
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+// codegenPrelude is the runtime every generated program carries. Terms
+// compile to Go closures; printing the result applies closures to
+// symbolic variables to read the normal form back.
+const codegenPrelude = `// Code generated by the lambda server's codegen method. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type value interface{}
+
+type closure func(value) value
+
+// neutral is a variable applied to arguments, met while reading back.
+type neutral struct {
+	name string
+	args []value
+}
+
+func apply(f, x value) value {
+	if c, ok := f.(closure); ok {
+		return c(x)
+	}
+	n := f.(neutral)
+	return neutral{n.name, append(n.args[:len(n.args):len(n.args)], x)}
+}
+
+var fresh int
+
+func readback(v value) string {
+	switch v := v.(type) {
+	case closure:
+		fresh++
+		name := "x" + strconv.Itoa(fresh)
+		return "(!" + name + "." + readback(v(neutral{name: name})) + ")"
+	case neutral:
+		s := v.name
+		for _, arg := range v.args {
+			s = "(" + s + " " + readback(arg) + ")"
+		}
+		return s
+	}
+	panic("unreachable")
+}
+
+func main() {
+	fmt.Println(readback(term()))
+}
+`
+
+// codegen compiles a closed expression to a standalone Go program that
+// prints its normal form. The program evaluates arguments before
+// calling closures, so terms that rely on lazy evaluation to reach a
+// normal form loop.
+func (c *connection) codegen(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if free := freeVariables(expr); len(free) > 0 {
+		var names []string
+		for name := range free {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return errorResponse(request.ID, codeInvalidParams, "expression must be closed; free variables: "+strings.Join(names, ", "))
+	}
+
+	var b strings.Builder
+	b.WriteString(codegenPrelude)
+	fmt.Fprintf(&b, "\n// term is %s\nfunc term() value {\n\treturn ", expr)
+	compileGo(&b, expr)
+	b.WriteString("\n}\n")
+
+	source, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return errorResponse(request.ID, codeInternalError, fmt.Sprintf("generated invalid Go: %v", err))
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Source string `json:"source"`
+		}{
+			Source: string(source),
+		},
+	}
+}
+
+// goName turns a variable name into a Go identifier, spelling primes,
+// which Go does not allow, as _p and underscores as __ so that distinct
+// names stay distinct.
+func goName(name string) string {
+	return "v_" + strings.NewReplacer("_", "__", "'", "_p").Replace(name)
+}
+
+// compileGo writes expr as a Go expression of type value. Variables
+// get a prefix so that they cannot collide with Go keywords or the
+// runtime.
+func compileGo(b *strings.Builder, expr expression) {
+	switch e := expr.(type) {
+	case *variable:
+		b.WriteString(goName(e.name))
+	case *abstraction:
+		fmt.Fprintf(b, "closure(func(%s value) value { return ", goName(e.parameter.name))
+		compileGo(b, e.body)
+		b.WriteString(" })")
+	case *application:
+		b.WriteString("apply(")
+		compileGo(b, e.left)
+		b.WriteString(", ")
+		compileGo(b, e.right)
+		b.WriteString(")")
+	default:
+		panic("Invalid expression")
+	}
+}
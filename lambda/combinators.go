@@ -0,0 +1,295 @@
+package lambda
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Combinatory logic: terms built by application alone from variables
+// and the combinators below, which reduce by rewriting rather than
+// substitution. The ski syntax reads such terms as lambda terms, with
+// each combinator standing for its definition, while
+// reduceCombinators reduces them by the combinator rules and
+// translateCombinators turns lambda terms into them.
+
+// A combinator takes arity arguments and rewrites its application to
+// them.
+type combinator struct {
+	arity      int
+	rewrite    func(args []expression) expression
+	definition string
+}
+
+// applyArgs applies fn to args in turn.
+func applyArgs(fn expression, args ...expression) expression {
+	for _, arg := range args {
+		fn = apply(fn, arg)
+	}
+	return fn
+}
+
+var combinators = map[string]combinator{
+	"I": {1, func(a []expression) expression { return a[0] }, `\x.x`},
+	"K": {2, func(a []expression) expression { return a[0] }, `\x y.x`},
+	"S": {3, func(a []expression) expression { return applyArgs(a[0], a[2], applyArgs(a[1], a[2])) }, `\x y z.x z (y z)`},
+	"B": {3, func(a []expression) expression { return applyArgs(a[0], applyArgs(a[1], a[2])) }, `\x y z.x (y z)`},
+	"C": {3, func(a []expression) expression { return applyArgs(a[0], a[2], a[1]) }, `\x y z.x z y`},
+	"W": {2, func(a []expression) expression { return applyArgs(a[0], a[1], a[1]) }, `\x y.x y y`},
+}
+
+// combinatorDefinitions are the lambda terms of the combinators.
+var combinatorDefinitions = func() map[string]expression {
+	definitions := map[string]expression{}
+	for name, c := range combinators {
+		expr, err := parseLambdaExpression(c.definition)
+		if err != nil {
+			panic(err)
+		}
+		definitions[name] = withoutSpans(expr)
+	}
+	return definitions
+}()
+
+// parseCombinators parses a combinator term, written like a lambda
+// term without abstractions.
+func parseCombinators(src string, resolve resolver) (expression, []parseWarning, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, nil, withSource(err, src)
+	}
+	for _, t := range tokens {
+		if t.kind == tokenLambda {
+			return nil, nil, withSource(syntaxErrorf(t.pos, "unexpected %q: combinator terms have no abstractions", t.text), src)
+		}
+	}
+	expr, warnings, err := parseTokens(tokens, resolve, ".")
+	return expr, warnings, withSource(err, src)
+}
+
+// parseSKI is the ski syntax: a combinator term read as the lambda term
+// it stands for.
+func parseSKI(src string, resolve resolver) (expression, []parseWarning, error) {
+	expr, warnings, err := parseCombinators(src, resolve)
+	if err != nil {
+		return nil, nil, err
+	}
+	return expandDefinitions(expr, combinatorDefinitions), warnings, nil
+}
+
+// combinatorReduction reduces combinator terms leftmost-outermost. It
+// is not registered with the lambda strategies, as it treats the
+// variables naming combinators as such and contracts no beta redexes.
+type combinatorReduction struct{}
+
+func (combinatorReduction) name() string { return "combinators" }
+
+func (combinatorReduction) description() string {
+	return "Rewrites the leftmost-outermost combinator applied to enough arguments."
+}
+
+func (r combinatorReduction) isNormal(expr expression) bool {
+	_, _, ok := r.step(expr)
+	return !ok
+}
+
+func (r combinatorReduction) step(expr expression) (expression, path, bool) {
+	head, args := expr, []expression(nil)
+	for {
+		app, ok := head.(*application)
+		if !ok {
+			break
+		}
+		args = append([]expression{app.right}, args...)
+		head = app.left
+	}
+
+	if v, ok := head.(*variable); ok {
+		if c, ok := combinators[v.name]; ok && len(args) >= c.arity {
+			// The redex is the application to the first arity
+			// arguments, as deep in the spine as the arguments after
+			// them.
+			at := make(path, len(args)-c.arity)
+			return applyArgs(c.rewrite(args[:c.arity]), args[c.arity:]...), at, true
+		}
+	}
+	for i, arg := range args {
+		next, inner, ok := r.step(arg)
+		if !ok {
+			continue
+		}
+		args[i] = next
+		// Argument i is the right side of the application i levels
+		// from the innermost one.
+		at := make(path, len(args)-1-i, len(args)-i+len(inner))
+		at = append(at, 1)
+		return applyArgs(head, args...), append(at, inner...), true
+	}
+	return expr, nil, false
+}
+
+// combinatorsParam reads the expression parameter as a combinator term.
+func (c *connection) combinatorsParam(params map[string]interface{}) (expression, error) {
+	source, ok := params["expression"].(string)
+	if !ok {
+		return nil, errors.New("Invalid expression parameter")
+	}
+	expr, _, err := parseCombinators(source, c.resolve)
+	if err != nil {
+		return nil, fmt.Errorf("expression: %w", err)
+	}
+	if _, ok := findAbstraction(expr); ok {
+		return nil, errors.New("Invalid expression parameter: a reference stands for a term with abstractions")
+	}
+	return withoutSpans(expr), nil
+}
+
+func findAbstraction(expr expression) (*abstraction, bool) {
+	switch e := expr.(type) {
+	case *abstraction:
+		return e, true
+	case *application:
+		if found, ok := findAbstraction(e.left); ok {
+			return found, true
+		}
+		return findAbstraction(e.right)
+	}
+	return nil, false
+}
+
+type combinatorResult struct {
+	Expression string `json:"expression"`
+
+	// Lambda is the result as a lambda term, with toLambda.
+	Lambda string `json:"lambda,omitempty"`
+}
+
+// reduceCombinators reduces a combinator term by the rules of its
+// combinators, S K K x to x in three steps rather than the beta steps
+// of their definitions. Variables not naming a combinator are inert.
+func (c *connection) reduceCombinators(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.combinatorsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := c.server.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	toLambda, _ := params["toLambda"].(bool)
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	result, steps, err := reduce(ctx, combinatorReduction{}, expr, maxSteps, nil)
+	if errors.Is(err, errStepLimit) {
+		return errorResponse(request.ID, codeLimitExceeded, fmt.Sprintf("reduction stopped at the limit of %d steps", steps))
+	}
+	if err != nil {
+		return errorResponse(request.ID, codeTimeout, fmt.Sprintf("reduction timed out after %s (%d steps)", timeout, steps))
+	}
+	response := combinatorResult{Expression: printCompact(result)}
+	if toLambda {
+		response.Lambda = printCompact(expandDefinitions(result, combinatorDefinitions))
+	}
+	return Response{ID: request.ID, Result: response, Meta: map[string]interface{}{"steps": steps}}
+}
+
+// bases are the sets of combinators translateCombinators can target.
+// ski is plain bracket abstraction, skibc adds Turner's B and C
+// optimizations, and bckw writes S in terms of B, C and W, keeping I.
+var bases = map[string]func(expression) expression{
+	"ski":   func(expr expression) expression { return bracket(expr, false) },
+	"skibc": func(expr expression) expression { return bracket(expr, true) },
+	"bckw": func(expr expression) expression {
+		s := applyArgs(&variable{name: "B"}, applyArgs(&variable{name: "B"}, &variable{name: "W"}), applyArgs(&variable{name: "B"}, &variable{name: "B"}, &variable{name: "C"}))
+		return expandDefinitions(bracket(expr, true), map[string]expression{"S": s})
+	},
+}
+
+// bracket translates expr into combinators by bracket abstraction,
+// eliminating its abstractions innermost first. With turner, S is
+// avoided where one side of an application does not use the variable.
+func bracket(expr expression, turner bool) expression {
+	switch e := expr.(type) {
+	case *application:
+		return applyArgs(bracket(e.left, turner), bracket(e.right, turner))
+	case *abstraction:
+		parameter, body := e.parameter.name, e.body
+		// Combinators in the translated body would read as the
+		// parameter.
+		if _, ok := combinators[parameter]; ok {
+			used := freeVariables(body)
+			for name := range combinators {
+				used[name] = true
+			}
+			renamed := freshName(parameter, used)
+			body = substitute(body, e.parameter, &variable{name: renamed})
+			parameter = renamed
+		}
+		return abstractVariable(parameter, bracket(body, turner), turner)
+	}
+	return expr
+}
+
+// abstractVariable returns a combinator term that, applied to x,
+// reduces to body, a combinator term.
+func abstractVariable(x string, body expression, turner bool) expression {
+	if !freeVariables(body)[x] {
+		return applyArgs(&variable{name: "K"}, body)
+	}
+	switch e := body.(type) {
+	case *variable:
+		return &variable{name: "I"}
+	case *application:
+		// λx.M x is M when x is not free in M.
+		if v, ok := e.right.(*variable); ok && v.name == x && !freeVariables(e.left)[x] {
+			return e.left
+		}
+		if turner {
+			switch {
+			case !freeVariables(e.left)[x]:
+				return applyArgs(&variable{name: "B"}, e.left, abstractVariable(x, e.right, turner))
+			case !freeVariables(e.right)[x]:
+				return applyArgs(&variable{name: "C"}, abstractVariable(x, e.left, turner), e.right)
+			}
+		}
+		return applyArgs(&variable{name: "S"}, abstractVariable(x, e.left, turner), abstractVariable(x, e.right, turner))
+	}
+	panic("Invalid expression")
+}
+
+// translateCombinators translates a lambda term into combinators of
+// the basis parameter, skibc by default. Free variables naming
+// combinators are refused, as the result would read them as such.
+func (c *connection) translateCombinators(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	basis := "skibc"
+	if raw, present := params["basis"]; present {
+		basis, _ = raw.(string)
+	}
+	translate, ok := bases[basis]
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid basis parameter: want ski, skibc or bckw, got %q", basis))
+	}
+	for name := range freeVariables(expr) {
+		if _, ok := combinators[name]; ok {
+			return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid expression parameter: free variable %s names a combinator", name))
+		}
+	}
+	return Response{ID: request.ID, Result: combinatorResult{Expression: printCompact(translate(withoutSpans(expr)))}}
+}
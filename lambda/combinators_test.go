@@ -0,0 +1,37 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+)
+
+// TestBases checks that the translation of a term into each basis,
+// applied to enough variables, reduces by the combinator rules to what
+// the term reduces to by beta.
+func TestBases(t *testing.T) {
+	for _, source := range []string{`\x.x`, `\x y.y x`, `\f g x.f (g x) x`, `\x y z.z (x y) (y x)`} {
+		expr, err := parseLambdaExpression(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := []expression{&variable{name: "a"}, &variable{name: "b"}, &variable{name: "c"}}
+		want, _, err := normalize(context.Background(), applyArgs(withoutSpans(expr), args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, translate := range bases {
+			translated := translate(withoutSpans(expr))
+			if _, ok := findAbstraction(translated); ok {
+				t.Errorf("%s in %s: %s has abstractions", source, name, translated)
+				continue
+			}
+			got, _, err := reduce(context.Background(), combinatorReduction{}, applyArgs(translated, args...), 1000, nil)
+			if err != nil {
+				t.Fatalf("%s in %s: %v", source, name, err)
+			}
+			if !alphaEquivalent(got, want) {
+				t.Errorf("%s in %s: %s reduces to %s, want %s", source, name, translated, got, want)
+			}
+		}
+	}
+}
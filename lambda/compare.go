@@ -0,0 +1,123 @@
+package lambda
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const defaultCompareSteps = 10000
+
+type compareRun struct {
+	Strategy string `json:"strategy"`
+	Steps    int    `json:"steps"`
+
+	// NormalForm is where the strategy stops, a head normal form for
+	// head reduction. It is empty when the run stopped at the step
+	// limit or ran out of time, as Stopped then says.
+	NormalForm string `json:"normalForm,omitempty"`
+	Stopped    string `json:"stopped,omitempty"`
+}
+
+type compareResult struct {
+	Runs []compareRun `json:"runs"`
+
+	// Agree is set when every run that reached a normal form reached
+	// the same one up to alpha equivalence. Runs that stopped do not
+	// count: under call by value, for one, a term with a normal form
+	// may diverge. Nor do head reduction's, which stop short of one.
+	Agree bool `json:"agree"`
+}
+
+// compare evaluates an expression under each of a list of strategies,
+// all of them by default, to show how evaluation order changes the
+// number of steps and whether a normal form is reached at all.
+func (c *connection) compare(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	names, err := strategiesParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := c.server.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if maxSteps == 0 {
+		maxSteps = defaultCompareSteps
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	result := compareResult{Runs: []compareRun{}, Agree: true}
+	var first expression
+	total := 0
+	for _, name := range names {
+		s := strategies[name]
+		if template, ok := s.(seeded); ok {
+			s = template.withSeed(seedParam(params))
+		}
+		normalForm, steps, err := reduce(ctx, s, expr, maxSteps, nil)
+		total += steps
+		run := compareRun{Strategy: name, Steps: steps}
+		switch {
+		case errors.Is(err, errStepLimit):
+			run.Stopped = "stepLimit"
+		case err != nil:
+			run.Stopped = "timeout"
+		default:
+			run.NormalForm = normalForm.String()
+			if _, head := s.(headReduction); head {
+				break
+			}
+			if first == nil {
+				first = normalForm
+			} else if !alphaEquivalent(first, normalForm) {
+				result.Agree = false
+			}
+		}
+		result.Runs = append(result.Runs, run)
+	}
+	return Response{ID: request.ID, Result: result, Meta: map[string]interface{}{"steps": total}}
+}
+
+// strategiesParam reads the optional strategies parameter, a list of
+// strategy names, defaulting to all of them but head, which stops at a
+// head normal form.
+func strategiesParam(params map[string]interface{}) ([]string, error) {
+	raw, present := params["strategies"]
+	if !present {
+		names := make([]string, 0, len(strategies))
+		for name, s := range strategies {
+			if _, head := s.(headReduction); !head {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, errors.New("Invalid strategies parameter")
+	}
+	names := make([]string, len(list))
+	for i, item := range list {
+		name, _ := item.(string)
+		if _, ok := strategies[name]; !ok {
+			return nil, fmt.Errorf("Invalid strategies parameter: unknown strategy %q", name)
+		}
+		names[i] = name
+	}
+	return names, nil
+}
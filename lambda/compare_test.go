@@ -0,0 +1,26 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+)
+
+// TestCompareDefaults checks that a term normalizing under every
+// strategy agrees under the default ones, even where its head normal
+// form is not its normal form.
+func TestCompareDefaults(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	response := s.ServeRPC(context.Background(), Request{ID: 1, Method: "compare", Params: map[string]interface{}{"expression": `x ((\y.y) z)`}})
+	if response.Error != nil {
+		t.Fatal(response.Error.Message)
+	}
+	result := response.Result.(compareResult)
+	if !result.Agree {
+		t.Errorf("the strategies disagree: %+v", result.Runs)
+	}
+	for _, run := range result.Runs {
+		if run.Strategy == "head" {
+			t.Error("head is compared by default")
+		}
+	}
+}
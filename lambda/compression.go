@@ -0,0 +1,106 @@
+package lambda
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+)
+
+// supportedCompression lists the stream encodings hello can negotiate,
+// in order of server preference. zstd is not offered: it would need a
+// dependency outside the standard library.
+var supportedCompression = []string{"gzip"}
+
+// hello negotiates connection options. The client lists the encodings
+// it accepts under compression; the server answers with the one it
+// picked (or "none") in plain JSON, and from the next frame on both
+// directions use that encoding for the rest of the connection.
+func (c *connection) hello(request Request) bool {
+	chosen := "none"
+	if params, ok := request.Params.(map[string]interface{}); ok {
+		offered, _ := params["compression"].([]interface{})
+		chosen = chooseCompression(offered)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.compressor != nil {
+		return c.writeResponse(errorResponse(request.ID, codeInvalidRequest, "compression already negotiated")) && c.flush() == nil
+	}
+
+	response := Response{
+		ID: request.ID,
+		Result: struct {
+			Compression string   `json:"compression"`
+			Supported   []string `json:"supportedCompression"`
+		}{
+			Compression: chosen,
+			Supported:   supportedCompression,
+		},
+	}
+	if !c.writeResponse(response) {
+		return false
+	}
+	if chosen == "none" {
+		return true
+	}
+
+	zw := gzip.NewWriter(c.conn)
+	c.compressor = zw
+	c.encoder = json.NewEncoder(zw)
+	c.flush = zw.Flush
+
+	// The decoder may already hold bytes that followed the hello frame;
+	// past the newline that ends the frame, they are the start of the
+	// compressed stream.
+	in := bufio.NewReader(io.MultiReader(c.decoder.Buffered(), c.conn))
+	if err := skipSpace(in); err != nil {
+		log.Println("Failed to start decompression:", err)
+		return false
+	}
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		log.Println("Failed to start decompression:", err)
+		return false
+	}
+	c.limit = newMessageLimit(zr, c.server.maxMessageBytes)
+	c.decoder = json.NewDecoder(c.limit)
+	return true
+}
+
+func skipSpace(r *bufio.Reader) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return r.UnreadByte()
+		}
+	}
+}
+
+func chooseCompression(offered []interface{}) string {
+	for _, name := range offered {
+		for _, supported := range supportedCompression {
+			if name == supported {
+				return supported
+			}
+		}
+	}
+	return "none"
+}
+
+// closeCompression ends the compressed stream, if any, so the client
+// sees a complete gzip trailer before the connection closes.
+func (c *connection) closeCompression() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.compressor != nil {
+		c.compressor.Close()
+	}
+}
@@ -0,0 +1,59 @@
+package lambda
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestHelloCompression(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+	defer client.Close()
+
+	if err := json.NewEncoder(client).Encode(Request{ID: 1, Method: "hello", Params: map[string]interface{}{"compression": []interface{}{"zstd", "gzip"}}}); err != nil {
+		t.Fatal(err)
+	}
+	decoder := json.NewDecoder(client)
+	var hello struct {
+		Result struct {
+			Compression string `json:"compression"`
+		} `json:"result"`
+	}
+	if err := decoder.Decode(&hello); err != nil {
+		t.Fatal(err)
+	}
+	if hello.Result.Compression != "gzip" {
+		t.Fatalf("hello: got compression %q, want gzip", hello.Result.Compression)
+	}
+
+	// Both directions are gzip streams from here on.
+	zw := gzip.NewWriter(client)
+	go func() {
+		json.NewEncoder(zw).Encode(Request{ID: 2, Method: "evaluate", Params: map[string]interface{}{"expression": `(\x.x) a`}})
+		zw.Flush()
+	}()
+	in := bufio.NewReader(io.MultiReader(decoder.Buffered(), client))
+	if err := skipSpace(in); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evaluated struct {
+		Result struct {
+			Expression string `json:"expression"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(zr).Decode(&evaluated); err != nil {
+		t.Fatal(err)
+	}
+	if evaluated.Result.Expression != "a" {
+		t.Errorf("evaluate over gzip: got %q, want a", evaluated.Result.Expression)
+	}
+}
@@ -0,0 +1,88 @@
+package lambda
+
+import (
+	"errors"
+)
+
+const (
+	defaultConfluenceRuns  = 8
+	maxConfluenceRuns      = 64
+	defaultConfluenceSteps = 10000
+)
+
+type confluenceRun struct {
+	Steps int `json:"steps"`
+
+	// NormalForm is empty when the run hit the step limit.
+	NormalForm string `json:"normalForm,omitempty"`
+}
+
+type confluenceResult struct {
+	Seed int64           `json:"seed"`
+	Runs []confluenceRun `json:"runs"`
+
+	// Agree is false only when two runs reached normal forms that are
+	// not alpha-equivalent, which the Church-Rosser theorem rules out:
+	// it means the evaluator is broken.
+	Agree bool `json:"agree"`
+}
+
+// confluence reduces an expression several times, contracting a
+// randomly chosen redex at every step, and checks that all runs that
+// reach a normal form reach the same one.
+func (c *connection) confluence(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	source, ok := params["expression"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid expression parameter")
+	}
+	runs, present, err := positiveInt(params, "runs")
+	if err != nil || runs > maxConfluenceRuns {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid runs parameter")
+	}
+	if !present {
+		runs = defaultConfluenceRuns
+	}
+	maxSteps, present, err := positiveInt(params, "maxSteps")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if !present {
+		maxSteps = defaultConfluenceSteps
+	}
+	seed := seedParam(params)
+
+	expr, err := parseLambdaExpression(source)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	ctx, cancel := c.evaluationContext(request, c.server.maxTimeout)
+	defer cancel()
+
+	random := randomOrder{}.withSeed(seed)
+	result := confluenceResult{Seed: seed, Agree: true}
+	var first expression
+	for i := 0; i < runs; i++ {
+		normalForm, steps, err := reduce(ctx, random, expr, maxSteps, nil)
+		if err != nil && !errors.Is(err, errStepLimit) {
+			return errorResponse(request.ID, codeTimeout, "confluence check timed out")
+		}
+
+		run := confluenceRun{Steps: steps}
+		if err == nil {
+			run.NormalForm = normalForm.String()
+			if first == nil {
+				first = normalForm
+			} else if !alphaEquivalent(first, normalForm) {
+				result.Agree = false
+			}
+		}
+		result.Runs = append(result.Runs, run)
+	}
+
+	return Response{ID: request.ID, Result: result}
+}
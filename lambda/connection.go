@@ -0,0 +1,361 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/rpc"
+)
+
+// connection is the per-client state of the protocol loop.
+type connection struct {
+	server  *Server
+	conn    net.Conn
+	decoder *json.Decoder
+	limit   *messageLimit
+
+	// id tells the connection apart in logs and, on request, in
+	// response meta.
+	id   string
+	peer peerInfo
+
+	// Evaluations finish on pool workers, possibly out of order, so
+	// writes are serialized and the connection stays open until every
+	// queued request has been answered.
+	writeMu    sync.Mutex
+	encoder    *json.Encoder
+	flush      func() error
+	compressor io.Closer
+	inFlight   sync.WaitGroup
+
+	// notifications counts the notifications sent, under writeMu.
+	notifications uint64
+
+	// tenant is who the client authenticated as; "" until then.
+	tenantMu sync.Mutex
+	tenant   string
+
+	// pending holds the IDs of the requests not answered yet.
+	pending rpc.IDSet
+
+	// Remainders of chunked results, keyed by continuation token.
+	chunksMu sync.Mutex
+	chunks   map[string]pendingChunk
+
+	historyMu    sync.Mutex
+	history      []historyEntry
+	historyCount int
+
+	// settings holds the defaults set with configure, by method; those
+	// for every method are under "".
+	settingsMu sync.Mutex
+	settings   map[string]map[string]interface{}
+
+	debugMu       sync.Mutex
+	debugSessions map[string]*debugSession
+	debugCount    int
+}
+
+// ServeConn speaks the protocol on conn until the client goes away.
+// Expensive methods run on the worker pool and may be answered out of
+// order.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	limit := newMessageLimit(conn, s.maxMessageBytes)
+	c := &connection{
+		server:  s,
+		conn:    conn,
+		decoder: json.NewDecoder(limit),
+		limit:   limit,
+		encoder: json.NewEncoder(conn),
+		flush:   func() error { return nil },
+		id:      newConnectionID(),
+		peer:    newPeerInfo(conn),
+	}
+	c.logf("Client connected from %s", c.peer)
+	defer c.closeCompression()
+	defer c.inFlight.Wait()
+
+	s.connsMu.Lock()
+	s.conns[c] = struct{}{}
+	s.connsMu.Unlock()
+	defer func() {
+		s.connsMu.Lock()
+		delete(s.conns, c)
+		s.connsMu.Unlock()
+	}()
+
+	// ctx is done once the client goes away, abandoning the
+	// evaluations still running for it.
+	ctx, abandon := context.WithCancel(rpc.WithSession(context.Background()))
+	rpc.SessionFrom(ctx).Load(s, func() interface{} { return c })
+	if s.spans != nil {
+		span := newSpan("connection", spanKindServer, nil)
+		ctx = withSpan(ctx, span)
+		defer func() {
+			// End the connection span after those of its requests.
+			c.inFlight.Wait()
+			s.spans.export(span)
+		}()
+	}
+
+	// Deferred after the waits for requests in flight, so that it runs
+	// first: once the client is gone, nobody reads their answers.
+	defer abandon()
+
+	for {
+		request, problem, err := c.read()
+
+		if err != nil {
+			if err == io.EOF {
+				c.logf("Client closed the connection")
+				return
+			}
+
+			c.logf("Failed to decode request: %v", err)
+			return
+		}
+
+		if problem != nil {
+			id := request.ID
+			if !rpc.ValidID(id) {
+				id = nil
+			}
+			if !c.reply(errorResponse(id, codeInvalidRequest, "Invalid request: "+problem.Error())) {
+				return
+			}
+			continue
+		}
+		if !rpc.ValidID(request.ID) {
+			if !c.reply(errorResponse(nil, codeInvalidRequest, "Invalid id: must be a string, number or null")) {
+				return
+			}
+			continue
+		}
+		if !c.pending.Claim(request.ID) {
+			if !c.reply(errorResponse(request.ID, codeInvalidRequest, fmt.Sprintf("Duplicate id %v: a request with it is still being answered", request.ID))) {
+				return
+			}
+			continue
+		}
+
+		switch request.Method {
+		case "evaluate", "confluence", "optimal", "diffTrace", "compare", "minimize", "reduceCombinators", "explicitSubstitution", "cbpv", "bohmTree", "levyLongoTree", "solvable",
+			"partialEval", "analyzeStrictness", "debugContinue", "debugStepInto", "debugStepOver":
+			if !c.submit(ctx, request) {
+				return
+			}
+
+		case "hello":
+			c.pending.Release(request.ID)
+			if !c.hello(request) {
+				return
+			}
+
+		default:
+			// Count the request as active until it is answered, so
+			// that a shutdown it causes waits for the reply.
+			s.active.Add(1)
+			response := s.ServeRPC(ctx, request)
+			c.pending.Release(request.ID)
+			ok := c.reply(response)
+			s.active.Done()
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// read decodes the next request. Under strict mode, it also returns
+// what makes the request invalid JSON-RPC 2.0, if anything; request
+// then holds as much as could be decoded.
+func (c *connection) read() (request Request, problem error, err error) {
+	c.limit.reset()
+	if !c.server.strict {
+		err = c.decoder.Decode(&request)
+		return request, nil, err
+	}
+	var raw json.RawMessage
+	if err := c.decoder.Decode(&raw); err != nil {
+		return request, nil, err
+	}
+	problem = rpc.CheckStrict(raw)
+	if err := json.Unmarshal(raw, &request); err != nil && problem == nil {
+		problem = err
+	}
+	return request, problem, nil
+}
+
+// evaluationContext returns the context of an evaluation for request,
+// done after timeout or with the context request is served in.
+func (c *connection) evaluationContext(request Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(request.Context(), timeout)
+}
+
+// resolve looks up a reference used in an expression of this session.
+func (c *connection) resolve(reference string) (expression, bool) {
+	if strings.HasPrefix(reference, "$") {
+		index, err := strconv.Atoi(reference[1:])
+		if err != nil {
+			return nil, false
+		}
+		entry, ok := c.recallEntry(index)
+		return entry.term, ok
+	}
+	if strings.HasPrefix(reference, "@") {
+		return c.server.handles.get(c.tenantName(), reference)
+	}
+	if strings.HasPrefix(reference, "#") {
+		return c.server.contents.get(reference)
+	}
+	return nil, false
+}
+
+// submit queues an expensive request on the worker pool at the
+// priority it asks for, to be served in ctx; the response is written
+// when it finishes. It reports whether the connection is still usable.
+func (c *connection) submit(ctx context.Context, request Request) bool {
+	priority, err := requestPriority(request.Params)
+	if err != nil {
+		c.pending.Release(request.ID)
+		return c.reply(invalidParams(request.ID, err))
+	}
+
+	s := c.server
+	tenant := c.tenantName()
+	if s.quota.exceeded(tenant) {
+		c.pending.Release(request.ID)
+		return c.reply(errorResponse(request.ID, codeLimitExceeded, "quota exceeded; see the usage method"))
+	}
+
+	// Steps are charged as they are taken rather than read off the
+	// response, which has none when the evaluation fails, and the
+	// request is stopped once they use up the quota.
+	ctx, cancel := context.WithCancel(ctx)
+	meter := &stepMeter{quota: s.quota, tenant: tenant, cancel: cancel}
+	ctx = withStepMeter(ctx, meter)
+
+	c.inFlight.Add(1)
+	s.active.Add(1)
+	s.pool.submit(priority, func(queueWait time.Duration) {
+		defer s.active.Done()
+		defer c.inFlight.Done()
+		defer cancel()
+
+		// The evaluation keeps to one thread, so that the thread's CPU
+		// time is the evaluation's whatever else runs concurrently.
+		runtime.LockOSThread()
+		start := time.Now()
+		startCPU, measured := threadCPUTime()
+		response := recoverResponse(request, func() Response { return s.ServeRPC(ctx, request) })
+		endCPU, _ := threadCPUTime()
+		spent, cpu := time.Since(start), endCPU-startCPU
+		runtime.UnlockOSThread()
+
+		s.quota.record(tenant, 0, spent, cpu)
+		if meter.quotaSpent() && response.Error != nil {
+			response = errorResponse(request.ID, codeLimitExceeded, fmt.Sprintf("quota exceeded after %d steps; see the usage method", atomic.LoadInt64(&meter.steps)))
+		}
+		if response.Meta == nil {
+			response.Meta = map[string]interface{}{}
+		}
+		response.Meta["queueWaitMs"] = float64(queueWait) / float64(time.Millisecond)
+		if measured {
+			response.Meta["cpuMs"] = milliseconds(cpu)
+			atomic.AddInt64(&s.cpuTime, int64(cpu))
+		}
+		c.pending.Release(request.ID)
+
+		if !c.reply(response) {
+			c.conn.Close()
+		}
+	})
+	return true
+}
+
+// recoverResponse calls run, turning a panic into an internal error
+// response so that one bad input cannot take the server down.
+func recoverResponse(request Request, run func() Response) (response Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Recovered from panic in", request.Method+":", r)
+			response = errorResponse(request.ID, codeInternalError, "internal error")
+		}
+	}()
+	return run()
+}
+
+// reply writes response and reports whether the connection is still
+// usable.
+func (c *connection) reply(response Response) bool {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.server.strict {
+		response.JSONRPC = "2.0"
+	}
+	if !c.writeResponse(response) {
+		return false
+	}
+	if err := c.flush(); err != nil {
+		c.logf("Failed to flush response: %v", err)
+		return false
+	}
+	return true
+}
+
+// notify sends a notification on the connection, about the request
+// with requestID unless it is nil, reporting whether the connection is
+// still usable.
+func (c *connection) notify(requestID interface{}, method string, params interface{}) bool {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	// Sessions outside ServeConn have no stream to notify on.
+	if c.encoder == nil {
+		return false
+	}
+
+	c.notifications++
+	notification := rpc.Notification{Method: method, Params: params, RequestID: requestID, Seq: c.notifications}
+	if c.server.strict {
+		notification.JSONRPC = "2.0"
+	}
+	if err := c.encoder.Encode(notification); err != nil {
+		c.logf("Failed to send notification: %v", err)
+		return false
+	}
+	if err := c.flush(); err != nil {
+		c.logf("Failed to flush notification: %v", err)
+		return false
+	}
+	return true
+}
+
+// writeResponse encodes response on the connection and reports whether
+// the connection is still usable.
+func (c *connection) writeResponse(response Response) bool {
+	err := c.encoder.Encode(response)
+	if err != nil {
+		if netErr, ok := err.(*net.OpError); ok && netErr.Err.Error() == "write: broken pipe" {
+			c.logf("Client closed the connection")
+			return false
+		}
+
+		c.logf("Failed to encode response: %v", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package lambda
+
+import "fmt"
+
+// cpsVariants maps the names accepted by the cps method to Plotkin's
+// call-by-value and call-by-name transforms.
+var cpsVariants = map[string]func(expression, cpsNames) expression{
+	"cbv": cpsValue,
+	"cbn": cpsName,
+}
+
+// cpsNames are the continuation and value variables the transform
+// introduces, chosen not to clash with any name in the input.
+type cpsNames struct {
+	k, m, n variable
+}
+
+// cps returns the continuation-passing-style transform of an
+// expression. variant picks call by value (cbv, the default) or call
+// by name (cbn).
+func (c *connection) cps(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	variant := "cbv"
+	if raw, present := params["variant"]; present {
+		variant, _ = raw.(string)
+	}
+	transform, ok := cpsVariants[variant]
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid variant parameter: want cbv or cbn, got %q", variant))
+	}
+
+	used := allNames(expr)
+	fresh := func(base string) variable {
+		name := freshName(base, used)
+		used[name] = true
+		return variable{name, span{}}
+	}
+	names := cpsNames{fresh("k"), fresh("m"), fresh("n")}
+
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Expression string `json:"expression"`
+		}{
+			Expression: transform(expr, names).String(),
+		},
+	}
+}
+
+// cpsValue is Plotkin's call-by-value transform:
+//
+//	[x]   = \k.k x
+//	[\x.M] = \k.k (\x.[M])
+//	[M N] = \k.[M] (\m.[N] (\n.m n k))
+func cpsValue(expr expression, v cpsNames) expression {
+	switch e := expr.(type) {
+	case *variable:
+		return lambda(v.k, apply(ref(v.k), e))
+	case *abstraction:
+		return lambda(v.k, apply(ref(v.k), lambda(e.parameter, cpsValue(e.body, v))))
+	case *application:
+		return lambda(v.k, apply(cpsValue(e.left, v),
+			lambda(v.m, apply(cpsValue(e.right, v),
+				lambda(v.n, apply(apply(ref(v.m), ref(v.n)), ref(v.k)))))))
+	}
+	panic("Invalid expression")
+}
+
+// cpsName is Plotkin's call-by-name transform:
+//
+//	[x]   = x
+//	[\x.M] = \k.k (\x.[M])
+//	[M N] = \k.[M] (\m.m [N] k)
+func cpsName(expr expression, v cpsNames) expression {
+	switch e := expr.(type) {
+	case *variable:
+		return e
+	case *abstraction:
+		return lambda(v.k, apply(ref(v.k), lambda(e.parameter, cpsName(e.body, v))))
+	case *application:
+		return lambda(v.k, apply(cpsName(e.left, v),
+			lambda(v.m, apply(apply(ref(v.m), cpsName(e.right, v)), ref(v.k)))))
+	}
+	panic("Invalid expression")
+}
+
+func lambda(parameter variable, body expression) expression {
+	return &abstraction{parameter, body, span{}}
+}
+
+func apply(left, right expression) expression {
+	return &application{left, right, span{}}
+}
+
+func ref(v variable) expression {
+	return &variable{v.name, span{}}
+}
+
+// allNames collects every variable name in expr, bound or free.
+func allNames(expr expression) map[string]bool {
+	names := map[string]bool{}
+	var walk func(expression)
+	walk = func(expr expression) {
+		switch e := expr.(type) {
+		case *variable:
+			names[e.name] = true
+		case *abstraction:
+			names[e.parameter.name] = true
+			walk(e.body)
+		case *application:
+			walk(e.left)
+			walk(e.right)
+		}
+	}
+	walk(expr)
+	return names
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package lambda
+
+import "time"
+
+// threadCPUTime reports the CPU time of the calling thread, which is
+// only measured on Linux.
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
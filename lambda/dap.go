@@ -0,0 +1,377 @@
+package lambda
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dapThread is the one thread a debug adapter session reports: the
+// reduction of the launched term.
+const dapThread = 1
+
+// dapMessage covers the requests, responses and events of the Debug
+// Adapter Protocol.
+type dapMessage struct {
+	Seq     int    `json:"seq"`
+	Type    string `json:"type"`
+	Command string `json:"command,omitempty"`
+	Event   string `json:"event,omitempty"`
+
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+
+	RequestSeq int         `json:"request_seq,omitempty"`
+	Success    *bool       `json:"success,omitempty"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapLaunchArguments struct {
+	// Program is a file holding the term; Expression gives it inline.
+	Program     string `json:"program"`
+	Expression  string `json:"expression"`
+	Strategy    string `json:"strategy"`
+	Seed        *int64 `json:"seed"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+// dapAdapter is the state of one debug adapter session, which drives a
+// single debugSession.
+type dapAdapter struct {
+	server *Server
+	reader *textproto.Reader
+	writer io.Writer
+
+	writeMu sync.Mutex
+	seq     int
+
+	source      string
+	program     string
+	stopOnEntry bool
+	breakpoints []breakpoint
+	debug       *debugSession
+	last        debugPause
+}
+
+// ServeDAP speaks the Debug Adapter Protocol on r and w, typically the
+// standard streams of an adapter launched by an editor, so that
+// reduction can be driven from its debugging UI. Function breakpoints
+// are redex patterns as taken by debugSetBreakpoints; stepping over a
+// redex reduces its contractum as well.
+func (s *Server) ServeDAP(r io.Reader, w io.Writer) error {
+	a := &dapAdapter{
+		server: s,
+		reader: textproto.NewReader(bufio.NewReader(r)),
+		writer: w,
+	}
+	for {
+		request, err := a.read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if done := a.handle(request); done {
+			return nil
+		}
+	}
+}
+
+func (a *dapAdapter) read() (dapMessage, error) {
+	var message dapMessage
+	body, err := readFramed(a.reader, a.server.maxMessageBytes)
+	if err != nil {
+		return message, err
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return message, fmt.Errorf("decoding message: %w", err)
+	}
+	return message, nil
+}
+
+func (a *dapAdapter) send(message dapMessage) {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	a.seq++
+	message.Seq = a.seq
+	body, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	writeFramed(a.writer, body)
+}
+
+func (a *dapAdapter) respond(request dapMessage, body interface{}, err error) {
+	success := err == nil
+	response := dapMessage{
+		Type:       "response",
+		Command:    request.Command,
+		RequestSeq: request.Seq,
+		Success:    &success,
+		Body:       body,
+	}
+	if err != nil {
+		response.Message = err.Error()
+	}
+	a.send(response)
+}
+
+func (a *dapAdapter) event(event string, body interface{}) {
+	a.send(dapMessage{Type: "event", Event: event, Body: body})
+}
+
+// handle answers a request, reporting whether the session is over.
+func (a *dapAdapter) handle(request dapMessage) bool {
+	switch request.Command {
+	case "initialize":
+		a.respond(request, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsTerminateRequest":         true,
+		}, nil)
+		a.event("initialized", nil)
+	case "launch":
+		a.respond(request, nil, a.launch(request.Arguments))
+	case "setBreakpoints":
+		// Terms have no lines to break on; report every source
+		// breakpoint as unverified.
+		var arguments struct {
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		json.Unmarshal(request.Arguments, &arguments)
+		breakpoints := []map[string]interface{}{}
+		for _, b := range arguments.Breakpoints {
+			breakpoints = append(breakpoints, map[string]interface{}{
+				"verified": false,
+				"line":     b.Line,
+				"message":  "use function breakpoints with a redex pattern",
+			})
+		}
+		a.respond(request, map[string]interface{}{"breakpoints": breakpoints}, nil)
+	case "setFunctionBreakpoints":
+		body, err := a.setFunctionBreakpoints(request.Arguments)
+		a.respond(request, body, err)
+	case "configurationDone":
+		a.respond(request, nil, nil)
+		if a.debug == nil {
+			break
+		}
+		if a.stopOnEntry {
+			a.debug.mu.Lock()
+			a.stopped(a.debug.pause("start", 0))
+			a.debug.mu.Unlock()
+		} else {
+			a.resume(request.Command)
+		}
+	case "threads":
+		a.respond(request, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": dapThread, "name": "reduction"}},
+		}, nil)
+	case "stackTrace":
+		a.respond(request, a.stackTrace(), nil)
+	case "scopes":
+		a.respond(request, map[string]interface{}{
+			"scopes": []map[string]interface{}{{"name": "Reduction", "variablesReference": 1, "expensive": false}},
+		}, nil)
+	case "variables":
+		a.respond(request, a.variables(), nil)
+	case "continue":
+		a.respond(request, map[string]interface{}{"allThreadsContinued": true}, nil)
+		a.resume(request.Command)
+	case "next", "stepIn", "stepOut":
+		a.respond(request, nil, nil)
+		a.resume(request.Command)
+	case "pause":
+		// Runs are bounded by the step limit and timeout, after which
+		// they stop by themselves.
+		a.respond(request, nil, nil)
+	case "disconnect", "terminate":
+		a.respond(request, nil, nil)
+		return true
+	default:
+		a.respond(request, nil, fmt.Errorf("unsupported request %q", request.Command))
+	}
+	return false
+}
+
+func (a *dapAdapter) launch(raw json.RawMessage) error {
+	var arguments dapLaunchArguments
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return fmt.Errorf("Invalid launch arguments: %v", err)
+	}
+	a.source = arguments.Expression
+	if arguments.Program != "" {
+		source, err := os.ReadFile(arguments.Program)
+		if err != nil {
+			return fmt.Errorf("Failed to read program: %v", err)
+		}
+		a.source, a.program = string(source), arguments.Program
+	}
+	expr, err := parseLambdaExpression(a.source)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{"strategy": arguments.Strategy}
+	if arguments.Strategy == "" {
+		delete(params, "strategy")
+	}
+	if arguments.Seed != nil {
+		params["seed"] = float64(*arguments.Seed)
+	}
+	strategy, err := strategyParam(params)
+	if err != nil {
+		return err
+	}
+
+	a.stopOnEntry = arguments.StopOnEntry
+	a.debug = &debugSession{id: "d1", strategy: strategy, term: expr, breakpoints: a.breakpoints}
+	a.debug.advance()
+	return nil
+}
+
+func (a *dapAdapter) setFunctionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		Breakpoints []struct {
+			Name string `json:"name"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, fmt.Errorf("Invalid breakpoints: %v", err)
+	}
+
+	var breakpoints []breakpoint
+	results := []map[string]interface{}{}
+	for i, b := range arguments.Breakpoints {
+		pattern, err := parseLambdaExpression(b.Name)
+		result := map[string]interface{}{"id": i + 1, "verified": err == nil}
+		if err != nil {
+			result["message"] = err.Error()
+		} else {
+			breakpoints = append(breakpoints, breakpoint{ID: i + 1, Pattern: b.Name, pattern: pattern})
+		}
+		results = append(results, result)
+	}
+	// Editors may configure breakpoints before or after launching.
+	a.breakpoints = breakpoints
+	if a.debug != nil {
+		a.debug.mu.Lock()
+		a.debug.breakpoints = breakpoints
+		a.debug.mu.Unlock()
+	}
+	return map[string]interface{}{"breakpoints": results}, nil
+}
+
+// resume runs the session for a stepping command and reports where it
+// stopped.
+func (a *dapAdapter) resume(command string) {
+	if a.debug == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.server.maxTimeout)
+	defer cancel()
+
+	d := a.debug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var pause debugPause
+	switch command {
+	case "stepIn":
+		pause = d.run(ctx, a.server.maxSteps, func(path) bool { return false })
+	case "next":
+		over := d.at
+		pause = d.run(ctx, a.server.maxSteps, func(at path) bool { return hasPrefix(at, over) })
+	case "stepOut":
+		// Finish the redex the pending one lies in.
+		out := d.at
+		if len(out) > 0 {
+			out = out[:len(out)-1]
+		}
+		pause = d.run(ctx, a.server.maxSteps, func(at path) bool { return hasPrefix(at, out) })
+	default:
+		pause = d.run(ctx, a.server.maxSteps, func(path) bool { return true })
+	}
+	a.stopped(pause)
+}
+
+func (a *dapAdapter) stopped(pause debugPause) {
+	a.last = pause
+	if pause.Reason == "normalForm" {
+		a.event("output", map[string]interface{}{
+			"category": "stdout",
+			"output":   fmt.Sprintf("%s\t(%d steps)\n", pause.Term, pause.Step),
+		})
+		a.event("terminated", nil)
+		return
+	}
+
+	reasons := map[string]string{"start": "entry", "step": "step", "breakpoint": "function breakpoint", "timeout": "pause"}
+	body := map[string]interface{}{
+		"reason":            reasons[pause.Reason],
+		"threadId":          dapThread,
+		"allThreadsStopped": true,
+	}
+	if pause.Reason == "breakpoint" {
+		body["hitBreakpointIds"] = []int{pause.Breakpoint}
+	}
+	if pause.Reason == "timeout" {
+		body["description"] = "Paused at the step limit or timeout"
+	}
+	a.event("stopped", body)
+}
+
+func (a *dapAdapter) stackTrace() interface{} {
+	frames := []map[string]interface{}{}
+	if a.debug != nil && a.last.Redex != nil {
+		a.debug.mu.Lock()
+		redex, _ := subtermAt(a.debug.term, a.debug.at)
+		a.debug.mu.Unlock()
+
+		frame := map[string]interface{}{
+			"id":     1,
+			"name":   redex.String(),
+			"line":   0,
+			"column": 0,
+		}
+		if a.program != "" {
+			frame["source"] = map[string]interface{}{"path": a.program}
+			if s := a.last.Redex.Span; s != nil && s.End <= len(a.source) {
+				frame["line"], frame["column"] = lineColumn(a.source, s.Start)
+				frame["endLine"], frame["endColumn"] = lineColumn(a.source, s.End)
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+func (a *dapAdapter) variables() interface{} {
+	pause := a.last
+	variables := []map[string]interface{}{
+		{"name": "term", "value": pause.Term, "variablesReference": 0},
+		{"name": "step", "value": strconv.Itoa(pause.Step), "variablesReference": 0},
+	}
+	if len(pause.Scope) > 0 {
+		variables = append(variables, map[string]interface{}{
+			"name": "binders", "value": strings.Join(pause.Scope, " "), "variablesReference": 0,
+		})
+	}
+	return map[string]interface{}{"variables": variables}
+}
+
+// lineColumn converts a byte offset of source to the 1-based line and
+// column DAP clients count in.
+func lineColumn(source string, offset int) (int, int) {
+	before := source[:offset]
+	line := strings.Count(before, "\n") + 1
+	return line, offset - strings.LastIndex(before, "\n")
+}
@@ -0,0 +1,357 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// maxDebugSessions bounds the debug sessions one connection may keep
+// open.
+const maxDebugSessions = 16
+
+// A debugSession steps through the reduction of one term. It is always
+// paused in front of the redex the strategy contracts next.
+type debugSession struct {
+	mu          sync.Mutex
+	id          string
+	strategy    strategy
+	term        expression
+	steps       int
+	breakpoints []breakpoint
+
+	// next is term with the pending redex at path at contracted; done
+	// is set once there is none.
+	next expression
+	at   path
+	done bool
+}
+
+// A breakpoint pauses reduction in front of a redex matching pattern,
+// whose free variables match any subterm, `_` anything without
+// binding it; or in front of any application of the term named by a
+// reference such as $2.
+type breakpoint struct {
+	ID      int    `json:"id"`
+	Pattern string `json:"pattern,omitempty"`
+	Name    string `json:"name,omitempty"`
+
+	pattern  expression
+	function expression
+}
+
+type debugPause struct {
+	Session string `json:"session"`
+
+	// Reason is start, step, breakpoint, normalForm or timeout.
+	Reason     string `json:"reason"`
+	Breakpoint int    `json:"breakpoint,omitempty"`
+
+	Step  int            `json:"step"`
+	Term  string         `json:"term"`
+	Redex *redexLocation `json:"redex,omitempty"`
+
+	// Scope lists the binders enclosing the pending redex, outermost
+	// first.
+	Scope []string `json:"scope,omitempty"`
+}
+
+func (d *debugSession) advance() {
+	d.next, d.at, d.done = d.strategy.step(d.term)
+	d.done = !d.done
+}
+
+func (d *debugSession) pause(reason string, breakpoint int) debugPause {
+	pause := debugPause{
+		Session:    d.id,
+		Reason:     reason,
+		Breakpoint: breakpoint,
+		Step:       d.steps,
+		Term:       d.term.String(),
+	}
+	if !d.done {
+		pause.Redex = locateRedex(d.term, d.at)
+		pause.Scope = scopeAt(d.term, d.at)
+	}
+	return pause
+}
+
+// contract performs the pending reduction step.
+func (d *debugSession) contract() {
+	d.term = d.next
+	d.steps++
+	d.advance()
+}
+
+// hit returns the breakpoint the pending redex matches, or 0.
+func (d *debugSession) hit() int {
+	if d.done {
+		return 0
+	}
+	redex, ok := subtermAt(d.term, d.at)
+	if !ok {
+		return 0
+	}
+	app, _ := redex.(*application)
+	for _, b := range d.breakpoints {
+		if b.pattern != nil && matchPattern(b.pattern, redex, nil, nil, map[string]expression{}) {
+			return b.ID
+		}
+		if b.function != nil && app != nil && alphaEquivalent(b.function, app.left) {
+			return b.ID
+		}
+	}
+	return 0
+}
+
+// run contracts redexes while within reports true for the pending one,
+// stopping early at a breakpoint or when ctx is done.
+func (d *debugSession) run(ctx context.Context, maxSteps int, within func(path) bool) debugPause {
+	taken := 0
+	defer func() { meterSteps(ctx, taken) }()
+	for ; ; taken++ {
+		if d.done {
+			return d.pause("normalForm", 0)
+		}
+		if taken > 0 {
+			if id := d.hit(); id != 0 {
+				return d.pause("breakpoint", id)
+			}
+			if !within(d.at) {
+				return d.pause("step", 0)
+			}
+		}
+		if ctx.Err() != nil || maxSteps > 0 && taken == maxSteps {
+			return d.pause("timeout", 0)
+		}
+		d.contract()
+	}
+}
+
+// scopeAt lists the binders above p in expr, outermost first.
+func scopeAt(expr expression, p path) []string {
+	var scope []string
+	for _, child := range p {
+		switch e := expr.(type) {
+		case *abstraction:
+			scope = append(scope, e.parameter.name)
+			expr = e.body
+		case *application:
+			if child == 0 {
+				expr = e.left
+			} else {
+				expr = e.right
+			}
+		}
+	}
+	return scope
+}
+
+// matchPattern reports whether term is an instance of pattern, whose
+// free variables are placeholders matching, consistently, any subterm
+// that does not refer to binders inside the match.
+func matchPattern(pattern, term expression, boundP, boundT []string, bindings map[string]expression) bool {
+	switch p := pattern.(type) {
+	case *variable:
+		if depth := bindingDepth(boundP, p.name); depth >= 0 {
+			t, ok := term.(*variable)
+			return ok && bindingDepth(boundT, t.name) == depth
+		}
+		for name := range freeVariables(term) {
+			if bindingDepth(boundT, name) >= 0 {
+				return false
+			}
+		}
+		if p.name == "_" {
+			return true
+		}
+		if bound, ok := bindings[p.name]; ok {
+			return alphaEquivalent(bound, term)
+		}
+		bindings[p.name] = term
+		return true
+	case *abstraction:
+		t, ok := term.(*abstraction)
+		return ok && matchPattern(p.body, t.body, append(boundP, p.parameter.name), append(boundT, t.parameter.name), bindings)
+	case *application:
+		t, ok := term.(*application)
+		return ok && matchPattern(p.left, t.left, boundP, boundT, bindings) && matchPattern(p.right, t.right, boundP, boundT, bindings)
+	}
+	return false
+}
+
+func (c *connection) debugSession(params map[string]interface{}) (*debugSession, error) {
+	id, _ := params["session"].(string)
+	c.debugMu.Lock()
+	defer c.debugMu.Unlock()
+	d, ok := c.debugSessions[id]
+	if !ok {
+		return nil, fmt.Errorf("Invalid session parameter: no debug session %q", id)
+	}
+	return d, nil
+}
+
+// debugStart opens a debug session paused before the first step of
+// reducing an expression.
+func (c *connection) debugStart(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	strategy, err := strategyParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	c.debugMu.Lock()
+	if len(c.debugSessions) >= maxDebugSessions {
+		c.debugMu.Unlock()
+		return errorResponse(request.ID, codeLimitExceeded, "too many debug sessions; stop one with debugStop")
+	}
+	if c.debugSessions == nil {
+		c.debugSessions = map[string]*debugSession{}
+	}
+	c.debugCount++
+	d := &debugSession{id: "d" + strconv.Itoa(c.debugCount), strategy: strategy, term: expr}
+	c.debugSessions[d.id] = d
+	c.debugMu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.advance()
+	return Response{ID: request.ID, Result: d.pause("start", 0)}
+}
+
+// debugSetBreakpoints replaces the breakpoints of a session.
+func (c *connection) debugSetBreakpoints(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	d, err := c.debugSession(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	raw, ok := params["breakpoints"].([]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid breakpoints parameter")
+	}
+
+	breakpoints := []breakpoint{}
+	for i, item := range raw {
+		fields, _ := item.(map[string]interface{})
+		b := breakpoint{ID: i + 1}
+		b.Pattern, _ = fields["pattern"].(string)
+		b.Name, _ = fields["name"].(string)
+		switch {
+		case b.Pattern != "" && b.Name == "":
+			b.pattern, err = parseLambdaExpression(b.Pattern)
+		case b.Name != "" && b.Pattern == "":
+			var found bool
+			b.function, found = c.resolve(b.Name)
+			if !found {
+				err = fmt.Errorf("unknown reference %s", b.Name)
+			}
+		default:
+			err = errors.New("want either a pattern or a name")
+		}
+		if err != nil {
+			return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid breakpoint %d: %v", i+1, err))
+		}
+		breakpoints = append(breakpoints, b)
+	}
+
+	d.mu.Lock()
+	d.breakpoints = breakpoints
+	d.mu.Unlock()
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Breakpoints []breakpoint `json:"breakpoints"`
+		}{
+			Breakpoints: breakpoints,
+		},
+	}
+}
+
+// debugResume implements the commands that move a session forward:
+// stepInto contracts the pending redex, stepOver also reduces its
+// contractum for as long as the pending redex lies inside it, and
+// continue runs until a breakpoint or the normal form. Each is bounded
+// by the usual timeoutMs and maxSteps.
+func (s *Server) debugResume(c *connection, request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	d, err := c.debugSession(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := s.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := s.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var pause debugPause
+	switch request.Method {
+	case "debugStepInto":
+		pause = d.run(ctx, maxSteps, func(path) bool { return false })
+	case "debugStepOver":
+		over := d.at
+		pause = d.run(ctx, maxSteps, func(at path) bool { return hasPrefix(at, over) })
+	default:
+		pause = d.run(ctx, maxSteps, func(path) bool { return true })
+	}
+	return Response{ID: request.ID, Result: pause}
+}
+
+// debugStop closes a debug session.
+func (c *connection) debugStop(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	d, err := c.debugSession(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	c.debugMu.Lock()
+	delete(c.debugSessions, d.id)
+	c.debugMu.Unlock()
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Stopped bool `json:"stopped"`
+		}{
+			Stopped: true,
+		},
+	}
+}
+
+func hasPrefix(p, prefix path) bool {
+	if len(p) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if p[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,276 @@
+package lambda
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// A paramSpec describes a request parameter. Type is the JSON type of
+// its value: string, integer, number, boolean, object or array.
+type paramSpec struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+}
+
+type methodSpec struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Params      []paramSpec `json:"params"`
+}
+
+// protocolSpec is the machine-readable description of the protocol
+// that the describe method answers with and client stubs are generated
+// from.
+type protocolSpec struct {
+	Framing       string       `json:"framing"`
+	Methods       []methodSpec `json:"methods"`
+	Notifications []string     `json:"notifications"`
+}
+
+// Parameters shared by many methods.
+var (
+	expressionParams = []paramSpec{{"expression", "string", true}, {"syntax", "string", false}}
+	limitParams      = []paramSpec{{"maxSteps", "integer", false}, {"timeoutMs", "number", false}}
+	strategyParams   = []paramSpec{{"strategy", "string", false}, {"seed", "integer", false}}
+	styleParams      = []paramSpec{{"format", "string", false}, {"style", "string", false}}
+	priorityParams   = []paramSpec{{"priority", "string", false}}
+	tokenParams      = []paramSpec{{"token", "string", true}}
+)
+
+func params(groups ...[]paramSpec) []paramSpec {
+	all := []paramSpec{}
+	for _, group := range groups {
+		all = append(all, group...)
+	}
+	return all
+}
+
+// spec lists the built-in methods: the evaluation methods first, then
+// term tools, session state, tenants and administration, and the
+// debugger.
+var spec = protocolSpec{
+	Framing: "One JSON object per line, in both directions. Responses carry the id of their request and may come out of order; notifications have a method and no id.",
+	Methods: []methodSpec{
+		{"hello", "Negotiates compression for the rest of the connection; only valid as the first request.", params([]paramSpec{{"compression", "array", false}})},
+		{"evaluate", "Reduces an expression, or each of a list of expressions, to normal form.", params(
+			[]paramSpec{{"expression", "string", false}, {"expressions", "array", false}, {"syntax", "string", false}},
+			limitParams, strategyParams, styleParams, priorityParams,
+			[]paramSpec{
+				{"definitions", "object", false}, {"macros", "object", false},
+				{"maxTermSize", "integer", false}, {"termSizeWarnings", "array", false},
+				{"maxResultBytes", "integer", false}, {"chunkBytes", "integer", false},
+				{"summary", "boolean", false}, {"summaryPrefixBytes", "integer", false},
+				{"handle", "boolean", false}, {"warnings", "boolean", false},
+				{"trace", "boolean", false}, {"traceFormat", "string", false}, {"traceKeep", "integer", false},
+				{"traceLimit", "integer", false}, {"traceSample", "integer", false}, {"traceFile", "boolean", false},
+				{"profile", "boolean", false}, {"typeCheck", "boolean", false},
+				{"connectionInfo", "boolean", false},
+			})},
+		{"compare", "Evaluates an expression under several strategies.", params(expressionParams, limitParams, priorityParams, []paramSpec{{"strategies", "array", false}, {"seed", "integer", false}})},
+		{"partialEval", "Reduces an expression as far as it goes without expanding the opaque names.", params(expressionParams, limitParams, []paramSpec{{"opaque", "array", true}, {"definitions", "object", false}})},
+		{"confluence", "Reduces an expression along random paths and checks that they agree.", params(expressionParams, priorityParams, []paramSpec{{"runs", "integer", false}, {"maxSteps", "integer", false}, {"seed", "integer", false}})},
+		{"optimal", "Reduces an expression by optimal (Lamping) graph reduction.", params(expressionParams, priorityParams)},
+		{"diffTrace", "Reduces two expressions in lockstep until they differ.", params([]paramSpec{{"left", "string", true}, {"right", "string", true}, {"syntax", "string", false}}, limitParams, []paramSpec{{"strategy", "string", false}}, priorityParams)},
+		{"minimize", "Searches for a smaller equivalent term by beta, eta and known combinator identities.", params(expressionParams, []paramSpec{{"timeoutMs", "number", false}, {"maxCandidates", "integer", false}}, priorityParams)},
+		{"reduceCombinators", "Reduces a combinator term such as S K K x by the combinator rules.", params([]paramSpec{{"expression", "string", true}}, limitParams, []paramSpec{{"toLambda", "boolean", false}}, priorityParams)},
+		{"translateCombinators", "Translates a lambda term into S, K, I, B, C and W combinators.", params(expressionParams, []paramSpec{{"basis", "string", false}})},
+		{"bohmTree", "Unfolds the Böhm tree of an expression to a depth, reducing each subterm to head normal form within maxSteps.", params(expressionParams, []paramSpec{{"depth", "integer", false}}, limitParams, priorityParams)},
+		{"levyLongoTree", "Unfolds the Lévy-Longo tree of an expression to a depth, reducing each subterm to weak head normal form within maxSteps.", params(expressionParams, []paramSpec{{"depth", "integer", false}}, limitParams, priorityParams)},
+		{"fetchTrace", "Returns a page of the steps of a trace evaluate wrote to a file.", params([]paramSpec{{"id", "string", true}, {"cursor", "integer", false}, {"limit", "integer", false}})},
+		{"solvable", "Head-reduces an expression within maxSteps to tell whether it has a head normal form, returning the head spine reached.", params(expressionParams, limitParams, priorityParams)},
+		{"cbpv", "Translates an expression into call-by-push-value, by value or by name, and runs it.", params(expressionParams, []paramSpec{{"translation", "string", false}}, limitParams, []paramSpec{{"trace", "boolean", false}}, priorityParams)},
+		{"explicitSubstitution", "Reduces an expression in the λσ calculus of explicit substitutions, tracing every rewrite.", params(expressionParams, limitParams, priorityParams)},
+		{"estimate", "Classifies how expensive evaluating an expression is likely to be.", params(expressionParams)},
+		{"analyzeStrictness", "Reports which leading parameters of a term its body demands.", params(expressionParams, limitParams)},
+		{"parse", "Parses an expression and returns it printed back.", params(expressionParams, []paramSpec{{"warnings", "boolean", false}})},
+		{"format", "Formats an expression or a .lam source.", params([]paramSpec{{"expression", "string", false}, {"source", "string", false}})},
+		{"lint", "Reports suspicious patterns in an expression.", params(expressionParams)},
+		{"checkLinear", "Checks that each bound variable is used exactly once, or at most once with affine.", params(expressionParams, []paramSpec{{"affine", "boolean", false}})},
+		{"stats", "Measures the size and shape of an expression.", params(expressionParams)},
+		{"subterm", "Returns the subterm of an expression at a path.", params(expressionParams, []paramSpec{{"path", "array", true}})},
+		{"replaceAt", "Replaces the subterm of an expression at a path.", params(expressionParams, []paramSpec{{"path", "array", true}, {"replacement", "string", true}})},
+		{"substitute", "Substitutes a term for the free occurrences of a variable.", params([]paramSpec{{"term", "string", true}, {"variable", "string", true}, {"replacement", "string", true}, {"syntax", "string", false}}, styleParams)},
+		{"diff", "Compares two expressions structurally.", params([]paramSpec{{"left", "string", true}, {"right", "string", true}, {"syntax", "string", false}})},
+		{"cps", "Converts an expression to continuation-passing style.", params(expressionParams, []paramSpec{{"variant", "string", false}})},
+		{"lift", "Lambda-lifts an expression into supercombinators.", params(expressionParams)},
+		{"codegen", "Compiles a closed expression to a Go program printing its normal form.", params(expressionParams)},
+		{"encodeTerm", "Encodes an expression in the compact binary format.", params(expressionParams)},
+		{"decodeTerm", "Decodes an expression from the compact binary format.", params([]paramSpec{{"encoding", "string", true}}, styleParams)},
+		{"put", "Stores an expression under its content hash.", params(expressionParams)},
+		{"get", "Returns the expression stored under a content hash.", params([]paramSpec{{"hash", "string", true}}, styleParams)},
+		{"listStrategies", "Describes the reduction strategies.", params()},
+		{"history", "Lists the most recent evaluations of this connection.", params([]paramSpec{{"limit", "integer", false}})},
+		{"recall", "Returns a result of this connection by index.", params([]paramSpec{{"index", "integer", true}})},
+		{"fetchResult", "Returns the next chunk of a result evaluated with chunkBytes.", params([]paramSpec{{"continuation", "string", true}, {"chunkBytes", "integer", false}})},
+		{"configure", "Sets defaults for the params of a method on this connection.", params([]paramSpec{{"method", "string", true}, {"settings", "object", true}})},
+		{"release", "Releases a handle to a kept result.", params([]paramSpec{{"handle", "string", true}})},
+		{"authenticate", "Authenticates the connection as a tenant.", params(tokenParams)},
+		{"usage", "Reports the quota usage of the connection's tenant.", params()},
+		{"listTenants", "Lists the configured tenants and those holding handles.", params(tokenParams)},
+		{"purgeTenant", "Drops every handle of a tenant.", params(tokenParams, []paramSpec{{"tenant", "string", true}})},
+		{"metrics", "Reports server metrics.", params()},
+		{"restart", "Re-executes the server without dropping its socket.", params(tokenParams)},
+		{"shutdown", "Stops the server, answering what is running first.", params(tokenParams)},
+		{"debugStart", "Starts a debugging session for an expression.", params(expressionParams, []paramSpec{{"strategy", "string", false}})},
+		{"debugSetBreakpoints", "Sets the breakpoints of a debugging session.", params([]paramSpec{{"session", "string", true}, {"breakpoints", "array", true}})},
+		{"debugContinue", "Reduces until a breakpoint or normal form.", params([]paramSpec{{"session", "string", true}}, limitParams)},
+		{"debugStepInto", "Contracts the next redex.", params([]paramSpec{{"session", "string", true}}, limitParams)},
+		{"debugStepOver", "Reduces the pending redex and its contractum.", params([]paramSpec{{"session", "string", true}}, limitParams)},
+		{"debugStop", "Ends a debugging session.", params([]paramSpec{{"session", "string", true}})},
+		{"describe", "Returns this description of the protocol and the server's capabilities.", params()},
+	},
+	Notifications: []string{"evaluate/termSize", "server/shuttingDown"},
+}
+
+// ProtocolSpec returns the description of the protocol as JSON, for
+// generating clients without a running server.
+func ProtocolSpec() []byte {
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return append(data, '\n')
+}
+
+// capabilities are what the server's configuration enables, for
+// clients to adapt to without trial and error.
+type capabilities struct {
+	ReadOnly     bool     `json:"readOnly"`
+	Strict       bool     `json:"strict"`
+	Tenants      bool     `json:"tenants"`
+	Admin        bool     `json:"admin"`
+	Optimal      bool     `json:"optimal"`
+	CBPV         bool     `json:"cbpv"`
+	Quotas       bool     `json:"quotas"`
+	Tracing      bool     `json:"tracing"`
+	TraceFiles   bool     `json:"traceFiles"`
+	Compression  []string `json:"compression"`
+	Strategies   []string `json:"strategies"`
+	Syntaxes     []string `json:"syntaxes"`
+	Styles       []string `json:"styles"`
+	MaxSteps     int      `json:"maxSteps,omitempty"`
+	MaxTimeoutMs float64  `json:"maxTimeoutMs"`
+	MaxTermSize  int      `json:"maxTermSize,omitempty"`
+}
+
+// A describedMethod is a method as describe reports it on a server.
+type describedMethod struct {
+	methodSpec
+	ParamsSchema map[string]interface{} `json:"paramsSchema"`
+
+	// Custom marks methods registered with RegisterMethod, which are
+	// described by name only, and Disabled those the server's
+	// configuration turns off.
+	Custom   bool `json:"custom,omitempty"`
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+type describeResult struct {
+	Framing       string            `json:"framing"`
+	Methods       []describedMethod `json:"methods"`
+	Notifications []string          `json:"notifications"`
+	Capabilities  capabilities      `json:"capabilities"`
+}
+
+// paramEnums are the values of the params that take a name from a
+// fixed set.
+var paramEnums = map[string]func() []string{
+	"strategy":    func() []string { return sortedKeys(strategies) },
+	"syntax":      func() []string { return sortedKeys(syntaxes) },
+	"format":      func() []string { return sortedKeys(printStyles) },
+	"style":       func() []string { return sortedKeys(printStyles) },
+	"priority":    func() []string { return sortedKeys(priorities) },
+	"variant":     func() []string { return sortedKeys(cpsVariants) },
+	"basis":       func() []string { return sortedKeys(bases) },
+	"translation": func() []string { return sortedKeys(cbpvTranslations) },
+	"traceFormat": func() []string { return []string{"delta", "full"} },
+}
+
+// sortedKeys returns the keys of m, a map with string keys, sorted.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// paramsSchema is the JSON Schema of an object with params.
+func paramsSchema(params []paramSpec) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, param := range params {
+		property := map[string]interface{}{"type": param.Type}
+		if enum, ok := paramEnums[param.Name]; ok {
+			property["enum"] = enum()
+		}
+		properties[param.Name] = property
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+// describe answers with the protocol description, covering every
+// method registered, and the server's capabilities.
+func (s *Server) describe(request Request) Response {
+	disabled := func(name string) bool {
+		switch {
+		case s.readOnly && mutatingMethods[name]:
+			return true
+		case name == "optimal":
+			return !s.experimentalOptimal
+		case name == "cbpv":
+			return !s.experimentalCBPV
+		case name == "fetchTrace":
+			return s.traceDir == ""
+		case name == "shutdown", name == "restart", name == "listTenants", name == "purgeTenant":
+			return s.shutdownToken == ""
+		}
+		return false
+	}
+
+	result := describeResult{Framing: spec.Framing, Notifications: spec.Notifications}
+	described := map[string]bool{}
+	for _, method := range spec.Methods {
+		result.Methods = append(result.Methods, describedMethod{
+			methodSpec:   method,
+			ParamsSchema: paramsSchema(method.Params),
+			Disabled:     disabled(method.Name),
+		})
+		described[method.Name] = true
+	}
+	for _, name := range s.methods.Methods() {
+		if !described[name] {
+			result.Methods = append(result.Methods, describedMethod{
+				methodSpec:   methodSpec{Name: name, Params: []paramSpec{}},
+				ParamsSchema: paramsSchema(nil),
+				Custom:       true,
+			})
+		}
+	}
+
+	result.Capabilities = capabilities{
+		ReadOnly:     s.readOnly,
+		Strict:       s.strict,
+		Tenants:      len(s.tenants) > 0,
+		Admin:        s.shutdownToken != "",
+		Optimal:      s.experimentalOptimal,
+		CBPV:         s.experimentalCBPV,
+		Quotas:       s.quota.maxSteps > 0 || s.quota.maxTime > 0,
+		Tracing:      s.spans != nil,
+		TraceFiles:   s.traceDir != "",
+		Compression:  supportedCompression,
+		Strategies:   sortedKeys(strategies),
+		Syntaxes:     sortedKeys(syntaxes),
+		Styles:       sortedKeys(printStyles),
+		MaxSteps:     s.maxSteps,
+		MaxTimeoutMs: milliseconds(s.maxTimeout),
+		MaxTermSize:  s.maxTermSize,
+	}
+	return Response{ID: request.ID, Result: result}
+}
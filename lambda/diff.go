@@ -0,0 +1,106 @@
+package lambda
+
+// A termChange is one difference between two terms, at LeftPath in the
+// left one and RightPath in the right. Changed replaces a subterm;
+// inserted wraps it in a new node, keeping it as a child; removed is
+// the reverse, replacing a node by one of its children.
+type termChange struct {
+	Kind      string `json:"kind"`
+	LeftPath  path   `json:"leftPath"`
+	RightPath path   `json:"rightPath"`
+	Left      string `json:"left"`
+	Right     string `json:"right"`
+}
+
+// diffTerms lists the changes turning left into right, comparing bound
+// variables by position rather than name.
+func diffTerms(left, right expression) []termChange {
+	d := &termDiff{changes: []termChange{}}
+	d.walk(left, right, path{}, path{}, nil, nil)
+	return d.changes
+}
+
+type termDiff struct {
+	changes []termChange
+}
+
+func (d *termDiff) report(kind string, left, right expression, leftPath, rightPath path) {
+	d.changes = append(d.changes, termChange{
+		Kind:      kind,
+		LeftPath:  append(path{}, leftPath...),
+		RightPath: append(path{}, rightPath...),
+		Left:      printCompact(left),
+		Right:     printCompact(right),
+	})
+}
+
+func (d *termDiff) walk(left, right expression, leftPath, rightPath path, boundL, boundR []string) {
+	if alphaEqual(left, right, boundL, boundR) {
+		return
+	}
+	switch l := left.(type) {
+	case *abstraction:
+		if r, ok := right.(*abstraction); ok {
+			d.walk(l.body, r.body, append(leftPath, 0), append(rightPath, 0), append(boundL, l.parameter.name), append(boundR, r.parameter.name))
+			return
+		}
+	case *application:
+		if r, ok := right.(*application); ok {
+			d.walk(l.left, r.left, append(leftPath, 0), append(rightPath, 0), boundL, boundR)
+			d.walk(l.right, r.right, append(leftPath, 1), append(rightPath, 1), boundL, boundR)
+			return
+		}
+	}
+
+	// A node kept whole as a child of a new one was inserted, and the
+	// other way round removed.
+	if keptChild(left, right, boundL, boundR) {
+		d.report("inserted", left, right, leftPath, rightPath)
+		return
+	}
+	if keptChild(right, left, boundR, boundL) {
+		d.report("removed", left, right, leftPath, rightPath)
+		return
+	}
+	d.report("changed", left, right, leftPath, rightPath)
+}
+
+// keptChild reports whether term is a direct child of wrapper.
+func keptChild(term, wrapper expression, boundT, boundW []string) bool {
+	switch w := wrapper.(type) {
+	case *abstraction:
+		return alphaEqual(term, w.body, boundT, append(boundW, w.parameter.name))
+	case *application:
+		return alphaEqual(term, w.left, boundT, boundW) || alphaEqual(term, w.right, boundT, boundW)
+	}
+	return false
+}
+
+// diff compares two expressions structurally, for showing how they
+// differ.
+func (c *connection) diff(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	left, err := c.expressionParam(params, "left")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	right, err := c.expressionParam(params, "right")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	changes := diffTerms(left, right)
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Equal   bool         `json:"equal"`
+			Changes []termChange `json:"changes"`
+		}{
+			Equal:   len(changes) == 0,
+			Changes: changes,
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package lambda
+
+import (
+	"runtime"
+)
+
+const defaultDiffTraceSteps = 10000
+
+type diffTraceResult struct {
+	// Diverged reports whether the reductions ever reached terms that
+	// are not alpha-equivalent. Step is the first step at which they
+	// did, with the terms at that step; otherwise it is the number of
+	// steps compared.
+	Diverged bool   `json:"diverged"`
+	Step     int    `json:"step"`
+	Left     string `json:"left,omitempty"`
+	Right    string `json:"right,omitempty"`
+
+	// Steps taken by each side, and whether it reached a normal form.
+	LeftSteps   int  `json:"leftSteps"`
+	RightSteps  int  `json:"rightSteps"`
+	LeftNormal  bool `json:"leftNormal"`
+	RightNormal bool `json:"rightNormal"`
+}
+
+// diffTrace reduces two expressions in lockstep with the same strategy
+// and reports the first step at which their terms differ other than by
+// the names of bound variables. Once one side is normal it stays put,
+// so a reduction that merely takes longer diverges when the shorter
+// one stops.
+func (s *Server) diffTrace(c *connection, request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	left, err := c.expressionParam(params, "left")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	right, err := c.expressionParam(params, "right")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	strategy, err := strategyParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := s.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := s.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if maxSteps == 0 {
+		maxSteps = defaultDiffTraceSteps
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	result := diffTraceResult{}
+	defer func() { meterSteps(ctx, result.LeftSteps+result.RightSteps) }()
+	for {
+		if !alphaEquivalent(left, right) {
+			result.Diverged = true
+			result.Left, result.Right = left.String(), right.String()
+			break
+		}
+		if result.Step == maxSteps {
+			break
+		}
+		if ctx.Err() != nil {
+			return errorResponse(request.ID, codeTimeout, "diffTrace timed out")
+		}
+		if result.Step%yieldSteps == yieldSteps-1 {
+			runtime.Gosched()
+		}
+
+		leftNext, _, leftOK := strategy.step(left)
+		rightNext, _, rightOK := strategy.step(right)
+		if !leftOK && !rightOK {
+			result.LeftNormal, result.RightNormal = true, true
+			break
+		}
+		result.Step++
+		if leftOK {
+			left = leftNext
+			result.LeftSteps++
+		} else {
+			result.LeftNormal = true
+		}
+		if rightOK {
+			right = rightNext
+			result.RightSteps++
+		} else {
+			result.RightNormal = true
+		}
+	}
+	return Response{ID: request.ID, Result: result}
+}
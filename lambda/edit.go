@@ -0,0 +1,195 @@
+package lambda
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// subterm returns the subterm of an expression at a tree path.
+func (c *connection) subterm(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	at, err := pathParam(params, "path")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	sub, ok := subtermAt(expr, at)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("path %v does not address a subterm", at))
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Expression string `json:"expression"`
+			Span       span   `json:"span"`
+		}{
+			Expression: sub.String(),
+			Span:       spanOf(sub),
+		},
+	}
+}
+
+// replaceAtMethod splices a replacement into an expression at a tree
+// path. Free variables of the replacement are captured by binders
+// above the path, as they would be by textual editing.
+func (c *connection) replaceAtMethod(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	at, err := pathParam(params, "path")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	replacement, err := c.expressionParam(params, "replacement")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	result, ok := replaceAt(expr, at, replacement)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("path %v does not address a subterm", at))
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Expression string `json:"expression"`
+		}{
+			Expression: result.String(),
+		},
+	}
+}
+
+// expressionParam parses the named source parameter, which may refer
+// to terms of this session.
+func (c *connection) expressionParam(params map[string]interface{}, name string) (expression, error) {
+	source, ok := params[name].(string)
+	if !ok {
+		return nil, fmt.Errorf("Invalid %s parameter", name)
+	}
+	parse, err := c.syntaxParam(params)
+	if err != nil {
+		return nil, err
+	}
+	expr, _, err := parse(source, c.resolve)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return expr, nil
+}
+
+// definitionsParam reads the optional definitions parameter, a map of
+// names to expressions that may use one another, expanding each in
+// terms of the others.
+func (c *connection) definitionsParam(params map[string]interface{}) (map[string]expression, error) {
+	raw, present := params["definitions"]
+	if !present {
+		return nil, nil
+	}
+	sources, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Invalid definitions parameter")
+	}
+	parse, err := c.syntaxParam(params)
+	if err != nil {
+		return nil, err
+	}
+	parsed := map[string]expression{}
+	for name, value := range sources {
+		if !validName(name) {
+			return nil, fmt.Errorf("Invalid definitions parameter: bad name %q", name)
+		}
+		source, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("Invalid definitions parameter: %s is not a string", name)
+		}
+		expr, _, err := parse(source, c.resolve)
+		if err != nil {
+			return nil, fmt.Errorf("definitions: %s: %w", name, err)
+		}
+		// Spans would point into the definition rather than the
+		// expression using it.
+		parsed[name] = withoutSpans(expr)
+	}
+
+	expanded := map[string]expression{}
+	expanding := map[string]bool{}
+	var expand func(name string) error
+	expand = func(name string) error {
+		if _, done := expanded[name]; done {
+			return nil
+		}
+		if expanding[name] {
+			return fmt.Errorf("Invalid definitions parameter: %s is defined in terms of itself", name)
+		}
+		expanding[name] = true
+		for free := range freeVariables(parsed[name]) {
+			if _, ok := parsed[free]; ok {
+				if err := expand(free); err != nil {
+					return err
+				}
+			}
+		}
+		expanded[name] = expandDefinitions(parsed[name], expanded)
+		return nil
+	}
+	for name := range parsed {
+		if err := expand(name); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+func withoutSpans(expr expression) expression {
+	switch e := expr.(type) {
+	case *variable:
+		return &variable{name: e.name}
+	case *abstraction:
+		return &abstraction{parameter: variable{name: e.parameter.name}, body: withoutSpans(e.body)}
+	case *application:
+		return &application{left: withoutSpans(e.left), right: withoutSpans(e.right)}
+	}
+	return expr
+}
+
+func validName(name string) bool {
+	if name == "" || name[0] == '\'' {
+		return false
+	}
+	for _, r := range name {
+		if !isNameRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathParam reads a tree path given as an array of 0s and 1s.
+func pathParam(params map[string]interface{}, name string) (path, error) {
+	raw, ok := params[name].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Invalid %s parameter", name)
+	}
+	at := path{}
+	for _, step := range raw {
+		n, ok := step.(float64)
+		if !ok || n != math.Trunc(n) || n < 0 || n > 1 {
+			return nil, errors.New("Invalid " + name + " parameter: steps must be 0 or 1")
+		}
+		at = append(at, int(n))
+	}
+	return at, nil
+}
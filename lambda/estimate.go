@@ -0,0 +1,211 @@
+package lambda
+
+import (
+	"context"
+	"time"
+)
+
+// Bounds on the trial reduction estimate runs before falling back to
+// static heuristics, which must leave the connection quickly: a term
+// that grows past estimateProbeSize is given up on like one that runs
+// out of steps.
+const (
+	estimateProbeSteps   = 200
+	estimateProbeSize    = 100000
+	estimateProbeTimeout = 100 * time.Millisecond
+)
+
+type estimateResult struct {
+	Size     int      `json:"size"`
+	Redexes  int      `json:"redexes"`
+	Patterns []string `json:"patterns,omitempty"`
+
+	// NormalFormSteps is set when the probe reached a normal form.
+	NormalFormSteps *int `json:"normalFormSteps,omitempty"`
+
+	// Cost is one of normalForm, cheap, moderate, expensive and
+	// likelyDivergent.
+	Cost string `json:"cost"`
+}
+
+// estimate classifies how expensive evaluating an expression is likely
+// to be, without committing to a full evaluation: a short trial
+// reduction settles small terms, and syntactic patterns known to
+// diverge or to blow up flag the rest.
+func (c *connection) estimate(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	expr = withoutSpans(expr)
+
+	result := estimateResult{
+		Size:     termSize(expr),
+		Redexes:  countRedexes(expr),
+		Patterns: divergencePatterns(expr),
+	}
+
+	if result.Redexes == 0 {
+		zero := 0
+		result.NormalFormSteps = &zero
+		result.Cost = "normalForm"
+		return Response{ID: request.ID, Result: result}
+	}
+
+	ctx, cancel := c.evaluationContext(request, estimateProbeTimeout)
+	defer cancel()
+	if steps, ok := probe(ctx, expr, estimateProbeSteps); ok {
+		result.NormalFormSteps = &steps
+		result.Cost = "cheap"
+		return Response{ID: request.ID, Result: result}
+	}
+
+	switch {
+	case len(result.Patterns) > 0:
+		result.Cost = "likelyDivergent"
+	case result.Size > 10000 || duplicatingRedexes(expr) > 0:
+		result.Cost = "expensive"
+	default:
+		result.Cost = "moderate"
+	}
+	return Response{ID: request.ID, Result: result}
+}
+
+// probe reduces expr in normal order for at most limit steps, until ctx
+// is done or the term grows past estimateProbeSize, and reports the
+// number of steps taken if that reached a normal form.
+func probe(ctx context.Context, expr expression, limit int) (int, bool) {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	_, steps, err := reduce(ctx, normalOrder{}, expr, limit, func(before expression, _ path) {
+		if termSize(before) > estimateProbeSize {
+			stop()
+		}
+	})
+	return steps, err == nil
+}
+
+func countRedexes(expr expression) int {
+	switch e := expr.(type) {
+	case *abstraction:
+		return countRedexes(e.body)
+	case *application:
+		n := countRedexes(e.left) + countRedexes(e.right)
+		if _, ok := e.left.(*abstraction); ok {
+			n++
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// duplicatingRedexes counts redexes whose parameter occurs more than
+// once in the body, the ones that can make a term grow.
+func duplicatingRedexes(expr expression) int {
+	switch e := expr.(type) {
+	case *abstraction:
+		return duplicatingRedexes(e.body)
+	case *application:
+		n := duplicatingRedexes(e.left) + duplicatingRedexes(e.right)
+		if fn, ok := e.left.(*abstraction); ok && occurrences(fn.body, fn.parameter.name) > 1 {
+			n++
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// occurrences counts the free occurrences of name in expr.
+func occurrences(expr expression, name string) int {
+	switch e := expr.(type) {
+	case *variable:
+		if e.name == name {
+			return 1
+		}
+		return 0
+	case *abstraction:
+		if e.parameter.name == name {
+			return 0
+		}
+		return occurrences(e.body, name)
+	case *application:
+		return occurrences(e.left, name) + occurrences(e.right, name)
+	default:
+		return 0
+	}
+}
+
+// divergencePatterns looks for redexes shaped like Ω = (λx.x x)(λx.x x)
+// or like the core of a fixpoint combinator, (λx.f (x x))(λx.f (x x)):
+// a self-applying abstraction applied to another self-applying one.
+func divergencePatterns(expr expression) []string {
+	found := map[string]bool{}
+	var walk func(expression)
+	walk = func(expr expression) {
+		switch e := expr.(type) {
+		case *abstraction:
+			walk(e.body)
+		case *application:
+			fn, ok := e.left.(*abstraction)
+			arg, argOK := e.right.(*abstraction)
+			if ok && argOK && selfApplies(fn) && selfApplies(arg) {
+				if isVariableApplication(fn.body) {
+					found["omega"] = true
+				} else {
+					found["fixpoint"] = true
+				}
+			}
+			walk(e.left)
+			walk(e.right)
+		}
+	}
+	walk(expr)
+
+	var patterns []string
+	for _, name := range []string{"omega", "fixpoint"} {
+		if found[name] {
+			patterns = append(patterns, name)
+		}
+	}
+	return patterns
+}
+
+// selfApplies reports whether the body of a applies its parameter to
+// itself somewhere.
+func selfApplies(a *abstraction) bool {
+	name := a.parameter.name
+	var walk func(expression) bool
+	walk = func(expr expression) bool {
+		switch e := expr.(type) {
+		case *abstraction:
+			return e.parameter.name != name && walk(e.body)
+		case *application:
+			l, lok := e.left.(*variable)
+			r, rok := e.right.(*variable)
+			if lok && rok && l.name == name && r.name == name {
+				return true
+			}
+			return walk(e.left) || walk(e.right)
+		default:
+			return false
+		}
+	}
+	return walk(a.body)
+}
+
+// isVariableApplication matches the bare `x x` body of ω.
+func isVariableApplication(expr expression) bool {
+	app, ok := expr.(*application)
+	if !ok {
+		return false
+	}
+	_, lok := app.left.(*variable)
+	_, rok := app.right.(*variable)
+	return lok && rok
+}
@@ -0,0 +1,34 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+
+	"example.com/rpc"
+)
+
+func TestEstimate(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	ctx := rpc.WithSession(context.Background())
+
+	if response := s.ServeRPC(ctx, Request{ID: 1, Method: "evaluate", Params: map[string]interface{}{"expression": `\y.y`}}); response.Error != nil {
+		t.Fatal(response.Error.Message)
+	}
+	// The reference resolves as it would for evaluate.
+	var estimated estimateResult
+	decodeResult(t, s.ServeRPC(ctx, Request{ID: 2, Method: "estimate", Params: map[string]interface{}{"expression": "$1 a"}}), &estimated)
+	if estimated.Cost != "cheap" || estimated.NormalFormSteps == nil || *estimated.NormalFormSteps != 1 {
+		t.Errorf("estimate $1 a: got %+v, want cheap in 1 step", estimated)
+	}
+
+	// A term past the size bound is given up on after the step under
+	// way.
+	var big expression = &variable{name: "a"}
+	for i := 0; i < estimateProbeSize; i++ {
+		big = &application{left: big, right: &variable{name: "a"}}
+	}
+	identity := &abstraction{parameter: variable{name: "x"}, body: &variable{name: "x"}}
+	if steps, ok := probe(context.Background(), &application{left: identity, right: big}, estimateProbeSteps); ok || steps > 1 {
+		t.Errorf("probe of a term past the size bound: got %d steps, %v; want at most 1, false", steps, ok)
+	}
+}
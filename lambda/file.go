@@ -0,0 +1,165 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A lamLine is one line of a .lam file. Such files hold a term per
+// line; a line may instead define a name, as in `id = \x.x`, which the
+// lines after it can use as a free variable. Blank lines, comments
+// and lines starting with # are skipped.
+type lamLine struct {
+	// number counts from 1; column is the byte offset of source within
+	// the line.
+	number int
+	column int
+
+	name   string
+	source string
+
+	// before and after are the comments on the line around the term,
+	// before indented as it was; inner is set if the term has comments
+	// within it.
+	before, after string
+	inner         bool
+
+	// term is source as parsed, with spans relative to it; expr is term
+	// with the names defined so far expanded. Both are nil when err is
+	// set.
+	term expression
+	expr expression
+	err  error
+}
+
+// parseLamFile parses the lines of a .lam file. Comments are blanked
+// out first, so a block comment may span lines; an unterminated one
+// ends the file with an error on the line it starts on.
+func parseLamFile(src string) []lamLine {
+	blanked, err := blankComments(src)
+	var unterminated *syntaxError
+	if errors.As(err, &unterminated) {
+		blanked, _ = blankComments(src[:unterminated.offset])
+	}
+
+	var lines []lamLine
+	definitions := map[string]expression{}
+	originals := strings.Split(src, "\n")
+	for i, text := range strings.Split(blanked, "\n") {
+		text = strings.TrimRight(text, "\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		line := lamLine{number: i + 1}
+		line.column = len(text) - len(strings.TrimLeft(text, " \t"))
+		line.source = strings.TrimRight(text[line.column:], " \t")
+		original := strings.TrimRight(originals[i], "\r")
+		line.before = strings.TrimRight(original[:line.column], " \t")
+		line.after = strings.TrimSpace(original[line.column+len(line.source):])
+		line.inner = original[line.column:line.column+len(line.source)] != line.source
+		if name, rest, ok := splitDefinition(line.source); ok {
+			line.name = name
+			line.column += len(line.source) - len(rest)
+			line.source = rest
+		}
+
+		line.term, line.err = parseLambdaExpression(line.source)
+		if line.err == nil {
+			line.expr = expandDefinitions(line.term, definitions)
+			if line.name != "" {
+				definitions[line.name] = line.expr
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if unterminated != nil {
+		number := strings.Count(src[:unterminated.offset], "\n")
+		start := strings.LastIndexByte(src[:unterminated.offset], '\n') + 1
+		if n := len(lines); n > 0 && lines[n-1].number == number+1 {
+			lines = lines[:n-1]
+		}
+		lines = append(lines, lamLine{
+			number: number + 1,
+			column: unterminated.offset - start,
+			source: strings.TrimRight(strings.SplitN(src[unterminated.offset:], "\n", 2)[0], " \t\r"),
+			err:    syntaxErrorf(0, "unterminated comment"),
+		})
+	}
+	return lines
+}
+
+// splitDefinition splits `name = expression` into its name and the
+// expression.
+func splitDefinition(source string) (string, string, bool) {
+	i := strings.IndexByte(source, '=')
+	if i < 0 {
+		return "", "", false
+	}
+	name := strings.TrimSpace(source[:i])
+	if !validName(name) {
+		return "", "", false
+	}
+	rest := source[i+1:]
+	return name, strings.TrimLeft(rest, " \t"), true
+}
+
+// expandDefinitions substitutes the defined names free in expr.
+func expandDefinitions(expr expression, definitions map[string]expression) expression {
+	for name := range freeVariables(expr) {
+		if definition, ok := definitions[name]; ok {
+			expr = substitute(expr, variable{name: name}, definition)
+		}
+	}
+	return expr
+}
+
+// A FileResult is the outcome of evaluating one term of a .lam file.
+type FileResult struct {
+	Line   int
+	Source string
+
+	// Result is the normal form, printed in the compact style, unless
+	// Err is set.
+	Result string
+	Steps  int
+	Err    error
+}
+
+// EvaluateFile evaluates the terms of a .lam file top to bottom in
+// normal order, each within timeout and, unless it is 0, maxSteps.
+// Definitions are not evaluated themselves, only where they are used.
+func EvaluateFile(ctx context.Context, src string, timeout time.Duration, maxSteps int) []FileResult {
+	var results []FileResult
+	for _, line := range parseLamFile(src) {
+		if line.err == nil && line.name != "" {
+			continue
+		}
+		result := FileResult{Line: line.number, Source: line.source, Err: line.err}
+		if line.err == nil {
+			result.Result, result.Steps, result.Err = evaluateLine(ctx, line.expr, timeout, maxSteps)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func evaluateLine(ctx context.Context, expr expression, timeout time.Duration, maxSteps int) (string, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	normal, steps, err := reduce(ctx, normalOrder{}, expr, maxSteps, nil)
+	switch {
+	case errors.Is(err, errStepLimit):
+		return "", steps, fmt.Errorf("no normal form within %d steps", maxSteps)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "", steps, fmt.Errorf("no normal form within %s", timeout)
+	case err != nil:
+		return "", steps, err
+	}
+	return printCompact(normal), steps, nil
+}
@@ -0,0 +1,113 @@
+package lambda
+
+import (
+	"fmt"
+	"strings"
+)
+
+// formatTerm prints expr canonically: in the compact style, with every
+// binder that shadows an enclosing one renamed as freshName would, so
+// equal terms written with the same names always format the same.
+func formatTerm(expr expression) string {
+	return printCompact(unshadow(expr, map[string]bool{}, freeVariables(expr)))
+}
+
+// unshadow renames the binders of expr that are already in scope,
+// avoiding the names in free.
+func unshadow(expr expression, scope, free map[string]bool) expression {
+	switch e := expr.(type) {
+	case *abstraction:
+		parameter, body := e.parameter, e.body
+		if scope[parameter.name] {
+			used := map[string]bool{}
+			for name := range scope {
+				used[name] = true
+			}
+			for name := range free {
+				used[name] = true
+			}
+			fresh := variable{freshName(parameter.name, used), parameter.span}
+			body = substitute(body, parameter, &variable{fresh.name, fresh.span})
+			parameter = fresh
+		}
+		scope[parameter.name] = true
+		body = unshadow(body, scope, free)
+		delete(scope, parameter.name)
+		return &abstraction{parameter, body, e.span}
+	case *application:
+		return &application{unshadow(e.left, scope, free), unshadow(e.right, scope, free), e.span}
+	default:
+		return expr
+	}
+}
+
+// Format formats the source of a .lam file: each term canonically, as
+// in `name = \x y.x`, comments and blank lines as they were but for
+// whitespace around them. Lines with comments within a term are left
+// alone. It fails on the first line that does not parse.
+func Format(src string) (string, error) {
+	texts := strings.Split(src, "\n")
+	for _, line := range parseLamFile(src) {
+		if line.err != nil {
+			return "", fmt.Errorf("line %d: %v", line.number, line.err)
+		}
+		if line.inner {
+			continue
+		}
+		formatted := formatTerm(line.term)
+		if line.name != "" {
+			formatted = line.name + " = " + formatted
+		}
+		if line.before != "" {
+			formatted = line.before + " " + formatted
+		}
+		if line.after != "" {
+			formatted += " " + line.after
+		}
+		texts[line.number-1] = formatted
+	}
+	for i, text := range texts {
+		texts[i] = strings.TrimRight(text, " \t\r")
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// format formats an expression or, given source instead, a whole .lam
+// file.
+func (s *Server) format(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	if source, ok := params["source"].(string); ok {
+		formatted, err := Format(source)
+		if err != nil {
+			return invalidParams(request.ID, err)
+		}
+		return Response{
+			ID: request.ID,
+			Result: struct {
+				Source string `json:"source"`
+			}{
+				Source: formatted,
+			},
+		}
+	}
+
+	source, ok := params["expression"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid expression parameter")
+	}
+	expr, err := parseLambdaExpression(source)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Expression string `json:"expression"`
+		}{
+			Expression: formatTerm(expr),
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package lambda
+
+import (
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// readFramed reads a message framed with a Content-Length header, as
+// the Debug Adapter and Language Server protocols send them, refusing
+// those longer than maxBytes before allocating them.
+func readFramed(r *textproto.Reader, maxBytes int) ([]byte, error) {
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length header %q", header.Get("Content-Length"))
+	}
+	if length > maxBytes {
+		return nil, fmt.Errorf("message of %d bytes is larger than the maximum of %d", length, maxBytes)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.R, body); err != nil {
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+	return body, nil
+}
+
+func writeFramed(w io.Writer, body []byte) error {
+	_, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// messageLimit reads the socket protocol's stream for a json.Decoder,
+// failing once a message runs past max bytes rather than buffering it
+// all. It is reset before each message; as the decoder reads ahead, a
+// message may then get up to a buffer's worth more.
+type messageLimit struct {
+	r    io.Reader
+	max  int
+	left int
+}
+
+func newMessageLimit(r io.Reader, max int) *messageLimit {
+	return &messageLimit{r: r, max: max, left: max}
+}
+
+func (l *messageLimit) reset() {
+	l.left = l.max
+}
+
+func (l *messageLimit) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		return 0, fmt.Errorf("message larger than the maximum of %d bytes", l.max)
+	}
+	if len(p) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= n
+	return n, err
+}
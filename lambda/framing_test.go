@@ -0,0 +1,51 @@
+package lambda
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadFramed(t *testing.T) {
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader("Content-Length: 2\r\n\r\n{}Content-Length: 1000000000000\r\n\r\n")))
+	body, err := readFramed(r, 1024)
+	if err != nil || string(body) != "{}" {
+		t.Errorf("got %q, %v; want {}", body, err)
+	}
+	if _, err := readFramed(r, 1024); err == nil || !strings.Contains(err.Error(), "maximum") {
+		t.Errorf("got %v, want the length refused before reading the body", err)
+	}
+}
+
+func TestServeLSPMaxMessageBytes(t *testing.T) {
+	s := NewServer(Options{Workers: 1, MaxMessageBytes: 16})
+	message := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	framed := "Content-Length: " + strconv.Itoa(len(message)) + "\r\n\r\n" + message
+	if err := s.ServeLSP(strings.NewReader(framed), io.Discard); err == nil {
+		t.Error("ServeLSP took a message past MaxMessageBytes")
+	}
+}
+
+func TestServeConnMaxMessageBytes(t *testing.T) {
+	s := NewServer(Options{Workers: 1, MaxMessageBytes: 1024})
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(server)
+
+	decoder := json.NewDecoder(client)
+	io.WriteString(client, `{"id":1,"method":"evaluate","params":{"expression":"(\\x.x) a"}}`+"\n")
+	var response Response
+	if err := decoder.Decode(&response); err != nil || response.Error != nil {
+		t.Fatalf("request under the limit: got %+v, %v", response.Error, err)
+	}
+
+	go io.WriteString(client, `{"id":2,"method":"evaluate","params":{"expression":"`+strings.Repeat("(", 4096)+`x"}}`+"\n")
+	if err := decoder.Decode(&response); err != io.EOF {
+		t.Errorf("request past the limit: got %+v, %v; want the connection closed", response, err)
+	}
+}
@@ -0,0 +1,153 @@
+package lambda
+
+import (
+	"strings"
+	"testing"
+)
+
+// Limits keeping a single fuzz input cheap: terms may grow while being
+// reduced, so evaluation stops at whichever bound comes first.
+const (
+	fuzzMaxInput = 512
+	fuzzMaxSteps = 200
+	fuzzMaxSize  = 20000
+
+	// Parsing alone is cheap enough for inputs nesting past maxDepth.
+	fuzzMaxParseInput = 1 << 20
+)
+
+var fuzzSeeds = []string{
+	`x`,
+	`(\x.x) y`,
+	`\x y.x`,
+	`λx.λx.x`,
+	`(!x.(x x))`,
+	`(\x.x x) (\x.x x)`,
+	`(\n f x.f (n f x)) (\f x.f x)`,
+	`(\x.\y.x y) y`,
+	`((a b) (c d))`,
+	`(x`,
+	`x)`,
+	`\.x`,
+	`\x x`,
+	`$1 @ab`,
+	`()`,
+	`λφ.φ succ' twoPlusTwo`,
+	`\x'.'x`,
+}
+
+// deepSeeds nest right at maxDepth and just past it.
+var deepSeeds = []string{
+	strings.Repeat("(", 2*maxDepth) + "x" + strings.Repeat(")", 2*maxDepth),
+	strings.Repeat("(", 2*maxDepth+1) + "x" + strings.Repeat(")", 2*maxDepth+1),
+	strings.Repeat(`\a.`, maxDepth) + "a",
+	strings.Repeat(`\a.`, maxDepth+1) + "a",
+	strings.Repeat("x ", maxDepth+1),
+	strings.Repeat("x ", maxDepth+2),
+	strings.Repeat("(x ", maxDepth/2) + "x" + strings.Repeat(")", maxDepth/2),
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	for _, seed := range deepSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		if len(src) > fuzzMaxParseInput {
+			return
+		}
+		expr, err := parseLambdaExpression(src)
+		if err != nil {
+			return
+		}
+
+		// Printing and parsing again must give back the same term.
+		printed := expr.String()
+		again, err := parseLambdaExpression(printed)
+		if err != nil {
+			t.Fatalf("printed form %q of %q does not parse: %v", printed, src, err)
+		}
+		if again.String() != printed {
+			t.Fatalf("round trip of %q changed %q into %q", src, printed, again.String())
+		}
+
+		// So must the compact style.
+		compact := printCompact(expr)
+		again, err = parseLambdaExpression(compact)
+		if err != nil {
+			t.Fatalf("compact form %q of %q does not parse: %v", compact, src, err)
+		}
+		if again.String() != printed {
+			t.Fatalf("compact round trip of %q changed %q into %q", src, printed, again.String())
+		}
+	})
+}
+
+func FuzzEvaluate(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		if len(src) > fuzzMaxInput {
+			return
+		}
+		expr, err := parseLambdaExpression(src)
+		if err != nil {
+			return
+		}
+
+		free := freeVariables(expr)
+		for i := 0; i < fuzzMaxSteps; i++ {
+			next, ok := step(expr)
+			if !ok {
+				break
+			}
+			expr = next
+			if termSize(expr) > fuzzMaxSize {
+				return
+			}
+
+			// Reduction never invents or captures free variables.
+			for name := range freeVariables(expr) {
+				if !free[name] {
+					t.Fatalf("reducing %q introduced free variable %s in %s", src, name, expr)
+				}
+			}
+		}
+
+		if _, err := parseLambdaExpression(expr.String()); err != nil {
+			t.Fatalf("result %s of %q does not parse: %v", expr, src, err)
+		}
+	})
+}
+
+func FuzzBinary(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		if len(src) > fuzzMaxInput {
+			return
+		}
+
+		// Arbitrary bytes must decode or fail, never panic.
+		decodeBinary([]byte(src))
+
+		expr, err := parseLambdaExpression(src)
+		if err != nil {
+			return
+		}
+		decoded, err := decodeBinary(encodeBinary(expr))
+		if err != nil {
+			t.Fatalf("encoding of %q does not decode: %v", src, err)
+		}
+		if !alphaEquivalent(decoded, expr) {
+			t.Fatalf("binary round trip of %q gave %s", src, decoded)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package lambda
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type goldenCase struct {
+	name       string
+	expression string
+	normalForm string
+
+	// lazy cases have a normal form that only a strategy contracting
+	// outermost redexes first is guaranteed to find.
+	lazy bool
+}
+
+func loadCorpus(t *testing.T) []goldenCase {
+	t.Helper()
+
+	f, err := os.Open("testdata/corpus.lam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var cases []goldenCase
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "|")
+		if len(fields) != 3 && len(fields) != 4 {
+			t.Fatalf("corpus.lam:%d: want name | expression | normal form [| lazy]", line)
+		}
+		c := goldenCase{
+			name:       strings.TrimSpace(fields[0]),
+			expression: strings.TrimSpace(fields[1]),
+			normalForm: strings.TrimSpace(fields[2]),
+		}
+		if len(fields) == 4 {
+			if tag := strings.TrimSpace(fields[3]); tag != "lazy" {
+				t.Fatalf("corpus.lam:%d: unknown tag %q", line, tag)
+			}
+			c.lazy = true
+		}
+		cases = append(cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return cases
+}
+
+// goldenStrategies lists the strategies checked against the corpus.
+// Strategies that are not complete skip the lazy cases; random order
+// runs with a fixed seed, so that a failure can be replayed.
+var goldenStrategies = []struct {
+	strategy
+	complete bool
+}{
+	{normalOrder{}, true},
+	{applicativeOrder{}, false},
+	{randomOrder{}.withSeed(1), false},
+}
+
+func TestGoldenCorpus(t *testing.T) {
+	cases := loadCorpus(t)
+
+	for _, strategy := range goldenStrategies {
+		for _, c := range cases {
+			t.Run(strategy.name()+"/"+c.name, func(t *testing.T) {
+				if c.lazy && !strategy.complete {
+					t.Skip("diverges under this strategy")
+				}
+				expr, err := parseLambdaExpression(c.expression)
+				if err != nil {
+					t.Fatalf("parsing expression: %v", err)
+				}
+				want, err := parseLambdaExpression(c.normalForm)
+				if err != nil {
+					t.Fatalf("parsing normal form: %v", err)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				got, _, err := reduce(ctx, strategy, expr, 0, nil)
+				if err != nil {
+					t.Fatalf("no normal form: %v", err)
+				}
+				if !strategy.isNormal(got) {
+					t.Errorf("reduction stopped at %s, which the strategy does not consider normal", got)
+				}
+				if !alphaEquivalent(got, want) {
+					t.Errorf("got %s, want %s", got, want)
+				}
+			})
+		}
+	}
+}
+
+// TestOptimalCorpus checks that the experimental optimal engine never
+// reads back a wrong normal form. It is allowed to give up on terms
+// outside the fragment it handles.
+func TestOptimalCorpus(t *testing.T) {
+	for _, c := range loadCorpus(t) {
+		t.Run(c.name, func(t *testing.T) {
+			expr, err := parseLambdaExpression(c.expression)
+			if err != nil {
+				t.Fatalf("parsing expression: %v", err)
+			}
+			want, err := parseLambdaExpression(c.normalForm)
+			if err != nil {
+				t.Fatalf("parsing normal form: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			got, _, err := normalizeOptimal(ctx, expr)
+			if errors.Is(err, errReadback) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatalf("no normal form: %v", err)
+			}
+			if !alphaEquivalent(got, want) {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
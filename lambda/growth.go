@@ -0,0 +1,116 @@
+package lambda
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A termSizeWarning is the params of an evaluate/termSize notification,
+// sent when the term under evaluation of a request reaches a warning
+// threshold.
+type termSizeWarning struct {
+	Size      int `json:"size"`
+	Step      int `json:"step"`
+	Threshold int `json:"threshold"`
+	Limit     int `json:"limit,omitempty"`
+}
+
+// A sizeGuard watches the size of the term under reduction, calling
+// warn each time it first reaches one of the warnings thresholds and
+// cancelling the reduction once it grows past limit, if positive.
+type sizeGuard struct {
+	limit    int
+	warnings []int
+	warn     func(size, step, threshold int)
+	cancel   func()
+
+	steps int
+	next  int
+
+	// exceeded is set once the term grew past limit, to size nodes
+	// after step steps.
+	exceeded bool
+	size     int
+	step     int
+}
+
+// observe is a reduce observer checking the term about to be
+// contracted.
+func (g *sizeGuard) observe(before expression, at path) {
+	g.check(before)
+	g.steps++
+}
+
+// check checks expr, the term after g.steps steps.
+func (g *sizeGuard) check(expr expression) {
+	size := termSize(expr)
+	for g.next < len(g.warnings) && size >= g.warnings[g.next] {
+		g.warn(size, g.steps, g.warnings[g.next])
+		g.next++
+	}
+	if g.limit > 0 && size > g.limit && !g.exceeded {
+		g.exceeded, g.size, g.step = true, size, g.steps
+		g.cancel()
+	}
+}
+
+// observer returns g.observe, or nil for no guard.
+func (g *sizeGuard) observer() func(expression, path) {
+	if g == nil {
+		return nil
+	}
+	return g.observe
+}
+
+// sizeLimitsParam reads the optional maxTermSize parameter, capped at
+// the server's maximum, and termSizeWarnings, a list of sizes to warn
+// at. Without termSizeWarnings, a size limit is warned of at half and
+// nine tenths of it.
+func (s *Server) sizeLimitsParam(params map[string]interface{}) (int, []int, error) {
+	limit, present, err := positiveInt(params, "maxTermSize")
+	if err != nil {
+		return 0, nil, err
+	}
+	if !present || s.maxTermSize > 0 && limit > s.maxTermSize {
+		limit = s.maxTermSize
+	}
+
+	raw, present := params["termSizeWarnings"]
+	if !present {
+		if limit > 0 {
+			return limit, defaultSizeWarnings(limit), nil
+		}
+		return 0, nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return 0, nil, errors.New("Invalid termSizeWarnings parameter")
+	}
+	warnings := make([]int, len(list))
+	for i, item := range list {
+		size, _, err := positiveInt(map[string]interface{}{"termSizeWarnings": item}, "termSizeWarnings")
+		if err != nil {
+			return 0, nil, err
+		}
+		if limit > 0 && size > limit {
+			return 0, nil, fmt.Errorf("Invalid termSizeWarnings parameter: %d is past the maxTermSize of %d", size, limit)
+		}
+		warnings[i] = size
+	}
+	sort.Ints(warnings)
+	return limit, warnings, nil
+}
+
+// defaultSizeWarnings returns the thresholds a size limit is warned of
+// at, half and nine tenths of it, leaving out those a small limit
+// makes zero or repeats.
+func defaultSizeWarnings(limit int) []int {
+	warnings := []int{}
+	for _, size := range []int{limit / 2, limit/10*9 + limit%10*9/10} {
+		if size > 0 && (len(warnings) == 0 || size > warnings[len(warnings)-1]) {
+			warnings = append(warnings, size)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,28 @@
+package lambda
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSizeLimitsParam(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	for _, test := range []struct {
+		limit    int
+		warnings []int
+	}{
+		{1, []int{}},
+		{2, []int{1}},
+		{5, []int{2, 4}},
+		{10, []int{5, 9}},
+		{1000, []int{500, 900}},
+	} {
+		limit, warnings, err := s.sizeLimitsParam(map[string]interface{}{"maxTermSize": float64(test.limit)})
+		if err != nil {
+			t.Fatalf("maxTermSize %d: %v", test.limit, err)
+		}
+		if limit != test.limit || !reflect.DeepEqual(warnings, test.warnings) {
+			t.Errorf("maxTermSize %d: got %d, %v; want %d, %v", test.limit, limit, warnings, test.limit, test.warnings)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package lambda
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxTenantHandles bounds the live handles of a tenant, so that a
+// client cannot grow the store faster than its handles expire.
+const maxTenantHandles = 10000
+
+var errTooManyHandles = errors.New("too many live handles; release some or let them expire")
+
+// handleStore keeps terms on the server so that clients can chain
+// computations by referring to a result as @id instead of sending it
+// back. A handle that goes unused for ttl is collected; clients done
+// with one early can release it. Each handle belongs to the tenant
+// that created it and is invisible to others.
+type handleStore struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	terms map[string]*storedTerm
+
+	// counts holds the number of live handles of each tenant with any.
+	counts map[string]int
+
+	// stop ends collect.
+	stop chan struct{}
+}
+
+type storedTerm struct {
+	tenant   string
+	term     expression
+	lastUsed time.Time
+}
+
+func newHandleStore(ttl time.Duration) *handleStore {
+	h := &handleStore{ttl: ttl, terms: map[string]*storedTerm{}, counts: map[string]int{}, stop: make(chan struct{})}
+	go h.collect()
+	return h
+}
+
+// put stores term and returns its reference, including the @ sigil. It
+// fails if tenant already holds maxTenantHandles.
+func (h *handleStore) put(tenant string, term expression) (string, error) {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	reference := "@" + hex.EncodeToString(buf)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.counts[tenant] >= maxTenantHandles {
+		return "", errTooManyHandles
+	}
+	h.terms[reference] = &storedTerm{tenant, term, time.Now()}
+	h.counts[tenant]++
+	return reference, nil
+}
+
+// drop forgets a handle; h.mu is held.
+func (h *handleStore) drop(reference string, stored *storedTerm) {
+	delete(h.terms, reference)
+	if h.counts[stored.tenant]--; h.counts[stored.tenant] == 0 {
+		delete(h.counts, stored.tenant)
+	}
+}
+
+// get looks up a handle and renews its lease.
+func (h *handleStore) get(tenant, reference string) (expression, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stored, ok := h.terms[reference]
+	if !ok || stored.tenant != tenant {
+		return nil, false
+	}
+	stored.lastUsed = time.Now()
+	return stored.term, true
+}
+
+func (h *handleStore) release(tenant, reference string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stored, ok := h.terms[reference]
+	if !ok || stored.tenant != tenant {
+		return false
+	}
+	h.drop(reference, stored)
+	return true
+}
+
+// byTenant counts the live handles of every tenant holding any.
+func (h *handleStore) byTenant() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := make(map[string]int, len(h.counts))
+	for tenant, n := range h.counts {
+		counts[tenant] = n
+	}
+	return counts
+}
+
+// purge drops every handle of a tenant, returning how many there were.
+func (h *handleStore) purge(tenant string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	purged := 0
+	for reference, stored := range h.terms {
+		if stored.tenant == tenant {
+			h.drop(reference, stored)
+			purged++
+		}
+	}
+	return purged
+}
+
+func (h *handleStore) live() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.terms)
+}
+
+// collect drops expired handles, checking a few times per ttl, until
+// the store is closed.
+func (h *handleStore) collect() {
+	ticker := time.NewTicker(h.ttl / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			h.mu.Lock()
+			for reference, stored := range h.terms {
+				if now.Sub(stored.lastUsed) > h.ttl {
+					h.drop(reference, stored)
+				}
+			}
+			h.mu.Unlock()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// close stops collecting expired handles.
+func (h *handleStore) close() {
+	close(h.stop)
+}
+
+// releaseMethod drops a handle before its ttl runs out.
+func (c *connection) releaseMethod(request Request) Response {
+	params, _ := request.Params.(map[string]interface{})
+	reference, _ := params["handle"].(string)
+	if !c.server.handles.release(c.tenantName(), reference) {
+		return errorResponse(request.ID, codeInvalidParams, "Unknown or expired handle")
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Released string `json:"released"`
+		}{
+			Released: reference,
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package lambda
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestHandleLimit(t *testing.T) {
+	h := newHandleStore(time.Minute)
+	defer h.close()
+
+	term := &variable{name: "x"}
+	var first string
+	for i := 0; i < maxTenantHandles; i++ {
+		reference, err := h.put("a", term)
+		if err != nil {
+			t.Fatalf("handle %d: %v", i, err)
+		}
+		if i == 0 {
+			first = reference
+		}
+	}
+	if _, err := h.put("a", term); err != errTooManyHandles {
+		t.Fatalf("handle past the limit: got %v, want %v", err, errTooManyHandles)
+	}
+
+	// The limit is per tenant, and releasing a handle makes room.
+	if _, err := h.put("b", term); err != nil {
+		t.Errorf("another tenant's handle: %v", err)
+	}
+	h.release("a", first)
+	if _, err := h.put("a", term); err != nil {
+		t.Errorf("handle after a release: %v", err)
+	}
+	if counts := h.byTenant(); counts["a"] != maxTenantHandles || counts["b"] != 1 {
+		t.Errorf("handles by tenant: got %v", counts)
+	}
+}
+
+func TestClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	s := NewServer(Options{Workers: 4, OTLPEndpoint: "http://127.0.0.1:0"})
+	s.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines after Close, want %d as before NewServer", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,39 @@
+package lambda
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strconv"
+)
+
+// termHash is a stable hash of expr up to the names of bound variables:
+// a SHA-256 of its de Bruijn form, written in prefix notation.
+func termHash(expr expression) string {
+	h := sha256.New()
+	var write func(expression, []string)
+	write = func(expr expression, bound []string) {
+		switch e := expr.(type) {
+		case *variable:
+			if depth := bindingDepth(bound, e.name); depth >= 0 {
+				writeToken(h, "#"+strconv.Itoa(depth))
+			} else {
+				writeToken(h, "'"+e.name)
+			}
+		case *abstraction:
+			writeToken(h, "λ")
+			write(e.body, append(bound, e.parameter.name))
+		case *application:
+			writeToken(h, "@")
+			write(e.left, bound)
+			write(e.right, bound)
+		}
+	}
+	write(expr, nil)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func writeToken(h hash.Hash, token string) {
+	h.Write([]byte(token))
+	h.Write([]byte{' '})
+}
@@ -0,0 +1,58 @@
+package lambda
+
+// headReduction contracts only the head redex, stopping at a head
+// normal form \x1...xn.y M1...Mk whose arguments may still contain
+// redexes.
+type headReduction struct{}
+
+func init() {
+	registerStrategy(headReduction{})
+}
+
+func (headReduction) name() string {
+	return "head"
+}
+
+func (headReduction) description() string {
+	return "contracts the head redex only; stops at a head normal form"
+}
+
+func (headReduction) step(expr expression) (expression, path, bool) {
+	at, ok := headRedex(expr)
+	if !ok {
+		return expr, nil, false
+	}
+	next, _ := contractAt(expr, at)
+	return next, at, true
+}
+
+func (headReduction) isNormal(expr expression) bool {
+	return isHeadNormal(expr)
+}
+
+// isHeadNormal reports whether expr is in head normal form.
+func isHeadNormal(expr expression) bool {
+	_, ok := headRedex(expr)
+	return !ok
+}
+
+// headRedex finds the redex at the head of expr, under its leading
+// abstractions and at the bottom of its application spine.
+func headRedex(expr expression) (path, bool) {
+	at := path{}
+	for {
+		switch e := expr.(type) {
+		case *abstraction:
+			at = append(at, 0)
+			expr = e.body
+		case *application:
+			if _, ok := e.left.(*abstraction); ok {
+				return at, true
+			}
+			at = append(at, 0)
+			expr = e.left
+		default:
+			return nil, false
+		}
+	}
+}
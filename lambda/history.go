@@ -0,0 +1,90 @@
+package lambda
+
+import "strconv"
+
+// historySize is the number of evaluations a session keeps. Older
+// entries are dropped, but numbering carries on, so `$n` always means
+// the same evaluation or nothing.
+const historySize = 100
+
+type historyEntry struct {
+	Index      int                    `json:"index"`
+	Expression string                 `json:"expression"`
+	Result     string                 `json:"result"`
+	Meta       map[string]interface{} `json:"meta,omitempty"`
+
+	term expression
+}
+
+// remember records a successful evaluation of the session and returns
+// the number it can be recalled by.
+func (c *connection) remember(source string, result expression, meta map[string]interface{}) int {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	c.historyCount++
+	c.history = append(c.history, historyEntry{
+		Index:      c.historyCount,
+		Expression: source,
+		Result:     result.String(),
+		Meta:       meta,
+		term:       result,
+	})
+	if len(c.history) > historySize {
+		c.history = c.history[len(c.history)-historySize:]
+	}
+	return c.historyCount
+}
+
+func (c *connection) recallEntry(index int) (historyEntry, bool) {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	for _, entry := range c.history {
+		if entry.Index == index {
+			return entry, true
+		}
+	}
+	return historyEntry{}, false
+}
+
+// historyMethod lists the most recent evaluations of the session,
+// oldest first, at most limit of them when given.
+func (c *connection) historyMethod(request Request) Response {
+	params, _ := request.Params.(map[string]interface{})
+	limit, _, err := positiveInt(params, "limit")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	c.historyMu.Lock()
+	entries := append([]historyEntry{}, c.history...)
+	c.historyMu.Unlock()
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Entries []historyEntry `json:"entries"`
+		}{
+			Entries: entries,
+		},
+	}
+}
+
+// recall returns a single history entry by its number.
+func (c *connection) recall(request Request) Response {
+	params, _ := request.Params.(map[string]interface{})
+	index, present, err := positiveInt(params, "index")
+	if err != nil || !present {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid index parameter")
+	}
+
+	entry, ok := c.recallEntry(index)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "No history entry $"+strconv.Itoa(index))
+	}
+	return Response{ID: request.ID, Result: entry}
+}
@@ -0,0 +1,456 @@
+package lambda
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notebook cells are evaluated like .lam files, and stop at the first
+// error. Definitions last for the life of the kernel. A cell starting
+// with %trace shows the steps of each reduction, up to
+// maxJupyterTraceSteps of them, with each redex highlighted.
+const (
+	jupyterProtocolVersion = "5.3"
+	jupyterDelimiter       = "<IDS|MSG>"
+	maxJupyterSteps        = 1000000
+	maxJupyterTraceSteps   = 1000
+)
+
+// jupyterConnection is the connection file a frontend starts a kernel
+// with.
+type jupyterConnection struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	StdinPort       int    `json:"stdin_port"`
+	ControlPort     int    `json:"control_port"`
+	HBPort          int    `json:"hb_port"`
+	Key             string `json:"key"`
+	SignatureScheme string `json:"signature_scheme"`
+}
+
+type jupyterKernel struct {
+	server  *Server
+	key     []byte
+	session string
+	iopub   *zmtpPublisher
+
+	// definitions and count are the notebook's state; cells are run
+	// one at a time.
+	runMu       sync.Mutex
+	definitions map[string]expression
+	count       int
+
+	// cancel interrupts the running cell.
+	cancelMu sync.Mutex
+	cancel   context.CancelFunc
+
+	shutdown chan struct{}
+	once     sync.Once
+}
+
+type jupyterMessage struct {
+	identities [][]byte
+	header     json.RawMessage
+	msgType    string
+	content    map[string]interface{}
+}
+
+// ServeJupyter runs a Jupyter kernel on the ports of a connection file
+// until a frontend shuts it down. Its kernel.json, which the kernelspec
+// command prints, should ask for interrupts by message.
+func (s *Server) ServeJupyter(connectionFile string) error {
+	data, err := os.ReadFile(connectionFile)
+	if err != nil {
+		return err
+	}
+	var connection jupyterConnection
+	if err := json.Unmarshal(data, &connection); err != nil {
+		return fmt.Errorf("decoding connection file: %w", err)
+	}
+	if connection.Transport != "tcp" {
+		return fmt.Errorf("unsupported transport %q", connection.Transport)
+	}
+	if connection.Key != "" && connection.SignatureScheme != "hmac-sha256" {
+		return fmt.Errorf("unsupported signature scheme %q", connection.SignatureScheme)
+	}
+
+	k := &jupyterKernel{
+		server:      s,
+		key:         []byte(connection.Key),
+		session:     newMessageID(),
+		iopub:       &zmtpPublisher{subscribers: map[*zmtpConn]struct{}{}},
+		definitions: map[string]expression{},
+		shutdown:    make(chan struct{}),
+	}
+
+	sockets := []struct {
+		port       int
+		socketType string
+		serve      func(*zmtpConn)
+	}{
+		{connection.ShellPort, "ROUTER", k.serveRequests},
+		{connection.ControlPort, "ROUTER", k.serveRequests},
+		{connection.StdinPort, "ROUTER", func(z *zmtpConn) { drain(z) }},
+		{connection.IOPubPort, "PUB", k.iopub.serve},
+		{connection.HBPort, "REP", heartbeat},
+	}
+	for _, socket := range sockets {
+		listener, err := net.Listen("tcp", net.JoinHostPort(connection.IP, strconv.Itoa(socket.port)))
+		if err != nil {
+			return err
+		}
+		defer listener.Close()
+		go zmtpListen(listener, socket.socketType, socket.serve)
+	}
+
+	<-k.shutdown
+	return nil
+}
+
+func drain(z *zmtpConn) {
+	for {
+		if _, err := z.receive(); err != nil {
+			return
+		}
+	}
+}
+
+// heartbeat echoes what frontends send, to show the kernel is alive.
+func heartbeat(z *zmtpConn) {
+	for {
+		message, err := z.receive()
+		if err != nil || z.send(message) != nil {
+			return
+		}
+	}
+}
+
+func newMessageID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (k *jupyterKernel) sign(parts ...[]byte) []byte {
+	if len(k.key) == 0 {
+		return []byte{}
+	}
+	mac := hmac.New(sha256.New, k.key)
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return []byte(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// decode reads a message off the wire, checking its signature.
+func (k *jupyterKernel) decode(frames [][]byte) (*jupyterMessage, error) {
+	i := 0
+	for i < len(frames) && string(frames[i]) != jupyterDelimiter {
+		i++
+	}
+	if len(frames) < i+6 {
+		return nil, errors.New("malformed message")
+	}
+	signature, parts := frames[i+1], frames[i+2:i+6]
+	if !hmac.Equal(signature, k.sign(parts...)) {
+		return nil, errors.New("bad signature")
+	}
+	m := &jupyterMessage{identities: frames[:i], header: parts[0]}
+	var header struct {
+		MsgType string `json:"msg_type"`
+	}
+	if err := json.Unmarshal(parts[0], &header); err != nil {
+		return nil, err
+	}
+	m.msgType = header.MsgType
+	if err := json.Unmarshal(parts[3], &m.content); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// encode puts a message of msgType answering parent on the wire, after
+// prefix.
+func (k *jupyterKernel) encode(prefix [][]byte, parent *jupyterMessage, msgType string, content interface{}) [][]byte {
+	header, _ := json.Marshal(map[string]string{
+		"msg_id":   newMessageID(),
+		"session":  k.session,
+		"username": "lambda",
+		"date":     time.Now().UTC().Format(time.RFC3339Nano),
+		"msg_type": msgType,
+		"version":  jupyterProtocolVersion,
+	})
+	body, _ := json.Marshal(content)
+	parts := [][]byte{header, parent.header, []byte("{}"), body}
+	frames := append(append([][]byte{}, prefix...), []byte(jupyterDelimiter), k.sign(parts...))
+	return append(frames, parts...)
+}
+
+func (k *jupyterKernel) publish(parent *jupyterMessage, msgType string, content interface{}) {
+	k.iopub.publish(k.encode([][]byte{[]byte(msgType)}, parent, msgType, content))
+}
+
+// serveRequests answers the requests of a shell or control connection,
+// reporting the kernel busy while it does.
+func (k *jupyterKernel) serveRequests(z *zmtpConn) {
+	for {
+		frames, err := z.receive()
+		if err != nil {
+			return
+		}
+		request, err := k.decode(frames)
+		if err != nil {
+			continue
+		}
+
+		k.publish(request, "status", map[string]string{"execution_state": "busy"})
+		replyType := strings.TrimSuffix(request.msgType, "_request") + "_reply"
+		content := k.handle(request)
+		if content != nil {
+			z.send(k.encode(request.identities, request, replyType, content))
+		}
+		k.publish(request, "status", map[string]string{"execution_state": "idle"})
+
+		if request.msgType == "shutdown_request" {
+			k.once.Do(func() { close(k.shutdown) })
+			return
+		}
+	}
+}
+
+func (k *jupyterKernel) handle(request *jupyterMessage) interface{} {
+	switch request.msgType {
+	case "kernel_info_request":
+		return map[string]interface{}{
+			"status":                 "ok",
+			"protocol_version":       jupyterProtocolVersion,
+			"implementation":         "lambda",
+			"implementation_version": "1",
+			"language_info": map[string]string{
+				"name":           "lambda",
+				"mimetype":       "text/x-lambda",
+				"file_extension": ".lam",
+			},
+			"banner":     "Untyped lambda calculus. Start a cell with %trace to see its reductions.",
+			"help_links": []interface{}{},
+		}
+	case "execute_request":
+		return k.execute(request)
+	case "is_complete_request":
+		return map[string]string{"status": "complete"}
+	case "complete_request":
+		return k.complete(request)
+	case "comm_info_request":
+		return map[string]interface{}{"status": "ok", "comms": map[string]interface{}{}}
+	case "history_request":
+		return map[string]interface{}{"status": "ok", "history": []interface{}{}}
+	case "interrupt_request":
+		k.cancelMu.Lock()
+		if k.cancel != nil {
+			k.cancel()
+		}
+		k.cancelMu.Unlock()
+		return map[string]interface{}{"status": "ok"}
+	case "shutdown_request":
+		restart, _ := request.content["restart"].(bool)
+		return map[string]interface{}{"status": "ok", "restart": restart}
+	}
+	return nil
+}
+
+// complete offers the defined names starting with the word before the
+// cursor.
+func (k *jupyterKernel) complete(request *jupyterMessage) interface{} {
+	code, _ := request.content["code"].(string)
+	cursor := len(code)
+	if position, ok := request.content["cursor_pos"].(float64); ok && int(position) <= len([]rune(code)) {
+		cursor = len(string([]rune(code)[:int(position)]))
+	}
+	start := cursor
+	for start > 0 && isNameByte(code[start-1]) {
+		start--
+	}
+	prefix := code[start:cursor]
+
+	k.runMu.Lock()
+	matches := []string{}
+	for name := range k.definitions {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	k.runMu.Unlock()
+	sort.Strings(matches)
+	return map[string]interface{}{
+		"status":       "ok",
+		"matches":      matches,
+		"cursor_start": len([]rune(code[:start])),
+		"cursor_end":   len([]rune(code[:cursor])),
+		"metadata":     map[string]interface{}{},
+	}
+}
+
+// execute runs a cell.
+func (k *jupyterKernel) execute(request *jupyterMessage) interface{} {
+	code, _ := request.content["code"].(string)
+	silent, _ := request.content["silent"].(bool)
+
+	k.runMu.Lock()
+	defer k.runMu.Unlock()
+	if !silent {
+		k.count++
+	}
+	count := k.count
+	k.publish(request, "execute_input", map[string]interface{}{"code": code, "execution_count": count})
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.server.maxTimeout)
+	defer cancel()
+	k.cancelMu.Lock()
+	k.cancel = cancel
+	k.cancelMu.Unlock()
+	defer func() {
+		k.cancelMu.Lock()
+		k.cancel = nil
+		k.cancelMu.Unlock()
+	}()
+
+	trace := false
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			if trimmed == "%trace" {
+				trace = true
+				lines[i] = ""
+			}
+			break
+		}
+	}
+
+	var text []string
+	var htmlText strings.Builder
+	for _, line := range parseLamFile(strings.Join(lines, "\n")) {
+		if line.err != nil {
+			return k.executeError(request, count, "SyntaxError", line.number, line.err)
+		}
+		expr := expandDefinitions(line.term, k.definitions)
+		if line.name != "" {
+			k.definitions[line.name] = withoutSpans(expr)
+			continue
+		}
+
+		var steps []tracedTerm
+		var observe func(expression, path)
+		if trace {
+			observe = func(before expression, at path) {
+				if len(steps) < maxJupyterTraceSteps {
+					steps = append(steps, tracedTerm{step: len(steps), term: before, redex: &redexLocation{Path: at}})
+				}
+			}
+		}
+		maxSteps := k.server.maxSteps
+		if maxSteps == 0 {
+			maxSteps = maxJupyterSteps
+		}
+		result, n, err := reduce(ctx, strategies[defaultStrategy], expr, maxSteps, observe)
+		switch {
+		case errors.Is(err, context.Canceled):
+			return k.executeError(request, count, "Interrupted", line.number, errors.New("evaluation interrupted"))
+		case errors.Is(err, context.DeadlineExceeded):
+			return k.executeError(request, count, "Timeout", line.number, fmt.Errorf("evaluation timed out after %s (%d steps)", k.server.maxTimeout, n))
+		case errors.Is(err, errStepLimit):
+			return k.executeError(request, count, "StepLimit", line.number, fmt.Errorf("evaluation stopped at the limit of %d steps", n))
+		case err != nil:
+			return k.executeError(request, count, "Error", line.number, err)
+		}
+
+		printed := printCompact(result)
+		if !trace {
+			text = append(text, printed)
+			htmlText.WriteString("<div><code>" + html.EscapeString(printed) + "</code></div>")
+			continue
+		}
+		text = append(text, fmt.Sprintf("%s  (%d steps)", printed, n))
+		htmlText.WriteString("<ol start=\"0\">")
+		for _, step := range steps {
+			htmlText.WriteString("<li><code>" + markRedex(step.term, step.redex.Path) + "</code></li>")
+		}
+		if n > len(steps) {
+			htmlText.WriteString(fmt.Sprintf("<li value=\"%d\">…</li>", n))
+		}
+		htmlText.WriteString(fmt.Sprintf("<li value=\"%d\"><code>%s</code></li></ol>", n, html.EscapeString(printed)))
+	}
+
+	if len(text) > 0 && !silent {
+		k.publish(request, "execute_result", map[string]interface{}{
+			"execution_count": count,
+			"data": map[string]string{
+				"text/plain": strings.Join(text, "\n"),
+				"text/html":  htmlText.String(),
+			},
+			"metadata": map[string]interface{}{},
+		})
+	}
+	return map[string]interface{}{
+		"status":           "ok",
+		"execution_count":  count,
+		"user_expressions": map[string]interface{}{},
+		"payload":          []interface{}{},
+	}
+}
+
+// executeError reports a cell that failed on a line, publishing the
+// error and returning the reply.
+func (k *jupyterKernel) executeError(request *jupyterMessage, count int, name string, line int, err error) interface{} {
+	traceback := []string{fmt.Sprintf("line %d: %v", line, err)}
+	var syntax *syntaxError
+	if errors.As(err, &syntax) && syntax.source != "" {
+		traceback = append(traceback, strings.Split(syntax.data().Rendered, "\n")[1:]...)
+	}
+	content := map[string]interface{}{
+		"ename":     name,
+		"evalue":    err.Error(),
+		"traceback": traceback,
+	}
+	k.publish(request, "error", content)
+	reply := map[string]interface{}{"status": "error", "execution_count": count}
+	for key, value := range content {
+		reply[key] = value
+	}
+	return reply
+}
+
+// markRedex prints expr in the compact style as HTML, with the redex at
+// at highlighted.
+func markRedex(expr expression, at path) string {
+	redex, ok := subtermAt(expr, at)
+	if !ok {
+		return html.EscapeString(printCompact(expr))
+	}
+	marked := "<mark>" + html.EscapeString(printCompact(redex)) + "</mark>"
+	if len(at) == 0 {
+		return marked
+	}
+
+	// The redex is printed in place of a placeholder no name can be,
+	// parenthesized as the placeholder would not be.
+	const placeholder = "\x00"
+	outer, _ := replaceAt(expr, at, &variable{name: placeholder})
+	parts := strings.SplitN(printCompact(outer), placeholder, 2)
+	return html.EscapeString(parts[0]) + "(" + marked + ")" + html.EscapeString(parts[1])
+}
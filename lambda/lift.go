@@ -0,0 +1,99 @@
+package lambda
+
+import "sort"
+
+// A supercombinator is a closed top-level definition produced by
+// lambda lifting.
+type supercombinator struct {
+	Name       string   `json:"name"`
+	Parameters []string `json:"parameters"`
+	Body       string   `json:"body"`
+}
+
+// lift performs lambda lifting on an expression: every abstraction
+// becomes a supercombinator taking the variables it captured as extra
+// leading parameters, and is replaced by that supercombinator applied
+// to them. Free variables of the whole expression are left as globals.
+func (c *connection) lift(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	l := &lifter{used: allNames(expr), globals: freeVariables(expr)}
+	lifted := l.lift(expr)
+
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Definitions []supercombinator `json:"definitions"`
+			Main        string            `json:"main"`
+		}{
+			Definitions: l.definitions,
+			Main:        lifted.String(),
+		},
+	}
+}
+
+type lifter struct {
+	used    map[string]bool
+	globals map[string]bool
+
+	// definitions are in the order lifted, so each one only refers to
+	// those before it.
+	definitions []supercombinator
+}
+
+func (l *lifter) lift(expr expression) expression {
+	switch e := expr.(type) {
+	case *variable:
+		return e
+	case *application:
+		return apply(l.lift(e.left), l.lift(e.right))
+	case *abstraction:
+		// Lift a run of nested abstractions as one supercombinator.
+		var parameters []string
+		var body expression = e
+		for {
+			abs, ok := body.(*abstraction)
+			if !ok {
+				break
+			}
+			parameters = append(parameters, abs.parameter.name)
+			body = abs.body
+		}
+		body = l.lift(body)
+
+		bound := map[string]bool{}
+		for _, p := range parameters {
+			bound[p] = true
+		}
+		var captured []string
+		for name := range freeVariables(body) {
+			if !bound[name] && !l.globals[name] {
+				captured = append(captured, name)
+			}
+		}
+		sort.Strings(captured)
+
+		name := freshName("sc", l.used)
+		l.used[name] = true
+		l.globals[name] = true
+		l.definitions = append(l.definitions, supercombinator{
+			Name:       name,
+			Parameters: append(captured, parameters...),
+			Body:       body.String(),
+		})
+
+		var call expression = &variable{name, span{}}
+		for _, v := range captured {
+			call = apply(call, &variable{v, span{}})
+		}
+		return call
+	}
+	panic("Invalid expression")
+}
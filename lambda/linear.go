@@ -0,0 +1,101 @@
+package lambda
+
+import "fmt"
+
+// A linearityViolation is a binder whose variable is used other than
+// the mode allows: never, where linear terms need exactly one use, or
+// more than once.
+type linearityViolation struct {
+	Binder  string `json:"binder"`
+	Uses    int    `json:"uses"`
+	Message string `json:"message"`
+	Path    path   `json:"path"`
+
+	// Span is that of the binder, and Occurrences locate each use.
+	Span        span                  `json:"span"`
+	Occurrences []linearityOccurrence `json:"occurrences"`
+}
+
+type linearityOccurrence struct {
+	Path path `json:"path"`
+	Span span `json:"span"`
+}
+
+// checkLinear reports whether each bound variable of an expression is
+// used exactly once or, with affine, at most once, listing the binders
+// that are not.
+func (c *connection) checkLinear(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	affine, _ := params["affine"].(bool)
+	mode := "linear"
+	if affine {
+		mode = "affine"
+	}
+
+	violations := linearityViolations(expr, affine)
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Mode       string               `json:"mode"`
+			Valid      bool                 `json:"valid"`
+			Violations []linearityViolation `json:"violations"`
+		}{mode, len(violations) == 0, violations},
+	}
+}
+
+func linearityViolations(expr expression, affine bool) []linearityViolation {
+	violations := []linearityViolation{}
+	var walk func(expression, path, map[string]*[]linearityOccurrence)
+	walk = func(expr expression, at path, scope map[string]*[]linearityOccurrence) {
+		switch e := expr.(type) {
+		case *variable:
+			if uses, ok := scope[e.name]; ok {
+				*uses = append(*uses, linearityOccurrence{append(path{}, at...), e.span})
+			}
+		case *abstraction:
+			name := e.parameter.name
+			uses := []linearityOccurrence{}
+			outer, shadowed := scope[name]
+			scope[name] = &uses
+			// Violations are listed binder by binder in source order,
+			// so this one goes before those inside the body.
+			index := len(violations)
+			walk(e.body, append(at, 0), scope)
+			if shadowed {
+				scope[name] = outer
+			} else {
+				delete(scope, name)
+			}
+
+			var message string
+			switch {
+			case len(uses) > 1:
+				message = fmt.Sprintf("%s is used %d times", name, len(uses))
+			case len(uses) == 0 && !affine:
+				message = fmt.Sprintf("%s is never used", name)
+			default:
+				return
+			}
+			violations = append(violations[:index], append([]linearityViolation{{
+				Binder:      name,
+				Uses:        len(uses),
+				Message:     message,
+				Path:        append(path{}, at...),
+				Span:        e.parameter.span,
+				Occurrences: uses,
+			}}, violations[index:]...)...)
+		case *application:
+			walk(e.left, append(at, 0), scope)
+			walk(e.right, append(at, 1), scope)
+		}
+	}
+	walk(expr, path{}, map[string]*[]linearityOccurrence{})
+	return violations
+}
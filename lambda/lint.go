@@ -0,0 +1,140 @@
+package lambda
+
+import "fmt"
+
+type lintFinding struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Path     path   `json:"path"`
+	Span     span   `json:"span"`
+}
+
+// Lint severities, from least to most serious.
+const (
+	severityInfo    = "info"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// lint reports suspicious patterns in an expression without evaluating
+// it.
+func (s *Server) lint(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	source, ok := params["expression"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid expression parameter")
+	}
+	expr, err := parseLambdaExpression(source)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Findings []lintFinding `json:"findings"`
+		}{
+			Findings: lintExpression(expr),
+		},
+	}
+}
+
+func lintExpression(expr expression) []lintFinding {
+	findings := []lintFinding{}
+	report := func(severity, code string, node expression, at path, format string, args ...interface{}) {
+		findings = append(findings, lintFinding{
+			Severity: severity,
+			Code:     code,
+			Message:  fmt.Sprintf(format, args...),
+			Path:     append(path{}, at...),
+			Span:     spanOf(node),
+		})
+	}
+
+	var walk func(expression, path, []string)
+	walk = func(expr expression, at path, scope []string) {
+		switch e := expr.(type) {
+		case *variable:
+			if bindingDepth(scope, e.name) >= 0 {
+				return
+			}
+			if similar := similarName(e.name, scope); similar != "" {
+				report(severityWarning, "possibleTypo", e, at, "free variable %s looks like a typo of %s", e.name, similar)
+			}
+		case *abstraction:
+			name := e.parameter.name
+			if bindingDepth(scope, name) >= 0 {
+				report(severityWarning, "shadowedBinder", e, at, "binder %s shadows an outer %s", name, name)
+			}
+			if occurrences(e.body, name) == 0 {
+				report(severityInfo, "unusedBinder", e, at, "binder %s is never used", name)
+			}
+			walk(e.body, append(at, 0), append(scope, name))
+		case *application:
+			fn, ok := e.left.(*abstraction)
+			arg, argOK := e.right.(*abstraction)
+			if ok && argOK && selfApplies(fn) && selfApplies(arg) {
+				report(severityError, "divergent", e, at, "%s has no normal form", e)
+			}
+			walk(e.left, append(at, 0), scope)
+			walk(e.right, append(at, 1), scope)
+		}
+	}
+	walk(expr, path{}, nil)
+	return findings
+}
+
+// similarName returns a name from scope that name is probably a
+// misspelling of, or "" if there is none. Names of one character are
+// never considered typos of each other.
+func similarName(name string, scope []string) string {
+	for i := len(scope) - 1; i >= 0; i-- {
+		candidate := scope[i]
+		if len(candidate) < 2 && len(name) < 2 {
+			continue
+		}
+		limit := 1
+		if len(candidate) >= 6 {
+			limit = 2
+		}
+		if editDistance(name, candidate) <= limit {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
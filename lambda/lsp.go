@@ -0,0 +1,451 @@
+package lambda
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bounds on the normal forms shown on hover, which must come back
+// quickly.
+const (
+	hoverMaxSize    = 200
+	hoverMaxSteps   = 1000
+	hoverMaxTimeout = 100 * time.Millisecond
+)
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+// Diagnostic severities of the Language Server Protocol, by lint
+// severity.
+var lspSeverities = map[string]int{
+	severityError:   1,
+	severityWarning: 2,
+	severityInfo:    3,
+}
+
+// lspServer is the state of one language server session: the open
+// documents, by URI.
+type lspServer struct {
+	reader *textproto.Reader
+	writer io.Writer
+
+	writeMu sync.Mutex
+
+	documents map[string]string
+	shutdown  bool
+}
+
+// ServeLSP speaks the Language Server Protocol on r and w for .lam
+// files: it reports syntax errors and lint findings, shows the normal
+// form of small subterms on hover, jumps from a name to the line
+// defining it and formats documents.
+func (s *Server) ServeLSP(r io.Reader, w io.Writer) error {
+	l := &lspServer{
+		reader:    textproto.NewReader(bufio.NewReader(r)),
+		writer:    w,
+		documents: map[string]string{},
+	}
+	for {
+		body, err := readFramed(l.reader, s.maxMessageBytes)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var message lspMessage
+		if err := json.Unmarshal(body, &message); err != nil {
+			return fmt.Errorf("decoding message: %w", err)
+		}
+		if message.Method == "exit" {
+			return nil
+		}
+		if message.ID == nil {
+			l.notification(message)
+			continue
+		}
+		result, err := l.request(message)
+		response := lspMessage{JSONRPC: "2.0", ID: message.ID, Result: result}
+		if err != nil {
+			response.Result = nil
+			response.Error = &Error{Code: codeInvalidParams, Message: err.Error()}
+		} else if result == nil {
+			response.Result = json.RawMessage("null")
+		}
+		l.send(response)
+	}
+}
+
+func (l *lspServer) send(message lspMessage) {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+	body, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	writeFramed(l.writer, body)
+}
+
+func (l *lspServer) notification(message lspMessage) {
+	switch message.Method {
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(message.Params, &params) == nil {
+			l.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		// Documents are synchronized in full, so the last change holds
+		// the whole text.
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if json.Unmarshal(message.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			l.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(message.Params, &params) == nil {
+			delete(l.documents, params.TextDocument.URI)
+		}
+	}
+}
+
+func (l *lspServer) request(message lspMessage) (interface{}, error) {
+	if l.shutdown {
+		return nil, errors.New("the server is shutting down")
+	}
+	switch message.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1,
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]interface{}{"name": "lambda"},
+		}, nil
+	case "shutdown":
+		l.shutdown = true
+		return nil, nil
+	case "textDocument/hover":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, err
+		}
+		return l.hover(params), nil
+	case "textDocument/definition":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, err
+		}
+		return l.definition(params), nil
+	case "textDocument/formatting":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, err
+		}
+		return l.formatting(params.TextDocument.URI), nil
+	}
+	return nil, fmt.Errorf("unsupported method %q", message.Method)
+}
+
+// update stores a document and publishes its diagnostics.
+func (l *lspServer) update(uri, text string) {
+	l.documents[uri] = text
+	lines := strings.Split(text, "\n")
+
+	diagnostics := []lspDiagnostic{}
+	for _, line := range parseLamFile(text) {
+		if line.err != nil {
+			offset := len(line.source)
+			var syntax *syntaxError
+			if errors.As(line.err, &syntax) {
+				offset = syntax.offset
+			}
+			message := line.err.Error()
+			if syntax != nil {
+				message = syntax.message
+			}
+			diagnostics = append(diagnostics, lspDiagnostic{
+				Range:    lineRange(lines, line, span{offset, offset + 1}),
+				Severity: lspSeverities[severityError],
+				Source:   "lambda",
+				Message:  message,
+			})
+			continue
+		}
+		for _, finding := range lintExpression(line.term) {
+			diagnostics = append(diagnostics, lspDiagnostic{
+				Range:    lineRange(lines, line, finding.Span),
+				Severity: lspSeverities[finding.Severity],
+				Code:     finding.Code,
+				Source:   "lambda",
+				Message:  finding.Message,
+			})
+		}
+	}
+
+	params, _ := json.Marshal(map[string]interface{}{"uri": uri, "diagnostics": diagnostics})
+	l.send(lspMessage{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+// at returns the line of a document under position and the byte offset
+// of position within its source.
+func (l *lspServer) at(uri string, position lspPosition) (lamLine, int, bool) {
+	text, ok := l.documents[uri]
+	if !ok {
+		return lamLine{}, 0, false
+	}
+	texts := strings.Split(text, "\n")
+	for _, line := range parseLamFile(text) {
+		if line.number-1 != position.Line {
+			continue
+		}
+		offset := byteOffset(texts[position.Line], position.Character) - line.column
+		if offset < 0 || offset > len(line.source) {
+			return lamLine{}, 0, false
+		}
+		return line, offset, true
+	}
+	return lamLine{}, 0, false
+}
+
+// hover shows the subterm under the cursor, with its normal form when
+// it is small and reaches one quickly.
+func (l *lspServer) hover(params lspTextDocumentPosition) interface{} {
+	line, offset, ok := l.at(params.TextDocument.URI, params.Position)
+	if !ok || line.err != nil {
+		return nil
+	}
+	p, ok := innermostAt(line.term, offset)
+	if !ok {
+		return nil
+	}
+	subterm, _ := subtermAt(line.term, p)
+	expanded, _ := subtermAt(line.expr, p)
+
+	contents := "```lambda\n" + printCompact(subterm) + "\n```"
+	if expanded != nil && termSize(expanded) <= hoverMaxSize {
+		ctx, cancel := context.WithTimeout(context.Background(), hoverMaxTimeout)
+		defer cancel()
+		if normal, steps, err := reduce(ctx, normalOrder{}, expanded, hoverMaxSteps, nil); err == nil {
+			contents += fmt.Sprintf("\n\nNormal form in %d steps:\n\n```lambda\n%s\n```", steps, printCompact(normal))
+		}
+	}
+
+	texts := strings.Split(l.documents[params.TextDocument.URI], "\n")
+	return map[string]interface{}{
+		"contents": map[string]interface{}{"kind": "markdown", "value": contents},
+		"range":    lineRange(texts, line, spanOf(subterm)),
+	}
+}
+
+// definition locates the line defining the free name under the cursor.
+func (l *lspServer) definition(params lspTextDocumentPosition) interface{} {
+	uri := params.TextDocument.URI
+	line, offset, ok := l.at(uri, params.Position)
+	if !ok || line.err != nil {
+		return nil
+	}
+	p, ok := innermostAt(line.term, offset)
+	if !ok {
+		return nil
+	}
+	subterm, _ := subtermAt(line.term, p)
+	v, ok := subterm.(*variable)
+	if !ok || bindingDepth(scopeAt(line.term, p), v.name) >= 0 {
+		return nil
+	}
+
+	var found *lamLine
+	for _, candidate := range parseLamFile(l.documents[uri]) {
+		if candidate.number >= line.number {
+			break
+		}
+		if candidate.name == v.name && candidate.err == nil {
+			candidate := candidate
+			found = &candidate
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	texts := strings.Split(l.documents[uri], "\n")
+	return map[string]interface{}{
+		"uri":   uri,
+		"range": lineRange(texts, *found, span{0, len(found.source)}),
+	}
+}
+
+// formatting reprints every term of a document as Format does,
+// leaving lines that do not parse alone.
+func (l *lspServer) formatting(uri string) interface{} {
+	text, ok := l.documents[uri]
+	if !ok {
+		return nil
+	}
+	texts := strings.Split(text, "\n")
+	edits := []lspTextEdit{}
+	for _, line := range parseLamFile(text) {
+		if line.err != nil {
+			continue
+		}
+		formatted := formatTerm(line.term)
+		if line.name != "" {
+			formatted = line.name + " = " + formatted
+		}
+		original := strings.TrimRight(texts[line.number-1], "\r")
+		if formatted == original {
+			continue
+		}
+		edits = append(edits, lspTextEdit{
+			Range: lspRange{
+				Start: lspPosition{Line: line.number - 1},
+				End:   lspPosition{Line: line.number - 1, Character: utf16Length(original)},
+			},
+			NewText: formatted,
+		})
+	}
+	return edits
+}
+
+// innermostAt returns the path to the smallest subterm of expr whose
+// span contains offset.
+func innermostAt(expr expression, offset int) (path, bool) {
+	s := spanOf(expr)
+	if offset < s.Start || offset >= s.End {
+		return nil, false
+	}
+	at := path{}
+	for {
+		var children []expression
+		switch e := expr.(type) {
+		case *abstraction:
+			children = []expression{e.body}
+		case *application:
+			children = []expression{e.left, e.right}
+		}
+		descended := false
+		for i, child := range children {
+			if s := spanOf(child); offset >= s.Start && offset < s.End {
+				at = append(at, i)
+				expr = child
+				descended = true
+				break
+			}
+		}
+		if !descended {
+			return at, true
+		}
+	}
+}
+
+// lineRange converts a span of line's source to a range of the
+// document. Positions count UTF-16 code units, as the protocol
+// requires.
+func lineRange(texts []string, line lamLine, s span) lspRange {
+	text := texts[line.number-1]
+	start, end := line.column+s.Start, line.column+s.End
+	if end > len(text) {
+		end = len(text)
+	}
+	if start > end {
+		start = end
+	}
+	return lspRange{
+		Start: lspPosition{Line: line.number - 1, Character: utf16Length(text[:start])},
+		End:   lspPosition{Line: line.number - 1, Character: utf16Length(text[:end])},
+	}
+}
+
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// byteOffset converts a column in UTF-16 code units to a byte offset
+// of text.
+func byteOffset(text string, character int) int {
+	units := 0
+	for i, r := range text {
+		if units >= character {
+			return i
+		}
+		units++
+		if r >= 0x10000 {
+			units++
+		}
+	}
+	return len(text)
+}
@@ -0,0 +1,210 @@
+package lambda
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Macros are definitions expanded before evaluation rather than during
+// it: a use of a macro applied to arguments is replaced by the macro's
+// body with the arguments substituted for its leading parameters, so
+// the beta steps of passing them are not taken at run time. Expansion
+// is hygienic: substitution renames the macro's binders that would
+// capture a free variable of an argument, and binders at the use site
+// that would capture a free variable of the macro are renamed first.
+
+// macroExpansion expands the macros of a term, counting the
+// substitutions made.
+type macroExpansion struct {
+	macros map[string]expression
+
+	// free holds the variables free in any macro.
+	free  map[string]bool
+	steps int
+}
+
+func newMacroExpansion(macros map[string]expression) *macroExpansion {
+	free := map[string]bool{}
+	for _, body := range macros {
+		for name := range freeVariables(body) {
+			free[name] = true
+		}
+	}
+	return &macroExpansion{macros: macros, free: free}
+}
+
+func (m *macroExpansion) expand(expr expression) expression {
+	return m.walk(expr, map[string]bool{})
+}
+
+// walk expands the macros in expr, under binders bound.
+func (m *macroExpansion) walk(expr expression, bound map[string]bool) expression {
+	switch e := expr.(type) {
+	case *variable:
+		return m.use(e, nil, nil, bound)
+	case *abstraction:
+		parameter, body := e.parameter, e.body
+		if m.free[parameter.name] {
+			used := freeVariables(body)
+			for name := range m.free {
+				used[name] = true
+			}
+			renamed := variable{freshName(parameter.name, used), parameter.span}
+			body = substitute(body, parameter, &variable{renamed.name, renamed.span})
+			parameter = renamed
+		}
+		inner := make(map[string]bool, len(bound)+1)
+		for name := range bound {
+			inner[name] = true
+		}
+		inner[parameter.name] = true
+		return &abstraction{parameter, m.walk(body, inner), e.span}
+	case *application:
+		// Collect the application spine, so that a macro at its head
+		// gets all of its arguments. spans[i] is that of the
+		// application to args[i].
+		var args []expression
+		var spans []span
+		head := expression(e)
+		for {
+			app, ok := head.(*application)
+			if !ok {
+				break
+			}
+			args = append([]expression{app.right}, args...)
+			spans = append([]span{app.span}, spans...)
+			head = app.left
+		}
+		for i, arg := range args {
+			args[i] = m.walk(arg, bound)
+		}
+		if v, ok := head.(*variable); ok {
+			return m.use(v, args, spans, bound)
+		}
+		return applyAll(m.walk(head, bound), args, spans)
+	}
+	return expr
+}
+
+// use expands v applied to the already expanded args if v names a
+// macro not shadowed by a binder in bound.
+func (m *macroExpansion) use(v *variable, args []expression, spans []span, bound map[string]bool) expression {
+	macro, ok := m.macros[v.name]
+	if !ok || bound[v.name] {
+		return applyAll(v, args, spans)
+	}
+	result := macro
+	for len(args) > 0 {
+		fn, ok := result.(*abstraction)
+		if !ok {
+			break
+		}
+		result = substitute(fn.body, fn.parameter, args[0])
+		args, spans = args[1:], spans[1:]
+		m.steps++
+	}
+	return applyAll(result, args, spans)
+}
+
+// applyAll applies fn to args in turn, the application to args[i]
+// spanning spans[i].
+func applyAll(fn expression, args []expression, spans []span) expression {
+	for i, arg := range args {
+		fn = &application{fn, arg, spans[i]}
+	}
+	return fn
+}
+
+// macrosWithDefinitions expands definitions in the bodies of macros.
+// They must be in place before the macros are, as expansion renames
+// binders around the free variables of the macros.
+func macrosWithDefinitions(macros, definitions map[string]expression) map[string]expression {
+	if len(definitions) == 0 {
+		return macros
+	}
+	expanded := make(map[string]expression, len(macros))
+	for name, macro := range macros {
+		expanded[name] = expandDefinitions(macro, definitions)
+	}
+	return expanded
+}
+
+// splitMacro splits `defmacro name = expression`, as an entry of a
+// multi-expression request may be, into its name and expression.
+func splitMacro(source string) (string, string, bool) {
+	rest := strings.TrimLeft(source, " \t\r\n")
+	if !strings.HasPrefix(rest, "defmacro") {
+		return "", "", false
+	}
+	rest = rest[len("defmacro"):]
+	if rest == "" || !strings.ContainsRune(" \t", rune(rest[0])) {
+		return "", "", false
+	}
+	return splitDefinition(rest)
+}
+
+// macrosParam reads the optional macros parameter, a map of names to
+// expressions like definitions, whose leading abstractions are the
+// macro's parameters. Macros may use one another, but not recursively.
+func (c *connection) macrosParam(params map[string]interface{}) (map[string]expression, error) {
+	raw, present := params["macros"]
+	if !present {
+		return nil, nil
+	}
+	sources, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Invalid macros parameter")
+	}
+	parse, err := c.syntaxParam(params)
+	if err != nil {
+		return nil, err
+	}
+	parsed := map[string]expression{}
+	for name, value := range sources {
+		if !validName(name) {
+			return nil, fmt.Errorf("Invalid macros parameter: bad name %q", name)
+		}
+		source, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("Invalid macros parameter: %s is not a string", name)
+		}
+		expr, _, err := parse(source, c.resolve)
+		if err != nil {
+			return nil, fmt.Errorf("macros: %s: %w", name, err)
+		}
+		parsed[name] = withoutSpans(expr)
+	}
+	return expandMacroBodies(parsed)
+}
+
+// expandMacroBodies expands the macros used in the bodies of macros.
+func expandMacroBodies(parsed map[string]expression) (map[string]expression, error) {
+	expanded := map[string]expression{}
+	expanding := map[string]bool{}
+	var expand func(name string) error
+	expand = func(name string) error {
+		if _, done := expanded[name]; done {
+			return nil
+		}
+		if expanding[name] {
+			return fmt.Errorf("Invalid macros parameter: %s expands to itself", name)
+		}
+		expanding[name] = true
+		for free := range freeVariables(parsed[name]) {
+			if _, ok := parsed[free]; ok {
+				if err := expand(free); err != nil {
+					return err
+				}
+			}
+		}
+		expanded[name] = newMacroExpansion(expanded).expand(parsed[name])
+		return nil
+	}
+	for name := range parsed {
+		if err := expand(name); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,25 @@
+package lambda
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// metricsMethod reports server-wide gauges and counters.
+func (s *Server) metricsMethod(request Request) Response {
+	return Response{
+		ID: request.ID,
+		Result: map[string]interface{}{
+			"liveHandles":    s.handles.live(),
+			"cpuMs":          milliseconds(time.Duration(atomic.LoadInt64(&s.cpuTime))),
+			"acceptFailures": atomic.LoadInt64(&s.acceptFailures),
+			"tenantUsage":    s.quota.all(),
+		},
+	}
+}
+
+// AcceptFailed counts a failure to accept a connection, for the
+// metrics method.
+func (s *Server) AcceptFailed() {
+	atomic.AddInt64(&s.acceptFailures, 1)
+}
@@ -0,0 +1,215 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oleiade/lane"
+)
+
+const (
+	defaultMinimizeCandidates = 2000
+	maxMinimizeCandidates     = 100000
+
+	// minimizeGrowth bounds the candidates to this many times the size
+	// of the input, as some terms only shrink after growing a little.
+	minimizeGrowth = 2
+)
+
+// An identity is a known equality between closed terms, used by
+// minimize to replace one side by the smaller other in one rewrite
+// where beta and eta would take several, some of them growing the term.
+type identity struct {
+	name     string
+	from, to expression
+
+	// hash and size are those of from, the side replaced.
+	hash string
+	size int
+}
+
+var identities = func() []identity {
+	var all []identity
+	for _, rule := range [][3]string{
+		{"S K K = I", `(\x y z.x z (y z)) (\x y.x) (\x y.x)`, `\x.x`},
+		{"S K S = I", `(\x y z.x z (y z)) (\x y.x) (\x y z.x z (y z))`, `\x.x`},
+		{"S K = K I", `(\x y z.x z (y z)) (\x y.x)`, `\x y.y`},
+		{"C K = K I", `(\f x y.f y x) (\x y.x)`, `\x y.y`},
+		{"B I = I", `(\f g x.f (g x)) (\x.x)`, `\x.x`},
+		{"W K = I", `(\f x.f x x) (\x y.x)`, `\x.x`},
+		{"C (C f) = f", `\f.(\f x y.f y x) ((\f x y.f y x) f)`, `\f.f`},
+		{"S (K f) I = f", `\f.(\x y z.x z (y z)) ((\x y.x) f) (\x.x)`, `\f.f`},
+	} {
+		from, err := parseLambdaExpression(rule[1])
+		if err != nil {
+			panic(err)
+		}
+		to, err := parseLambdaExpression(rule[2])
+		if err != nil {
+			panic(err)
+		}
+		from, to = withoutSpans(from), withoutSpans(to)
+		all = append(all, identity{rule[0], from, to, termHash(from), termSize(from)})
+	}
+	return all
+}()
+
+type minimizeResult struct {
+	Expression   string `json:"expression"`
+	Size         int    `json:"size"`
+	OriginalSize int    `json:"originalSize"`
+
+	// Rewrites lead from the input to the result.
+	Rewrites []minimizeRewrite `json:"rewrites"`
+
+	// Exhausted is set when every term within reach was tried, rather
+	// than the search stopping at its bound.
+	Exhausted bool `json:"exhausted"`
+}
+
+// A minimizeRewrite is the rule, beta, eta or the name of an identity,
+// applied to the subterm at Path.
+type minimizeRewrite struct {
+	Rule string `json:"rule"`
+	Path path   `json:"path"`
+}
+
+// A candidate is a term minimize reached, with the rewrite that led to
+// it from parent.
+type candidate struct {
+	term    expression
+	size    int
+	parent  *candidate
+	rewrite minimizeRewrite
+}
+
+func (c *candidate) rewrites() []minimizeRewrite {
+	rewrites := []minimizeRewrite{}
+	for ; c.parent != nil; c = c.parent {
+		rewrites = append([]minimizeRewrite{c.rewrite}, rewrites...)
+	}
+	return rewrites
+}
+
+// minimize searches for the smallest term beta-eta equivalent to an
+// expression that beta and eta contractions anywhere in it and the
+// identities reach, trying the smallest candidates first. The search
+// is bounded by maxCandidates and the timeout; the smallest term found
+// is returned either way.
+func (c *connection) minimize(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxCandidates, present, err := positiveInt(params, "maxCandidates")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if !present {
+		maxCandidates = defaultMinimizeCandidates
+	}
+	if maxCandidates > maxMinimizeCandidates {
+		return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid maxCandidates parameter: at most %d", maxMinimizeCandidates))
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	expr = withoutSpans(expr)
+	best, tried, exhausted := minimizeTerm(ctx, expr, maxCandidates)
+	return Response{
+		ID: request.ID,
+		Result: minimizeResult{
+			Expression:   best.term.String(),
+			Size:         best.size,
+			OriginalSize: termSize(expr),
+			Rewrites:     best.rewrites(),
+			Exhausted:    exhausted,
+		},
+		Meta: map[string]interface{}{"steps": tried},
+	}
+}
+
+// minimizeTerm runs the search of minimize, returning the smallest
+// candidate, how many rewrites it tried and whether it ran out of
+// candidates. It stops early once ctx is done.
+func minimizeTerm(ctx context.Context, expr expression, maxCandidates int) (*candidate, int, bool) {
+	start := &candidate{term: expr, size: termSize(expr)}
+	limit := minimizeGrowth * start.size
+
+	queue := lane.NewPQueue(lane.MINPQ)
+	queue.Push(start, start.size)
+	seen := map[string]bool{termHash(expr): true}
+	best, tried := start, 0
+	for queue.Size() > 0 {
+		if len(seen) >= maxCandidates || ctx.Err() != nil {
+			return best, tried, false
+		}
+		value, _ := queue.Pop()
+		current := value.(*candidate)
+		if current.size < best.size {
+			best = current
+		}
+		for _, next := range rewrites(current.term) {
+			tried++
+			hash := termHash(next.term)
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			next.size = termSize(next.term)
+			if next.size > limit {
+				continue
+			}
+			next.parent = current
+			queue.Push(next, next.size)
+		}
+	}
+	return best, tried, true
+}
+
+// rewrites lists the terms one beta or eta contraction or identity away
+// from expr.
+func rewrites(expr expression) []*candidate {
+	var found []*candidate
+	var walk func(expression, path)
+	walk = func(sub expression, at path) {
+		rewrite := func(rule string, replacement expression) {
+			if term, ok := replaceAt(expr, at, replacement); ok {
+				found = append(found, &candidate{term: term, rewrite: minimizeRewrite{rule, append(path{}, at...)}})
+			}
+		}
+		switch e := sub.(type) {
+		case *abstraction:
+			// λx.M x, with x not free in M, is M.
+			if app, ok := e.body.(*application); ok {
+				if v, ok := app.right.(*variable); ok && v.name == e.parameter.name && !freeVariables(app.left)[v.name] {
+					rewrite("eta", app.left)
+				}
+			}
+			walk(e.body, append(at, 0))
+		case *application:
+			if fn, ok := e.left.(*abstraction); ok {
+				rewrite("beta", substitute(fn.body, fn.parameter, e.right))
+			}
+			walk(e.left, append(at, 0))
+			walk(e.right, append(at, 1))
+		}
+		size := termSize(sub)
+		for _, id := range identities {
+			if id.size == size && termHash(sub) == id.hash {
+				rewrite(id.name, id.to)
+			}
+		}
+	}
+	walk(expr, path{})
+	return found
+}
@@ -0,0 +1,36 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+)
+
+// TestIdentities checks that each identity minimize uses holds: the
+// beta normal form of its left side eta-reduces to its right side.
+func TestIdentities(t *testing.T) {
+	for _, id := range identities {
+		normal, _, err := normalize(context.Background(), id.from)
+		if err != nil {
+			t.Fatalf("%s: %v", id.name, err)
+		}
+		if reduced := etaNormalize(normal); !alphaEquivalent(reduced, id.to) {
+			t.Errorf("%s: the left side reduces to %s, want %s", id.name, reduced, id.to)
+		}
+	}
+}
+
+func etaNormalize(expr expression) expression {
+	switch e := expr.(type) {
+	case *abstraction:
+		body := etaNormalize(e.body)
+		if app, ok := body.(*application); ok {
+			if v, ok := app.right.(*variable); ok && v.name == e.parameter.name && !freeVariables(app.left)[v.name] {
+				return app.left
+			}
+		}
+		return &abstraction{e.parameter, body, e.span}
+	case *application:
+		return &application{etaNormalize(e.left), etaNormalize(e.right), e.span}
+	}
+	return expr
+}
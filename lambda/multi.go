@@ -0,0 +1,100 @@
+package lambda
+
+import (
+	"fmt"
+
+	"example.com/rpc"
+)
+
+// A multiResult is the outcome of one of the expressions of a
+// multi-expression evaluate request: a definition, or an evaluation's
+// result or error with its meta.
+type multiResult struct {
+	Defined string                 `json:"defined,omitempty"`
+	Result  interface{}            `json:"result,omitempty"`
+	Error   *rpc.Error             `json:"error,omitempty"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+}
+
+// evaluateMany serves an evaluate request whose expressions parameter
+// lists several expressions, evaluated in order with the other params.
+// As in a .lam file, an entry `name = expression` defines name for the
+// entries after it instead of being evaluated, and `defmacro name =
+// expression` defines a macro; the definitions last only for the
+// request. An entry that fails does not stop the others.
+func (s *Server) evaluateMany(c *connection, request Request, params map[string]interface{}) Response {
+	sources, ok := params["expressions"].([]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid expressions parameter")
+	}
+	if _, present := params["expression"]; present {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid expression parameter: give expression or expressions, not both")
+	}
+	definitions, err := c.definitionsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if definitions == nil {
+		definitions = map[string]expression{}
+	}
+	macros, err := c.macrosParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if macros == nil {
+		macros = map[string]expression{}
+	}
+	parse, err := c.syntaxParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	// Each entry is evaluated as a request of its own, with the other
+	// params.
+	entry := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if key != "expressions" && key != "definitions" && key != "macros" {
+			entry[key] = value
+		}
+	}
+
+	results := make([]multiResult, len(sources))
+	steps := 0
+	for i, raw := range sources {
+		source, ok := raw.(string)
+		if !ok {
+			return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid expressions parameter: entry %d is not a string", i))
+		}
+
+		if blanked, err := blankComments(source); err == nil {
+			if name, rest, ok := splitMacro(blanked); ok {
+				expr, _, err := parse(source[len(source)-len(rest):], c.resolve)
+				if err != nil {
+					results[i].Error = invalidParams(request.ID, err).Error
+					continue
+				}
+				macros[name] = withoutSpans(newMacroExpansion(macros).expand(expr))
+				results[i].Defined = name
+				continue
+			}
+			if name, rest, ok := splitDefinition(blanked); ok {
+				expr, _, err := parse(source[len(source)-len(rest):], c.resolve)
+				if err != nil {
+					results[i].Error = invalidParams(request.ID, err).Error
+					continue
+				}
+				definitions[name] = withoutSpans(expandDefinitions(expr, definitions))
+				results[i].Defined = name
+				continue
+			}
+		}
+
+		entry["expression"] = source
+		response := s.evaluateWith(c, Request{ID: request.ID, Method: request.Method, Params: entry}, entry, definitions, macros)
+		results[i] = multiResult{Result: response.Result, Error: response.Error, Meta: response.Meta}
+		if n, ok := response.Meta["steps"].(int); ok {
+			steps += n
+		}
+	}
+	return Response{ID: request.ID, Result: results, Meta: map[string]interface{}{"steps": steps}}
+}
@@ -0,0 +1,372 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// This file holds an experimental optimal reduction engine, after
+// Lamping: a term is translated to an interaction net of abstraction,
+// application, duplicator and eraser nodes, and the net is rewritten
+// until no active pair is left. Redexes are never copied, only shared,
+// so the number of beta interactions can be far below the number of
+// steps any strategy on terms needs.
+//
+// Duplicators get a fresh label per occurrence in the source, without
+// the bookkeeping (brackets and croissants) of the full algorithm. That
+// is sound for terms typable in elementary affine logic but can read
+// back garbage otherwise, which is why the engine sits behind the
+// -experimental-optimal flag.
+
+type netKind uint8
+
+const (
+	netRoot netKind = iota
+	netLambda
+	netApply
+	netDup
+	netErase
+	netFree
+)
+
+// A netNode has a principal port 0 and, for binary nodes, auxiliary
+// ports 1 and 2. An abstraction's port 1 is its variable and port 2
+// its body; an application's port 1 is its argument and port 2 its
+// result.
+type netNode struct {
+	kind  netKind
+	label int
+	name  string
+	ports [3]netPort
+}
+
+type netPort struct {
+	node *netNode
+	slot int
+}
+
+// optimalStats counts the interactions performed, by rule.
+type optimalStats struct {
+	Beta          int `json:"beta"`
+	Duplications  int `json:"duplications"`
+	Annihilations int `json:"annihilations"`
+	Erasures      int `json:"erasures"`
+}
+
+type interactionNet struct {
+	active       [][2]*netNode
+	labels       int
+	interactions int
+	stats        optimalStats
+}
+
+// maxReadbackDepth bounds the recursion of readback, which a net
+// with a cycle would otherwise never leave.
+const maxReadbackDepth = 1 << 16
+
+var errReadback = errors.New("optimal reduction could not read back the result")
+
+func (n *interactionNet) node(kind netKind) *netNode {
+	return &netNode{kind: kind}
+}
+
+func target(p netPort) netPort {
+	return p.node.ports[p.slot]
+}
+
+func (n *interactionNet) link(a, b netPort) {
+	a.node.ports[a.slot] = b
+	b.node.ports[b.slot] = a
+	if a.slot == 0 && b.slot == 0 && interacts(a.node.kind, b.node.kind) {
+		n.active = append(n.active, [2]*netNode{a.node, b.node})
+	}
+}
+
+// interacts reports whether two nodes joined at their principal ports
+// form an active pair. An application of a free variable is stuck.
+func interacts(a, b netKind) bool {
+	if a == netRoot || b == netRoot {
+		return false
+	}
+	if a == netFree || b == netFree {
+		return a == netDup || b == netDup || a == netErase || b == netErase
+	}
+	return true
+}
+
+// replace connects each new port to what the corresponding old port
+// was connected to. Old ports connected among themselves have their
+// new counterparts connected instead.
+func (n *interactionNet) replace(olds, news []netPort) {
+	targets := make([]netPort, len(olds))
+	for i, old := range olds {
+		targets[i] = target(old)
+	}
+	for i, t := range targets {
+		j := indexOfPort(olds, t)
+		switch {
+		case j < 0:
+			n.link(news[i], t)
+		case i < j:
+			n.link(news[i], news[j])
+		}
+	}
+}
+
+func indexOfPort(ports []netPort, p netPort) int {
+	for i, q := range ports {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// encode builds the net for expr and returns the port carrying its
+// value. Each variable occurrence takes the next port from its
+// binder's queue of uses.
+func (n *interactionNet) encode(expr expression, uses map[string][]netPort) netPort {
+	switch e := expr.(type) {
+	case *variable:
+		if queue := uses[e.name]; len(queue) > 0 {
+			uses[e.name] = queue[1:]
+			return queue[0]
+		}
+		f := n.node(netFree)
+		f.name = e.name
+		return netPort{f, 0}
+	case *abstraction:
+		lam := n.node(netLambda)
+		name := e.parameter.name
+		saved, shadowed := uses[name]
+		uses[name] = n.share(netPort{lam, 1}, occurrences(e.body, name))
+		body := n.encode(e.body, uses)
+		n.link(netPort{lam, 2}, body)
+		if shadowed {
+			uses[name] = saved
+		} else {
+			delete(uses, name)
+		}
+		return netPort{lam, 0}
+	case *application:
+		app := n.node(netApply)
+		fn := n.encode(e.left, uses)
+		arg := n.encode(e.right, uses)
+		n.link(netPort{app, 0}, fn)
+		n.link(netPort{app, 1}, arg)
+		return netPort{app, 2}
+	}
+	panic("Invalid expression")
+}
+
+// share splits the value at p into count uses with a chain of
+// duplicators, or erases it if there are none.
+func (n *interactionNet) share(p netPort, count int) []netPort {
+	if count == 0 {
+		n.link(p, netPort{n.node(netErase), 0})
+		return nil
+	}
+	var ports []netPort
+	for ; count > 1; count-- {
+		dup := n.node(netDup)
+		n.labels++
+		dup.label = n.labels
+		n.link(p, netPort{dup, 0})
+		ports = append(ports, netPort{dup, 1})
+		p = netPort{dup, 2}
+	}
+	return append(ports, p)
+}
+
+func (n *interactionNet) reduce(ctx context.Context) error {
+	start := n.interactions
+	defer func() { meterSteps(ctx, n.interactions-start) }()
+	for len(n.active) > 0 {
+		n.interactions++
+		if n.interactions%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		pair := n.active[len(n.active)-1]
+		n.active = n.active[:len(n.active)-1]
+		n.interact(pair[0], pair[1])
+	}
+	return ctx.Err()
+}
+
+func (n *interactionNet) interact(a, b *netNode) {
+	if a.kind > b.kind {
+		a, b = b, a
+	}
+	switch {
+	case a.kind == netLambda && b.kind == netApply:
+		n.stats.Beta++
+		n.link(target(netPort{a, 2}), target(netPort{b, 2}))
+		n.link(target(netPort{a, 1}), target(netPort{b, 1}))
+	case a.kind == netDup && b.kind == netDup && a.label == b.label:
+		n.stats.Annihilations++
+		n.link(target(netPort{a, 1}), target(netPort{b, 1}))
+		n.link(target(netPort{a, 2}), target(netPort{b, 2}))
+	case a.kind == netErase:
+		// Erasing an eraser or a free variable leaves nothing behind.
+		n.stats.Erasures++
+	case b.kind == netErase:
+		n.stats.Erasures++
+		n.replace(
+			[]netPort{{a, 1}, {a, 2}},
+			[]netPort{{n.node(netErase), 0}, {n.node(netErase), 0}},
+		)
+	case a.kind == netDup && b.kind == netFree:
+		n.stats.Duplications++
+		copies := []netPort{{n.node(netFree), 0}, {n.node(netFree), 0}}
+		copies[0].node.name, copies[1].node.name = b.name, b.name
+		n.replace([]netPort{{a, 1}, {a, 2}}, copies)
+	default:
+		n.stats.Duplications++
+		n.commute(a, b)
+	}
+}
+
+// commute lets two binary nodes pass through each other, copying both.
+func (n *interactionNet) commute(a, b *netNode) {
+	clone := func(original *netNode) (*netNode, *netNode) {
+		first, second := n.node(original.kind), n.node(original.kind)
+		first.label, second.label = original.label, original.label
+		return first, second
+	}
+	a1, a2 := clone(a)
+	b1, b2 := clone(b)
+	n.link(netPort{b1, 1}, netPort{a1, 1})
+	n.link(netPort{b1, 2}, netPort{a2, 1})
+	n.link(netPort{b2, 1}, netPort{a1, 2})
+	n.link(netPort{b2, 2}, netPort{a2, 2})
+	n.replace(
+		[]netPort{{a, 1}, {a, 2}, {b, 1}, {b, 2}},
+		[]netPort{{b1, 0}, {b2, 0}, {a1, 0}, {a2, 0}},
+	)
+}
+
+// A netReader converts a normal net back into a term. A path entering
+// a duplicator through an auxiliary port records which one, so that
+// leaving a duplicator of the same label through its principal port
+// takes the matching copy.
+type netReader struct {
+	stacks map[int][]int
+	names  map[*netNode]string
+	used   map[string]bool
+}
+
+func (r *netReader) read(p netPort, depth int) (expression, error) {
+	if depth > maxReadbackDepth {
+		return nil, errReadback
+	}
+	node := p.node
+	switch {
+	case node.kind == netLambda && p.slot == 0:
+		name := freshName("x", r.used)
+		r.used[name] = true
+		r.names[node] = name
+		body, err := r.read(target(netPort{node, 2}), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return &abstraction{variable{name, span{}}, body, span{}}, nil
+	case node.kind == netLambda && p.slot == 1:
+		name, ok := r.names[node]
+		if !ok {
+			return nil, errReadback
+		}
+		return &variable{name, span{}}, nil
+	case node.kind == netApply && p.slot == 2:
+		left, err := r.read(target(netPort{node, 0}), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		right, err := r.read(target(netPort{node, 1}), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return &application{left, right, span{}}, nil
+	case node.kind == netDup && p.slot != 0:
+		r.stacks[node.label] = append(r.stacks[node.label], p.slot)
+		expr, err := r.read(target(netPort{node, 0}), depth+1)
+		r.stacks[node.label] = r.stacks[node.label][:len(r.stacks[node.label])-1]
+		return expr, err
+	case node.kind == netDup:
+		stack := r.stacks[node.label]
+		if len(stack) == 0 {
+			return nil, errReadback
+		}
+		slot := stack[len(stack)-1]
+		r.stacks[node.label] = stack[:len(stack)-1]
+		expr, err := r.read(target(netPort{node, slot}), depth+1)
+		r.stacks[node.label] = append(r.stacks[node.label], slot)
+		return expr, err
+	case node.kind == netFree:
+		return &variable{node.name, span{}}, nil
+	}
+	return nil, errReadback
+}
+
+// normalizeOptimal reduces expr to normal form by optimal reduction.
+func normalizeOptimal(ctx context.Context, expr expression) (expression, optimalStats, error) {
+	n := &interactionNet{}
+	root := n.node(netRoot)
+	n.link(netPort{root, 0}, n.encode(expr, map[string][]netPort{}))
+	if err := n.reduce(ctx); err != nil {
+		return nil, n.stats, err
+	}
+	r := &netReader{map[int][]int{}, map[*netNode]string{}, freeVariables(expr)}
+	result, err := r.read(target(netPort{root, 0}), 0)
+	if err != nil {
+		return nil, n.stats, err
+	}
+	return result, n.stats, nil
+}
+
+// optimal evaluates an expression with the experimental optimal
+// reduction engine, reporting interaction counts along with the
+// result.
+func (c *connection) optimal(request Request) Response {
+	if !c.server.experimentalOptimal {
+		return errorResponse(request.ID, codeMethodNotFound, "optimal reduction is disabled; start the server with -experimental-optimal")
+	}
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	source, ok := params["expression"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid expression parameter")
+	}
+	expr, err := parseLambdaExpression(source)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	ctx, cancel := c.evaluationContext(request, c.server.maxTimeout)
+	defer cancel()
+
+	result, stats, err := normalizeOptimal(ctx, expr)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorResponse(request.ID, codeTimeout, fmt.Sprintf("optimal reduction timed out after %s", c.server.maxTimeout))
+	}
+	if errors.Is(err, context.Canceled) {
+		return errorResponse(request.ID, codeTimeout, "optimal reduction abandoned: the client went away")
+	}
+	if err != nil {
+		return errorResponse(request.ID, codeInternalError, err.Error())
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Expression string       `json:"expression"`
+			Stats      optimalStats `json:"stats"`
+		}{
+			Expression: result.String(),
+			Stats:      stats,
+		},
+	}
+}
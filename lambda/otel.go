@@ -0,0 +1,252 @@
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans are exported in batches of up to maxSpanBatch, at least every
+// spanFlushInterval.
+const (
+	maxSpanBatch      = 512
+	spanFlushInterval = 5 * time.Second
+)
+
+// OpenTelemetry span kinds and status codes.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanStatusError  = 2
+)
+
+// A traceSpan is an OpenTelemetry span: a connection or a request.
+type traceSpan struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+
+	name       string
+	kind       int
+	start, end time.Time
+
+	attributes map[string]interface{}
+	err        string
+}
+
+type spanKey struct{}
+
+func withSpan(ctx context.Context, span *traceSpan) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func spanFrom(ctx context.Context) *traceSpan {
+	span, _ := ctx.Value(spanKey{}).(*traceSpan)
+	return span
+}
+
+// newSpan starts a span, in the trace of parent if there is one.
+func newSpan(name string, kind int, parent *traceSpan) *traceSpan {
+	span := &traceSpan{name: name, kind: kind, start: time.Now(), attributes: map[string]interface{}{}}
+	if parent != nil {
+		span.traceID, span.parentID = parent.traceID, parent.spanID
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+	return span
+}
+
+// spanExporter sends finished spans to an OTLP/HTTP collector, encoded
+// as JSON, so that no OpenTelemetry dependency is needed.
+type spanExporter struct {
+	endpoint string
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending []*traceSpan
+
+	// stop ends the periodic flushes.
+	stop chan struct{}
+}
+
+func newSpanExporter(endpoint string) *spanExporter {
+	e := &spanExporter{endpoint: endpoint, client: &http.Client{Timeout: 10 * time.Second}, stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(spanFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.flush()
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+	return e
+}
+
+// close stops the periodic flushes and sends the spans queued.
+func (e *spanExporter) close() {
+	close(e.stop)
+	e.flush()
+}
+
+// export queues a finished span.
+func (e *spanExporter) export(span *traceSpan) {
+	span.end = time.Now()
+	e.mu.Lock()
+	e.pending = append(e.pending, span)
+	full := len(e.pending) >= maxSpanBatch
+	e.mu.Unlock()
+	if full {
+		go e.flush()
+	}
+}
+
+// flush sends the queued spans. Spans that cannot be delivered are
+// dropped: tracing must not hold up evaluation.
+func (e *spanExporter) flush() {
+	e.mu.Lock()
+	spans := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		log.Println("Failed to encode spans:", err)
+		return
+	}
+	response, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Println("Failed to export spans:", err)
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		log.Println("Failed to export spans: collector answered", response.Status)
+	}
+}
+
+// otlpRequest builds an ExportTraceServiceRequest in the JSON mapping
+// of OTLP.
+func otlpRequest(spans []*traceSpan) interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		s := map[string]interface{}{
+			"traceId":           hex.EncodeToString(span.traceID[:]),
+			"spanId":            hex.EncodeToString(span.spanID[:]),
+			"name":              span.name,
+			"kind":              span.kind,
+			"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.attributes),
+		}
+		if span.parentID != [8]byte{} {
+			s["parentSpanId"] = hex.EncodeToString(span.parentID[:])
+		}
+		if span.err != "" {
+			s["status"] = map[string]interface{}{"code": spanStatusError, "message": span.err}
+		}
+		encoded = append(encoded, s)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": "lambda"}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "example.com/lambda"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	encoded := []interface{}{}
+	for key, value := range attributes {
+		var v map[string]interface{}
+		switch value := value.(type) {
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		case string:
+			v = map[string]interface{}{"stringValue": value}
+		default:
+			b, _ := json.Marshal(value)
+			v = map[string]interface{}{"stringValue": string(b)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": v})
+	}
+	return encoded
+}
+
+// parseTraceparent reads the trace and parent span IDs of a W3C
+// traceparent, as in 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(traceparent string) (*traceSpan, bool) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return nil, false
+	}
+	span := &traceSpan{}
+	if _, err := hex.Decode(span.traceID[:], []byte(parts[1])); err != nil || span.traceID == [16]byte{} {
+		return nil, false
+	}
+	if _, err := hex.Decode(span.spanID[:], []byte(parts[2])); err != nil || span.spanID == [8]byte{} {
+		return nil, false
+	}
+	return span, true
+}
+
+// traceRequest answers a request within a span that is a child of the
+// caller's span when the request has a valid traceparent, and of the
+// connection's otherwise, noting its method, strategy, steps and
+// outcome.
+func (s *Server) traceRequest(ctx context.Context, request Request, serve func() Response) Response {
+	parent, kind := spanFrom(ctx), spanKindInternal
+	if caller, ok := parseTraceparent(request.Traceparent); ok {
+		parent, kind = caller, spanKindServer
+	}
+	if parent == nil {
+		kind = spanKindServer
+	}
+	span := newSpan(request.Method, kind, parent)
+	span.attributes["rpc.system"] = "jsonrpc"
+	span.attributes["rpc.method"] = request.Method
+	if request.ID != nil {
+		span.attributes["rpc.jsonrpc.request_id"] = request.ID
+	}
+	if params, ok := request.Params.(map[string]interface{}); ok {
+		if strategy, ok := params["strategy"].(string); ok {
+			span.attributes["lambda.strategy"] = strategy
+		}
+	}
+
+	response := serve()
+	if steps, ok := response.Meta["steps"].(int); ok {
+		span.attributes["lambda.steps"] = steps
+	}
+	if response.Error != nil {
+		span.attributes["rpc.jsonrpc.error_code"] = response.Error.Code
+		span.err = response.Error.Message
+	}
+	s.spans.export(span)
+	return response
+}
@@ -0,0 +1,77 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpanExport(t *testing.T) {
+	exported := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		exported <- body
+	}))
+	defer collector.Close()
+
+	s := NewServer(Options{Workers: 1, OTLPEndpoint: collector.URL})
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	response := s.ServeRPC(context.Background(), Request{ID: 1, Method: "evaluate", Params: map[string]interface{}{"expression": `(\x.x) a`}, Traceparent: traceparent})
+	if response.Traceparent != traceparent {
+		t.Errorf("response traceparent: got %q, want %q", response.Traceparent, traceparent)
+	}
+	s.ServeRPC(context.Background(), Request{ID: 2, Method: "evaluate", Params: map[string]interface{}{"expression": "(x"}})
+	s.spans.flush()
+
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Kind         int    `json:"kind"`
+					Attributes   []struct {
+						Key   string            `json:"key"`
+						Value map[string]string `json:"value"`
+					} `json:"attributes"`
+					Status *struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(<-exported, &request); err != nil {
+		t.Fatal(err)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+
+	traced := spans[0]
+	if traced.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || traced.ParentSpanID != "00f067aa0ba902b7" || traced.Kind != spanKindServer {
+		t.Errorf("span of a request with a traceparent: got %+v, want it in the caller's trace", traced)
+	}
+	attributes := map[string]map[string]string{}
+	for _, attribute := range traced.Attributes {
+		attributes[attribute.Key] = attribute.Value
+	}
+	if attributes["rpc.method"]["stringValue"] != "evaluate" || attributes["lambda.steps"]["intValue"] != "1" {
+		t.Errorf("span attributes: got %v, want rpc.method evaluate and lambda.steps 1", attributes)
+	}
+
+	failed := spans[1]
+	if failed.TraceID == traced.TraceID || failed.ParentSpanID != "" {
+		t.Errorf("span of a request without a traceparent: got %+v, want a trace of its own", failed)
+	}
+	if failed.Status == nil || failed.Status.Code != spanStatusError {
+		t.Errorf("span of a failed request: got status %+v, want an error", failed.Status)
+	}
+}
@@ -0,0 +1,484 @@
+package lambda
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenLambda
+	tokenDot
+	tokenOpen
+	tokenClose
+	tokenName
+	tokenReference
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize splits src into tokens. Names are runs of Unicode letters,
+// digits, underscores and primes not starting with a prime, as in `φ`,
+// `succ'` or `twoPlusTwo`. A lambda is written as `\`, `λ` or `!`, so λ
+// is never part of a name. A reference to a term held by the server is
+// a sigil followed by ASCII letters, digits and underscores, as in `$2`
+// or `@3f9c`. Comments, as commentAt finds them, are skipped.
+func tokenize(src string) ([]token, error) {
+	return tokenizeSyntax(src, false)
+}
+
+// tokenizeSyntax is tokenize, reading `->` rather than `.` after the
+// parameters of a lambda when arrow is set.
+func tokenizeSyntax(src string, arrow bool) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		if end, ok, err := commentAt(src, i); ok {
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+		case r == '\\' || r == 'λ' || r == '!':
+			tokens = append(tokens, token{tokenLambda, src[i : i+size], i})
+		case r == '.' && !arrow:
+			tokens = append(tokens, token{tokenDot, ".", i})
+		case r == '-' && arrow && strings.HasPrefix(src[i:], "->"):
+			tokens = append(tokens, token{tokenDot, "->", i})
+			size = 2
+		case r == '(':
+			tokens = append(tokens, token{tokenOpen, "(", i})
+		case r == ')':
+			tokens = append(tokens, token{tokenClose, ")", i})
+		case r == '$' || r == '@' || r == '#':
+			start := i
+			i++
+			for i < len(src) && isNameByte(src[i]) {
+				i++
+			}
+			if i == start+1 {
+				return nil, syntaxErrorf(start, "expected reference after %q", r)
+			}
+			tokens = append(tokens, token{tokenReference, src[start:i], start})
+			continue
+		case isNameRune(r) && r != '\'':
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if !isNameRune(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{tokenName, src[start:i], start})
+			continue
+		default:
+			return nil, syntaxErrorf(i, "unexpected character %q", r)
+		}
+		i += size
+	}
+	return append(tokens, token{tokenEOF, "", len(src)}), nil
+}
+
+// unknownReference is the error for a reference that resolves to
+// nothing. As #name is a hash reference, the likeliest mistake with one
+// is a comment missing its space.
+func unknownReference(t token) error {
+	if strings.HasPrefix(t.text, "#") {
+		return syntaxErrorf(t.pos, "unknown reference %s; a # comment needs a space after the #", t.text)
+	}
+	return syntaxErrorf(t.pos, "unknown reference %s", t.text)
+}
+
+// commentAt reports whether a comment starts at offset i of src, and
+// where it ends. A line comment runs from -- or # to the end of the
+// line, but # directly followed by a name is a reference; a block
+// comment runs from {- to the matching -}, and may nest.
+func commentAt(src string, i int) (int, bool, error) {
+	rest := src[i:]
+	switch {
+	case strings.HasPrefix(rest, "--"), rest[0] == '#' && (len(rest) == 1 || !isNameByte(rest[1])):
+		if end := strings.IndexByte(rest, '\n'); end >= 0 {
+			return i + end, true, nil
+		}
+		return len(src), true, nil
+	case strings.HasPrefix(rest, "{-"):
+		depth := 0
+		for j := i; j < len(src)-1; j++ {
+			switch src[j : j+2] {
+			case "{-":
+				depth++
+				j++
+			case "-}":
+				depth--
+				j++
+				if depth == 0 {
+					return j + 1, true, nil
+				}
+			}
+		}
+		return 0, true, syntaxErrorf(i, "unterminated comment")
+	}
+	return 0, false, nil
+}
+
+// blankComments replaces the comments in src by spaces, keeping line
+// breaks, so that what is left parses line by line at the same offsets.
+func blankComments(src string) (string, error) {
+	b := []byte(src)
+	for i := 0; i < len(src); {
+		end, ok, err := commentAt(src, i)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			i++
+			continue
+		}
+		for ; i < end; i++ {
+			if b[i] != '\n' && b[i] != '\r' {
+				b[i] = ' '
+			}
+		}
+	}
+	return string(b), nil
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// isNameRune reports whether r may appear in a name: a Unicode letter
+// other than λ, a digit, an underscore or, but for the first, a prime.
+func isNameRune(r rune) bool {
+	return r == '_' || r == '\'' || r != 'λ' && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+type parser struct {
+	tokens  []token
+	pos     int
+	resolve resolver
+
+	// scope holds the binders enclosing the current position, innermost
+	// last, so that shadowing can be reported.
+	scope    []token
+	warnings []parseWarning
+
+	// lastEnd is the offset just past the last token consumed.
+	lastEnd int
+
+	// dot ends the parameters of a lambda.
+	dot string
+
+	// depth counts the parentheses and lambdas enclosing the current
+	// position.
+	depth int
+}
+
+// maxDepth bounds how deeply a parsed term may nest. The parser, like
+// most functions over terms, recurses on their structure, and running
+// out of stack takes down the whole process rather than the request.
+const maxDepth = 10000
+
+// descend enters a parenthesis or lambda at t. The caller leaves it
+// again by decrementing p.depth. A printed term may take a parenthesis
+// and a lambda per level, so twice maxDepth of them are allowed;
+// checkDepth then bounds the term itself.
+func (p *parser) descend(t token) error {
+	p.depth++
+	if p.depth > 2*maxDepth {
+		return syntaxErrorf(t.pos, "parentheses and lambdas nested more than %d deep", 2*maxDepth)
+	}
+	return nil
+}
+
+// checkDepth fails if expr nests more than maxDepth deep, as a long
+// run of applications does without any parentheses. It keeps its own
+// stack, so that it cannot overflow on the terms it refuses.
+func checkDepth(expr expression) error {
+	type item struct {
+		expr  expression
+		depth int
+	}
+	stack := []item{{expr, 0}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.depth > maxDepth {
+			return syntaxErrorf(spanOf(top.expr).Start, "term nested more than %d deep", maxDepth)
+		}
+		switch e := top.expr.(type) {
+		case *abstraction:
+			stack = append(stack, item{e.body, top.depth + 1})
+		case *application:
+			stack = append(stack, item{e.left, top.depth + 1}, item{e.right, top.depth + 1})
+		}
+	}
+	return nil
+}
+
+// A syntaxError reports input that does not parse, at the byte offset
+// where parsing failed. Errors from parsing a whole input carry it as
+// source, for rendering.
+type syntaxError struct {
+	message string
+	offset  int
+	source  string
+}
+
+func syntaxErrorf(offset int, format string, args ...interface{}) error {
+	return &syntaxError{message: fmt.Sprintf(format, args...), offset: offset}
+}
+
+func (e *syntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.message, e.offset)
+}
+
+// withSource attaches the input to a syntax error.
+func withSource(err error, src string) error {
+	if e, ok := err.(*syntaxError); ok {
+		e.source = src
+	}
+	return err
+}
+
+// syntaxErrorData locates a syntax error in its input: the line and
+// column, counting from 1 and columns in characters, the line itself,
+// and a caret under the column, all rendered as a compiler would.
+type syntaxErrorData struct {
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Snippet  string `json:"snippet"`
+	Caret    string `json:"caret"`
+	Rendered string `json:"rendered"`
+}
+
+func (e *syntaxError) data() syntaxErrorData {
+	offset := e.offset
+	if offset > len(e.source) {
+		offset = len(e.source)
+	}
+	start := strings.LastIndexByte(e.source[:offset], '\n') + 1
+	end := strings.IndexByte(e.source[offset:], '\n')
+	if end < 0 {
+		end = len(e.source)
+	} else {
+		end += offset
+	}
+	snippet := strings.TrimRight(e.source[start:end], "\r")
+
+	// Tabs are kept in the caret line so that it lines up.
+	var caret strings.Builder
+	for _, r := range e.source[start:offset] {
+		if r == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	caret.WriteByte('^')
+
+	d := syntaxErrorData{
+		Offset:  e.offset,
+		Line:    strings.Count(e.source[:start], "\n") + 1,
+		Column:  utf8.RuneCountInString(e.source[start:offset]) + 1,
+		Snippet: snippet,
+		Caret:   caret.String(),
+	}
+	d.Rendered = fmt.Sprintf("%d:%d: error: %s\n%s\n%s", d.Line, d.Column, e.message, d.Snippet, d.Caret)
+	return d
+}
+
+// parseWarning flags input that parses but is probably not what the
+// author meant.
+type parseWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Offset  int    `json:"offset"`
+
+	// Shadows is the offset of the outer binder for shadowedBinder.
+	Shadows int `json:"shadows"`
+}
+
+// resolver looks up a reference such as `$2`, reporting false for an
+// unknown one.
+type resolver func(reference string) (expression, bool)
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+		p.lastEnd = t.pos + len(t.text)
+	}
+	return t
+}
+
+// parseLambdaExpression parses src into an expression. Application is
+// left associative and a lambda body extends as far right as possible,
+// so `\x y.x y z` reads as `(\x.(\y.((x y) z)))`.
+func parseLambdaExpression(src string) (expression, error) {
+	return parseWithReferences(src, nil)
+}
+
+// parseWithReferences is parseLambdaExpression for input that may
+// refer to server-side terms, looked up with resolve.
+func parseWithReferences(src string, resolve resolver) (expression, error) {
+	expr, _, err := parseWithWarnings(src, resolve)
+	return expr, err
+}
+
+// parseWithWarnings is parseWithReferences that also returns warnings
+// about the input, such as binders shadowing an enclosing one.
+func parseWithWarnings(src string, resolve resolver) (expression, []parseWarning, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, nil, withSource(err, src)
+	}
+	expr, warnings, err := parseTokens(tokens, resolve, ".")
+	return expr, warnings, withSource(err, src)
+}
+
+// parseTokens parses tokens in the core syntax, lambdas' parameters
+// ending in dot.
+func parseTokens(tokens []token, resolve resolver, dot string) (expression, []parseWarning, error) {
+	p := &parser{tokens: tokens, resolve: resolve, dot: dot}
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, nil, syntaxErrorf(t.pos, "unexpected %q", t.text)
+	}
+	if err := checkDepth(expr); err != nil {
+		return nil, nil, err
+	}
+	return expr, p.warnings, nil
+}
+
+func (p *parser) parseExpression() (expression, error) {
+	var expr expression
+	start := p.peek().pos
+	for {
+		var operand expression
+		var err error
+
+		switch t := p.peek(); t.kind {
+		case tokenLambda:
+			operand, err = p.parseAbstraction()
+		case tokenOpen:
+			if err := p.descend(p.next()); err != nil {
+				return nil, err
+			}
+			operand, err = p.parseExpression()
+			p.depth--
+			if err == nil {
+				if closing := p.next(); closing.kind != tokenClose {
+					err = syntaxErrorf(closing.pos, "expected ')'")
+				}
+			}
+		case tokenName:
+			p.next()
+			operand = &variable{t.text, span{t.pos, t.pos + len(t.text)}}
+		case tokenReference:
+			p.next()
+			var found bool
+			if p.resolve != nil {
+				operand, found = p.resolve(t.text)
+			}
+			if !found {
+				err = unknownReference(t)
+			}
+		default:
+			if expr == nil {
+				if t.kind == tokenEOF {
+					return nil, syntaxErrorf(t.pos, "unexpected end of expression")
+				}
+				return nil, syntaxErrorf(t.pos, "unexpected %q", t.text)
+			}
+			return expr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if expr == nil {
+			expr = operand
+		} else {
+			expr = &application{expr, operand, span{start, p.lastEnd}}
+		}
+	}
+}
+
+func (p *parser) parseAbstraction() (expression, error) {
+	lambda := p.next()
+	if err := p.descend(lambda); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	var parameters []token
+	for p.peek().kind == tokenName {
+		parameter := p.next()
+		p.checkShadowing(parameter)
+		parameters = append(parameters, parameter)
+		p.scope = append(p.scope, parameter)
+	}
+	if len(parameters) == 0 {
+		t := p.peek()
+		return nil, syntaxErrorf(t.pos, "expected parameter name")
+	}
+	if t := p.next(); t.kind != tokenDot {
+		return nil, syntaxErrorf(t.pos, "expected '%s'", p.dot)
+	}
+
+	body, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	p.scope = p.scope[:len(p.scope)-len(parameters)]
+
+	end := p.lastEnd
+	for i := len(parameters) - 1; i >= 0; i-- {
+		parameter := parameters[i]
+		start := parameter.pos
+		if i == 0 {
+			start = lambda.pos
+		}
+		body = &abstraction{
+			variable{parameter.text, span{parameter.pos, parameter.pos + len(parameter.text)}},
+			body,
+			span{start, end},
+		}
+	}
+	return body, nil
+}
+
+func (p *parser) checkShadowing(parameter token) {
+	for i := len(p.scope) - 1; i >= 0; i-- {
+		if outer := p.scope[i]; outer.text == parameter.text {
+			p.warnings = append(p.warnings, parseWarning{
+				Code:    "shadowedBinder",
+				Message: fmt.Sprintf("binder %s at offset %d shadows the one at offset %d", parameter.text, parameter.pos, outer.pos),
+				Offset:  parameter.pos,
+				Shadows: outer.pos,
+			})
+			return
+		}
+	}
+}
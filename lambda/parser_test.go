@@ -0,0 +1,107 @@
+package lambda
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`x`, `x`},
+		{`\x.x`, `(!x.x)`},
+		{`\x y.x y z`, `(!x.(!y.((x y) z)))`},
+		{`λx.λy.x`, `(!x.(!y.x))`},
+		{`a b c`, `((a b) c)`},
+		{`a (b c)`, `(a (b c))`},
+		{`(\x.x) \y.y y`, `((!x.x) (!y.(y y)))`},
+	} {
+		expr, err := parseLambdaExpression(test.src)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+		if got := expr.String(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.src, got, test.want)
+		}
+	}
+
+	// Unbalanced and incomplete input is an error, never a panic.
+	for _, src := range []string{`(x`, `x)`, `)(`, `\x`, `\.x`, `\x.`, `()`, ``} {
+		if expr, err := parseLambdaExpression(src); err == nil {
+			t.Errorf("%s: got %s, want an error", src, expr)
+		}
+	}
+}
+
+func TestSubstituteAvoidsCapture(t *testing.T) {
+	parse := func(src string) expression {
+		expr, err := parseLambdaExpression(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return expr
+	}
+	for _, test := range []struct {
+		expr, name, value, want string
+	}{
+		{`\y.x y`, "x", `y`, `\z.y z`},
+		{`\x.x`, "x", `y`, `\x.x`},
+		{`\y.\z.x y z`, "x", `y z`, `\a.\b.y z a b`},
+		{`x (\x.x)`, "x", `y`, `y (\x.x)`},
+	} {
+		got := substitute(parse(test.expr), variable{name: test.name}, parse(test.value))
+		if !alphaEquivalent(got, parse(test.want)) {
+			t.Errorf("%s[%s := %s]: got %s, want %s", test.expr, test.name, test.value, got, test.want)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	for _, src := range []string{"x # note", "x -- note\n", "{- note {- nested -} -} x", "x #\n"} {
+		expr, err := parseLambdaExpression(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+		} else if expr.String() != "x" {
+			t.Errorf("%q: got %s, want x", src, expr)
+		}
+	}
+
+	// # directly followed by a name is a hash reference, not a comment.
+	_, err := parseLambdaExpression("x #note")
+	if err == nil || !strings.Contains(err.Error(), "unknown reference #note") || !strings.Contains(err.Error(), "comment") {
+		t.Errorf("x #note: got %v, want an unknown reference error pointing at the comment syntax", err)
+	}
+}
+
+func TestDeepNesting(t *testing.T) {
+	for _, test := range []struct {
+		syntax string
+		src    string
+	}{
+		{"lambda", strings.Repeat("(", 5000000) + "x"},
+		{"lambda", strings.Repeat(`\a.`, 1000000) + "a"},
+		{"lambda", strings.Repeat("x ", 1000000)},
+		{"lisp", "(lambda (a) " + strings.Repeat("(a ", 1000000)},
+	} {
+		src := test.src
+		_, _, err := syntaxes[test.syntax](src, nil)
+		if _, ok := err.(*syntaxError); !ok || !strings.Contains(err.Error(), "deep") {
+			t.Errorf("%.12s...: got %v, want a syntax error for nesting too deep", src, err)
+		}
+	}
+
+	// Terms at the limit print and parse back, in every style.
+	for _, src := range []string{strings.Repeat(`\a.`, maxDepth) + "a", strings.Repeat("x ", maxDepth+1)} {
+		expr, err := parseLambdaExpression(src)
+		if err != nil {
+			t.Fatalf("%.12s...: %v", src, err)
+		}
+		for style, print := range printStyles {
+			if _, err := parseLambdaExpression(print(expr)); err != nil {
+				t.Errorf("%.12s... printed %s: %v", src, style, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package lambda
+
+import (
+	"errors"
+	"fmt"
+)
+
+const defaultPartialEvalSteps = 10000
+
+type partialEvalResult struct {
+	// Residual is the term left once no redex remains outside the
+	// opaque names, or where reduction stopped, as Stopped then says.
+	Residual string `json:"residual"`
+	Stopped  string `json:"stopped,omitempty"`
+
+	// Opaque lists the opaque names the residual still uses.
+	Opaque []string `json:"opaque"`
+}
+
+// partialEval reduces an expression in normal order as far as it goes
+// while treating the names in the opaque parameter as unknowns: their
+// definitions, if any, are left out, so the residual term applies them
+// rather than their bodies. Marking a fixed point combinator or a
+// recursive function opaque keeps its unfoldings from running forever.
+// Unlike evaluate, reaching the step limit or timeout is not an error;
+// the residual is then the term reached so far.
+func (c *connection) partialEval(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	opaque, err := opaqueParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	definitions, err := c.definitionsParam(withoutDefinitions(params, opaque))
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := c.server.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if maxSteps == 0 {
+		maxSteps = defaultPartialEvalSteps
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	residual, steps, err := reduce(ctx, strategies[defaultStrategy], expandDefinitions(expr, definitions), maxSteps, nil)
+	result := partialEvalResult{Residual: residual.String(), Opaque: []string{}}
+	switch {
+	case errors.Is(err, errStepLimit):
+		result.Stopped = "stepLimit"
+	case err != nil:
+		result.Stopped = "timeout"
+	}
+	free := freeVariables(residual)
+	for _, name := range opaque {
+		if free[name] {
+			result.Opaque = append(result.Opaque, name)
+		}
+	}
+	return Response{ID: request.ID, Result: result, Meta: map[string]interface{}{"steps": steps}}
+}
+
+// opaqueParam reads the opaque parameter, a list of names.
+func opaqueParam(params map[string]interface{}) ([]string, error) {
+	list, ok := params["opaque"].([]interface{})
+	if !ok {
+		return nil, errors.New("Invalid opaque parameter")
+	}
+	names := make([]string, len(list))
+	for i, item := range list {
+		name, _ := item.(string)
+		if !validName(name) {
+			return nil, fmt.Errorf("Invalid opaque parameter: bad name %q", name)
+		}
+		names[i] = name
+	}
+	return names, nil
+}
+
+// withoutDefinitions returns params with the names left out of its
+// definitions parameter, so that the other definitions keep them free.
+func withoutDefinitions(params map[string]interface{}, names []string) map[string]interface{} {
+	sources, ok := params["definitions"].(map[string]interface{})
+	if !ok || len(names) == 0 {
+		return params
+	}
+	kept := make(map[string]interface{}, len(sources))
+	for name, source := range sources {
+		kept[name] = source
+	}
+	for _, name := range names {
+		delete(kept, name)
+	}
+	copied := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		copied[key] = value
+	}
+	copied["definitions"] = kept
+	return copied
+}
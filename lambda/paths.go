@@ -0,0 +1,106 @@
+package lambda
+
+// A path addresses a subterm by the child taken at each node from the
+// root: 0 is the body of an abstraction or the left side of an
+// application, 1 the right side of an application.
+type path []int
+
+// redexPaths lists the paths of all beta redexes in expr, in
+// leftmost-outermost order.
+func redexPaths(expr expression) []path {
+	var paths []path
+	var walk func(expression, path)
+	walk = func(expr expression, at path) {
+		switch e := expr.(type) {
+		case *abstraction:
+			walk(e.body, append(at, 0))
+		case *application:
+			if _, ok := e.left.(*abstraction); ok {
+				paths = append(paths, append(path{}, at...))
+			}
+			walk(e.left, append(at, 0))
+			walk(e.right, append(at, 1))
+		}
+	}
+	walk(expr, path{})
+	return paths
+}
+
+// subtermAt returns the subterm of expr at p, or false if p does not
+// address one.
+func subtermAt(expr expression, p path) (expression, bool) {
+	for _, child := range p {
+		switch e := expr.(type) {
+		case *abstraction:
+			if child != 0 {
+				return nil, false
+			}
+			expr = e.body
+		case *application:
+			switch child {
+			case 0:
+				expr = e.left
+			case 1:
+				expr = e.right
+			default:
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return expr, true
+}
+
+// replaceAt returns expr with the subterm at p replaced by
+// replacement. Variables of replacement may be captured by binders
+// above p; callers wanting hygiene must rename first.
+func replaceAt(expr expression, p path, replacement expression) (expression, bool) {
+	if len(p) == 0 {
+		return replacement, true
+	}
+	switch e := expr.(type) {
+	case *abstraction:
+		if p[0] != 0 {
+			return nil, false
+		}
+		body, ok := replaceAt(e.body, p[1:], replacement)
+		if !ok {
+			return nil, false
+		}
+		return &abstraction{e.parameter, body, e.span}, true
+	case *application:
+		switch p[0] {
+		case 0:
+			left, ok := replaceAt(e.left, p[1:], replacement)
+			if !ok {
+				return nil, false
+			}
+			return &application{left, e.right, e.span}, true
+		case 1:
+			right, ok := replaceAt(e.right, p[1:], replacement)
+			if !ok {
+				return nil, false
+			}
+			return &application{e.left, right, e.span}, true
+		}
+	}
+	return nil, false
+}
+
+// contractAt performs the beta reduction of the redex at p.
+func contractAt(expr expression, p path) (expression, bool) {
+	redex, ok := subtermAt(expr, p)
+	if !ok {
+		return nil, false
+	}
+	app, ok := redex.(*application)
+	if !ok {
+		return nil, false
+	}
+	fn, ok := app.left.(*abstraction)
+	if !ok {
+		return nil, false
+	}
+	return replaceAt(expr, p, substitute(fn.body, fn.parameter, app.right))
+}
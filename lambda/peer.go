@@ -0,0 +1,73 @@
+package lambda
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net"
+)
+
+// peerInfo describes the client at the other end of a connection. UID
+// and PID are those of the client process, known for UNIX domain
+// sockets on Linux.
+type peerInfo struct {
+	Address string `json:"address,omitempty"`
+	UID     *int   `json:"uid,omitempty"`
+	PID     *int   `json:"pid,omitempty"`
+}
+
+func newPeerInfo(conn net.Conn) peerInfo {
+	var peer peerInfo
+	// Clients of UNIX domain sockets are almost always unbound, with
+	// no address to show.
+	if addr := conn.RemoteAddr(); addr != nil && addr.String() != "@" {
+		peer.Address = addr.String()
+	}
+	peer.UID, peer.PID = peerCredentials(conn)
+	return peer
+}
+
+func (p peerInfo) String() string {
+	s := p.Address
+	if s == "" {
+		s = "an unbound socket"
+	}
+	if p.UID != nil {
+		s += fmt.Sprintf(" (uid %d, pid %d)", *p.UID, *p.PID)
+	}
+	return s
+}
+
+// newConnectionID returns a random (version 4) UUID.
+func newConnectionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// logf logs a message about the connection, tagged with its ID.
+func (c *connection) logf(format string, v ...interface{}) {
+	log.Printf("[%s] "+format, append([]interface{}{c.id}, v...)...)
+}
+
+// withConnectionInfo adds the connection's ID and peer to the meta of
+// response when request asks for them with the connectionInfo param.
+func (c *connection) withConnectionInfo(request Request, response Response) Response {
+	if c.id == "" {
+		return response
+	}
+	params, _ := c.applySettings(request).Params.(map[string]interface{})
+	if want, _ := params["connectionInfo"].(bool); !want {
+		return response
+	}
+	if response.Meta == nil {
+		response.Meta = map[string]interface{}{}
+	}
+	response.Meta["connection"] = struct {
+		ID   string   `json:"id"`
+		Peer peerInfo `json:"peer"`
+	}{c.id, c.peer}
+	return response
+}
@@ -0,0 +1,28 @@
+package lambda
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredentials reads the credentials of the process at the other end
+// of a UNIX domain socket.
+func peerCredentials(conn net.Conn) (uid, pid *int) {
+	unix, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil
+	}
+	raw, err := unix.SyscallConn()
+	if err != nil {
+		return nil, nil
+	}
+	var cred *syscall.Ucred
+	raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return nil, nil
+	}
+	u, p := int(cred.Uid), int(cred.Pid)
+	return &u, &p
+}
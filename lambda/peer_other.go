@@ -0,0 +1,10 @@
+//go:build !linux
+
+package lambda
+
+import "net"
+
+// peerCredentials is only implemented on Linux.
+func peerCredentials(conn net.Conn) (uid, pid *int) {
+	return nil, nil
+}
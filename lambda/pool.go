@@ -0,0 +1,118 @@
+package lambda
+
+import (
+	"errors"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oleiade/lane"
+)
+
+// Request priorities, highest first. Requests default to normal.
+var priorities = map[string]int{
+	"high":   2,
+	"normal": 1,
+	"low":    0,
+}
+
+// maxPriority is the highest level in priorities.
+const maxPriority = 2
+
+// priorityShift leaves room below the priority level for a sequence
+// number, so that requests of equal priority are served in arrival
+// order by the max-heap. The levels up to maxPriority take the top bits
+// of an int below the sign, whether it has 32 bits or 64.
+const priorityShift = bits.UintSize - 3
+
+type job struct {
+	run      func(queueWait time.Duration)
+	enqueued time.Time
+}
+
+// pool runs jobs on a fixed number of workers, taking the highest
+// priority waiting job first.
+type pool struct {
+	queue   *lane.PQueue
+	pending chan struct{}
+	seq     int64
+
+	// closed is set, under mu held for writing, once pending is closed.
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newPool(workers, backlog int) *pool {
+	p := &pool{
+		queue:   lane.NewPQueue(lane.MAXPQ),
+		pending: make(chan struct{}, backlog),
+	}
+
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// submit queues run at the given priority level. It blocks while the
+// backlog is full. Once the pool is closed, run is called right away.
+func (p *pool) submit(priority int, run func(queueWait time.Duration)) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		run(0)
+		return
+	}
+	seq := atomic.AddInt64(&p.seq, 1)
+	p.queue.Push(&job{run, time.Now()}, queuePriority(priority, seq))
+	p.pending <- struct{}{}
+}
+
+// queuePriority orders the job with sequence number seq, clamping its
+// level to those in priorities so that the shift cannot overflow.
+func queuePriority(priority int, seq int64) int {
+	if priority < 0 {
+		priority = 0
+	} else if priority > maxPriority {
+		priority = maxPriority
+	}
+	return priority<<priorityShift - int(seq%(1<<priorityShift))
+}
+
+// close stops the workers once they have run the jobs queued.
+func (p *pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.pending)
+	}
+}
+
+func (p *pool) work() {
+	for range p.pending {
+		value, _ := p.queue.Pop()
+		j := value.(*job)
+		j.run(time.Since(j.enqueued))
+	}
+}
+
+// requestPriority reads the optional priority parameter of a request.
+func requestPriority(params interface{}) (int, error) {
+	fields, ok := params.(map[string]interface{})
+	if !ok {
+		return priorities["normal"], nil
+	}
+	raw, present := fields["priority"]
+	if !present {
+		return priorities["normal"], nil
+	}
+
+	name, _ := raw.(string)
+	priority, ok := priorities[name]
+	if !ok {
+		return 0, errors.New("Invalid priority parameter: must be one of high, normal or low")
+	}
+	return priority, nil
+}
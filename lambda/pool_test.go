@@ -0,0 +1,27 @@
+package lambda
+
+import "testing"
+
+func TestQueuePriority(t *testing.T) {
+	high, normal, low := priorities["high"], priorities["normal"], priorities["low"]
+	ordered := []int{
+		queuePriority(high, 1),
+		queuePriority(high, 2),
+		queuePriority(normal, 1),
+		queuePriority(normal, 1<<priorityShift-1),
+		queuePriority(low, 1),
+	}
+	for i := 1; i < len(ordered); i++ {
+		if ordered[i-1] <= ordered[i] {
+			t.Errorf("job %d is not served before job %d: %d <= %d", i-1, i, ordered[i-1], ordered[i])
+		}
+	}
+
+	// Levels out of range are clamped rather than shifted past the sign.
+	if got, want := queuePriority(1<<20, 1), queuePriority(high, 1); got != want {
+		t.Errorf("priority 1<<20: got %d, want that of high, %d", got, want)
+	}
+	if got, want := queuePriority(-5, 1), queuePriority(low, 1); got != want {
+		t.Errorf("priority -5: got %d, want that of low, %d", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+package lambda
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// printStyles are the ways a term can be printed, selected by the
+// format parameter. explicit is the String form, parenthesizing every
+// abstraction and application; compact omits the parentheses the
+// parser does not need and merges nested binders, as in \x y.x (y x);
+// canonical is compact with the binders renamed x0, x1, ... in order,
+// so that alpha-equivalent terms print the same.
+var printStyles = map[string]func(expression) string{
+	"explicit":  expression.String,
+	"compact":   printCompact,
+	"canonical": printCanonical,
+}
+
+const defaultPrintStyle = "explicit"
+
+// printStyleParam reads the optional format parameter of a request,
+// or style, its older name.
+func printStyleParam(params map[string]interface{}) (func(expression) string, error) {
+	name, param := defaultPrintStyle, "format"
+	raw, present := params["format"]
+	if !present {
+		raw, present = params["style"]
+		param = "style"
+	}
+	if present {
+		name, _ = raw.(string)
+	}
+	print, ok := printStyles[name]
+	if !ok {
+		return nil, fmt.Errorf("Invalid %s parameter: unknown style %q", param, name)
+	}
+	return print, nil
+}
+
+// printItem is a pending piece of a term being printed: a subterm, or
+// if expr is nil, text to write as is.
+type printItem struct {
+	expr expression
+	text string
+}
+
+// The printers keep their own stack rather than recursing, since terms
+// built by reduction may nest deeper than the goroutine stack allows.
+
+func printExplicit(expr expression) string {
+	var b strings.Builder
+	stack := []printItem{{expr: expr}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch e := top.expr.(type) {
+		case nil:
+			b.WriteString(top.text)
+		case *variable:
+			b.WriteString(e.name)
+		case *abstraction:
+			b.WriteString("(!" + e.parameter.name + ".")
+			stack = append(stack, printItem{text: ")"}, printItem{expr: e.body})
+		case *application:
+			b.WriteString("(")
+			stack = append(stack, printItem{text: ")"}, printItem{expr: e.right}, printItem{text: " "}, printItem{expr: e.left})
+		default:
+			panic("Invalid expression")
+		}
+	}
+	return b.String()
+}
+
+func printCompact(expr expression) string {
+	var b strings.Builder
+	stack := []printItem{{expr: expr}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch e := top.expr.(type) {
+		case nil:
+			b.WriteString(top.text)
+		case *variable:
+			b.WriteString(e.name)
+		case *abstraction:
+			b.WriteString(`\` + e.parameter.name)
+			body := e.body
+			for {
+				inner, ok := body.(*abstraction)
+				if !ok {
+					break
+				}
+				b.WriteString(" " + inner.parameter.name)
+				body = inner.body
+			}
+			b.WriteString(".")
+			stack = append(stack, printItem{expr: body})
+		case *application:
+			// Application is left associative, so only an abstraction
+			// on the left needs parentheses. On the right, an
+			// abstraction may go bare only if nothing follows it, which
+			// is not known here, so it is parenthesized too.
+			if _, ok := e.right.(*variable); ok {
+				stack = append(stack, printItem{expr: e.right})
+			} else {
+				stack = append(stack, printItem{text: ")"}, printItem{expr: e.right}, printItem{text: "("})
+			}
+			stack = append(stack, printItem{text: " "})
+			if _, ok := e.left.(*abstraction); ok {
+				stack = append(stack, printItem{text: ")"}, printItem{expr: e.left}, printItem{text: "("})
+			} else {
+				stack = append(stack, printItem{expr: e.left})
+			}
+		default:
+			panic("Invalid expression")
+		}
+	}
+	return b.String()
+}
+
+func printCanonical(expr expression) string {
+	return printCompact(canonicalNames(expr))
+}
+
+// canonicalNames renames the binders of expr to x0, x1, ... in the
+// order they appear, skipping names free in expr.
+func canonicalNames(expr expression) expression {
+	free := freeVariables(expr)
+	next := 0
+	fresh := func() string {
+		for {
+			name := "x" + strconv.Itoa(next)
+			next++
+			if !free[name] {
+				return name
+			}
+		}
+	}
+
+	var rename func(expression, map[string]string) expression
+	rename = func(expr expression, names map[string]string) expression {
+		switch e := expr.(type) {
+		case *variable:
+			if name, ok := names[e.name]; ok {
+				return &variable{name, e.span}
+			}
+			return e
+		case *abstraction:
+			name := fresh()
+			outer, shadowed := names[e.parameter.name]
+			names[e.parameter.name] = name
+			body := rename(e.body, names)
+			if shadowed {
+				names[e.parameter.name] = outer
+			} else {
+				delete(names, e.parameter.name)
+			}
+			return &abstraction{variable{name, e.parameter.span}, body, e.span}
+		case *application:
+			return &application{rename(e.left, names), rename(e.right, names), e.span}
+		default:
+			panic("Invalid expression")
+		}
+	}
+	return rename(expr, map[string]string{})
+}
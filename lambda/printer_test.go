@@ -0,0 +1,38 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+
+	"example.com/rpc"
+)
+
+func TestCanonicalFormat(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	ctx := rpc.WithSession(context.Background())
+	evaluate := func(params map[string]interface{}) string {
+		t.Helper()
+		params["expression"] = `(\f.\a.\b.f b a) (\p.\q.p)`
+		var result struct {
+			Expression string `json:"expression"`
+		}
+		decodeResult(t, s.ServeRPC(ctx, Request{ID: 1, Method: "evaluate", Params: params}), &result)
+		return result.Expression
+	}
+
+	const want = `\x0 x1.x1`
+	if got := evaluate(map[string]interface{}{"format": "canonical"}); got != want {
+		t.Errorf("format canonical: got %s, want %s", got, want)
+	}
+	if got := evaluate(map[string]interface{}{"style": "canonical"}); got != want {
+		t.Errorf("style canonical: got %s, want %s", got, want)
+	}
+
+	// A request giving the older name still overrides a default.
+	if response := s.ServeRPC(ctx, Request{ID: 2, Method: "configure", Params: map[string]interface{}{"settings": map[string]interface{}{"format": "compact"}}}); response.Error != nil {
+		t.Fatal(response.Error.Message)
+	}
+	if got := evaluate(map[string]interface{}{"style": "canonical"}); got != want {
+		t.Errorf("style canonical over a compact default: got %s, want %s", got, want)
+	}
+}
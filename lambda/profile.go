@@ -0,0 +1,50 @@
+package lambda
+
+// A reductionProfile counts the work of a reduction by the binder of
+// each contracted redex, so that the abstractions, and so the
+// definitions, responsible for most of it stand out. Binders are
+// grouped by name.
+type reductionProfile struct {
+	BetaSteps     int                       `json:"betaSteps"`
+	Substitutions int                       `json:"substitutions"`
+	Renames       int                       `json:"renames"`
+	ByBinder      map[string]*binderProfile `json:"byBinder"`
+}
+
+type binderProfile struct {
+	BetaSteps     int `json:"betaSteps"`
+	Substitutions int `json:"substitutions"`
+	Renames       int `json:"renames"`
+}
+
+func newReductionProfile() *reductionProfile {
+	return &reductionProfile{ByBinder: map[string]*binderProfile{}}
+}
+
+// observe is a reduce observer adding each contraction to p.
+func (p *reductionProfile) observe(before expression, at path) {
+	var counts substitutionCounts
+	binder, ok := countContraction(before, at, &counts)
+	if !ok {
+		return
+	}
+	b := p.ByBinder[binder.name]
+	if b == nil {
+		b = &binderProfile{}
+		p.ByBinder[binder.name] = b
+	}
+	b.BetaSteps++
+	b.Substitutions += counts.replaced
+	b.Renames += counts.renamed
+	p.BetaSteps++
+	p.Substitutions += counts.replaced
+	p.Renames += counts.renamed
+}
+
+// observer returns p.observe, or nil for no profile.
+func (p *reductionProfile) observer() func(expression, path) {
+	if p == nil {
+		return nil
+	}
+	return p.observe
+}
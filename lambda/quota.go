@@ -0,0 +1,190 @@
+package lambda
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultQuotaWindow = time.Hour
+
+// quotaTracker accounts the reduction steps, worker time and CPU time
+// each tenant spends on pooled requests over a rolling window, and refuses
+// work to tenants past their quota. A zero quota is unlimited.
+type quotaTracker struct {
+	window   time.Duration
+	maxSteps int
+	maxTime  time.Duration
+
+	mu      sync.Mutex
+	samples map[string][]usageSample
+}
+
+type usageSample struct {
+	at    time.Time
+	steps int
+	time  time.Duration
+	cpu   time.Duration
+}
+
+type tenantQuotaUsage struct {
+	Tenant string  `json:"tenant"`
+	Steps  int     `json:"steps"`
+	TimeMs float64 `json:"timeMs"`
+	CPUMs  float64 `json:"cpuMs"`
+}
+
+func newQuotaTracker(window time.Duration, maxSteps int, maxTime time.Duration) *quotaTracker {
+	if window <= 0 {
+		window = defaultQuotaWindow
+	}
+	return &quotaTracker{
+		window:   window,
+		maxSteps: maxSteps,
+		maxTime:  maxTime,
+		samples:  map[string][]usageSample{},
+	}
+}
+
+// stepMeter charges the steps of a pooled request to its tenant as
+// they are taken, rather than once it is answered, and stops the
+// request once the tenant's quota is spent.
+type stepMeter struct {
+	quota  *quotaTracker
+	tenant string
+	cancel context.CancelFunc
+	steps  int64
+	spent  int32
+}
+
+type stepMeterKey struct{}
+
+// withStepMeter returns a context whose reductions charge the steps
+// they take to meter, however they end.
+func withStepMeter(ctx context.Context, meter *stepMeter) context.Context {
+	return context.WithValue(ctx, stepMeterKey{}, meter)
+}
+
+// meterSteps charges n steps to the meter of ctx, if it has one.
+func meterSteps(ctx context.Context, n int) {
+	m, ok := ctx.Value(stepMeterKey{}).(*stepMeter)
+	if !ok || n == 0 {
+		return
+	}
+	atomic.AddInt64(&m.steps, int64(n))
+	m.quota.record(m.tenant, n, 0, 0)
+	if m.quota.exceeded(m.tenant) {
+		atomic.StoreInt32(&m.spent, 1)
+		m.cancel()
+	}
+}
+
+// quotaSpent reports whether the meter stopped its request.
+func (m *stepMeter) quotaSpent() bool {
+	return atomic.LoadInt32(&m.spent) != 0
+}
+
+// record adds to the usage of tenant. Usage within the same second
+// shares a sample, keeping busy tenants' samples few.
+func (q *quotaTracker) record(tenant string, steps int, spent, cpu time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	samples := q.samples[tenant]
+	if n := len(samples); n > 0 && now.Sub(samples[n-1].at) < time.Second {
+		samples[n-1].steps += steps
+		samples[n-1].time += spent
+		samples[n-1].cpu += cpu
+		return
+	}
+	q.samples[tenant] = append(samples, usageSample{now, steps, spent, cpu})
+}
+
+// usage sums what tenant spent within the window, forgetting older
+// samples.
+func (q *quotaTracker) usage(tenant string) (int, time.Duration, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usageLocked(tenant, time.Now())
+}
+
+func (q *quotaTracker) usageLocked(tenant string, now time.Time) (int, time.Duration, time.Duration) {
+	samples := q.samples[tenant]
+	for len(samples) > 0 && now.Sub(samples[0].at) > q.window {
+		samples = samples[1:]
+	}
+	if len(samples) == 0 {
+		delete(q.samples, tenant)
+		return 0, 0, 0
+	}
+	q.samples[tenant] = samples
+
+	steps, spent, cpu := 0, time.Duration(0), time.Duration(0)
+	for _, sample := range samples {
+		steps += sample.steps
+		spent += sample.time
+		cpu += sample.cpu
+	}
+	return steps, spent, cpu
+}
+
+// exceeded reports whether tenant has used up a quota.
+func (q *quotaTracker) exceeded(tenant string) bool {
+	if q.maxSteps <= 0 && q.maxTime <= 0 {
+		return false
+	}
+	steps, spent, _ := q.usage(tenant)
+	return q.maxSteps > 0 && steps >= q.maxSteps || q.maxTime > 0 && spent >= q.maxTime
+}
+
+// all reports the usage of every tenant with any within the window.
+func (q *quotaTracker) all() []tenantQuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	usage := []tenantQuotaUsage{}
+	for tenant := range q.samples {
+		steps, spent, cpu := q.usageLocked(tenant, now)
+		if steps > 0 || spent > 0 {
+			usage = append(usage, tenantQuotaUsage{tenant, steps, milliseconds(spent), milliseconds(cpu)})
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Tenant < usage[j].Tenant })
+	return usage
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// usageMethod reports what the connection's tenant has spent within
+// the quota window, and its quotas.
+func (c *connection) usageMethod(request Request) Response {
+	q := c.server.quota
+	tenant := c.tenantName()
+	steps, spent, cpu := q.usage(tenant)
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Tenant        string  `json:"tenant"`
+			Steps         int     `json:"steps"`
+			TimeMs        float64 `json:"timeMs"`
+			CPUMs         float64 `json:"cpuMs"`
+			WindowMs      float64 `json:"windowMs"`
+			StepQuota     int     `json:"stepQuota,omitempty"`
+			TimeQuotaMs   float64 `json:"timeQuotaMs,omitempty"`
+			QuotaExceeded bool    `json:"quotaExceeded"`
+		}{
+			Tenant:        tenant,
+			Steps:         steps,
+			TimeMs:        milliseconds(spent),
+			CPUMs:         milliseconds(cpu),
+			WindowMs:      milliseconds(q.window),
+			StepQuota:     q.maxSteps,
+			TimeQuotaMs:   milliseconds(q.maxTime),
+			QuotaExceeded: q.exceeded(tenant),
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package lambda
+
+import (
+	"math/rand"
+	"time"
+)
+
+// A seeded strategy makes random choices. The registered value is a
+// template; withSeed gives the instance used for a request.
+type seeded interface {
+	strategy
+	withSeed(seed int64) strategy
+	seed() int64
+}
+
+// randomOrder contracts a redex chosen uniformly at random, which
+// exercises reduction orders the deterministic strategies never take.
+type randomOrder struct {
+	rng       *rand.Rand
+	seedValue int64
+}
+
+func init() {
+	registerStrategy(randomOrder{})
+}
+
+func (randomOrder) name() string {
+	return "random"
+}
+
+func (randomOrder) description() string {
+	return "contracts a randomly chosen redex; replay a run by passing its seed"
+}
+
+func (r randomOrder) withSeed(seed int64) strategy {
+	return randomOrder{rand.New(rand.NewSource(seed)), seed}
+}
+
+func (r randomOrder) seed() int64 {
+	return r.seedValue
+}
+
+func (r randomOrder) step(expr expression) (expression, path, bool) {
+	redexes := redexPaths(expr)
+	if len(redexes) == 0 {
+		return expr, nil, false
+	}
+	at := redexes[r.rng.Intn(len(redexes))]
+	next, _ := contractAt(expr, at)
+	return next, at, true
+}
+
+func (randomOrder) isNormal(expr expression) bool {
+	return len(redexPaths(expr)) == 0
+}
+
+// seedParam reads the optional seed parameter, making one up if it is
+// missing. Generated seeds are kept exactly representable as JSON
+// numbers so a client can replay a run.
+func seedParam(params map[string]interface{}) int64 {
+	if raw, ok := params["seed"].(float64); ok {
+		return int64(raw)
+	}
+	return time.Now().UnixNano() & (1<<53 - 1)
+}
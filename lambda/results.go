@@ -0,0 +1,158 @@
+package lambda
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+	"unicode/utf8"
+)
+
+// A connection keeps the remainders of at most maxPendingChunks chunked
+// results, dropping the oldest past that, and each for at most
+// chunkTTL.
+const (
+	maxPendingChunks = 16
+	chunkTTL         = 10 * time.Minute
+)
+
+// A pendingChunk is the remainder of a chunked result not fetched yet.
+type pendingChunk struct {
+	rest   string
+	stored time.Time
+}
+
+type evaluateResult struct {
+	Expression string `json:"expression"`
+
+	// Ref names the result in later expressions of the same session.
+	Ref string `json:"ref,omitempty"`
+
+	// Handle, requested with handle: true, names the result in later
+	// expressions of any session.
+	Handle string `json:"handle,omitempty"`
+
+	// Truncated is set when the expression was cut at maxResultBytes;
+	// TotalBytes then gives the size of the full result.
+	Truncated  bool `json:"truncated,omitempty"`
+	TotalBytes int  `json:"totalBytes,omitempty"`
+
+	// Continuation is set when only the first chunkBytes of the result
+	// were returned. Pass it to fetchResult for the next chunk.
+	Continuation string `json:"continuation,omitempty"`
+
+	// Warnings lists parser warnings when the request asked for them.
+	Warnings []parseWarning `json:"warnings,omitempty"`
+
+	// Trace lists every reduction step when the request asked for it
+	// with trace: true, and TraceSummary what they cost.
+	Trace          []traceStep   `json:"trace,omitempty"`
+	TraceTruncated bool          `json:"traceTruncated,omitempty"`
+	TraceSummary   *traceSummary `json:"traceSummary,omitempty"`
+
+	// TraceFile replaces Trace with traceFile: true, naming the file
+	// the steps were written to.
+	TraceFile *traceFileInfo `json:"traceFile,omitempty"`
+
+	// Summary replaces the full result when the request asked for one;
+	// Expression then holds only a prefix of the printed term.
+	Summary *termSummary `json:"summary,omitempty"`
+}
+
+// shapeResult applies the size options of an evaluate request to the
+// printed result. Truncation wins over chunking when both are given.
+func (c *connection) shapeResult(expression string, maxResultBytes, chunkBytes int) evaluateResult {
+	if maxResultBytes > 0 && len(expression) > maxResultBytes {
+		return evaluateResult{
+			Expression: cutAt(expression, maxResultBytes),
+			Truncated:  true,
+			TotalBytes: len(expression),
+		}
+	}
+	if chunkBytes > 0 && len(expression) > chunkBytes {
+		chunk := cutAt(expression, chunkBytes)
+		return evaluateResult{
+			Expression:   chunk,
+			TotalBytes:   len(expression),
+			Continuation: c.storeChunks(expression[len(chunk):]),
+		}
+	}
+	return evaluateResult{Expression: expression}
+}
+
+// fetchResult returns the next chunk of a result started by evaluate
+// with chunkBytes. Each token can be used once, within chunkTTL and
+// before maxPendingChunks later ones; the last chunk comes without a
+// continuation.
+func (c *connection) fetchResult(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	token, _ := params["continuation"].(string)
+	chunkBytes, _, err := positiveInt(params, "chunkBytes")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	c.chunksMu.Lock()
+	pending, ok := c.chunks[token]
+	delete(c.chunks, token)
+	c.chunksMu.Unlock()
+	if !ok || time.Since(pending.stored) > chunkTTL {
+		return errorResponse(request.ID, codeInvalidParams, "Unknown or expired continuation token")
+	}
+	rest := pending.rest
+
+	if chunkBytes == 0 {
+		chunkBytes = len(rest)
+	}
+	chunk := cutAt(rest, chunkBytes)
+	result := evaluateResult{Expression: chunk}
+	if len(chunk) < len(rest) {
+		result.Continuation = c.storeChunks(rest[len(chunk):])
+	}
+	return Response{ID: request.ID, Result: result}
+}
+
+func (c *connection) storeChunks(rest string) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	now := time.Now()
+	c.chunksMu.Lock()
+	defer c.chunksMu.Unlock()
+	if c.chunks == nil {
+		c.chunks = map[string]pendingChunk{}
+	}
+	oldest := ""
+	for stored, pending := range c.chunks {
+		if now.Sub(pending.stored) > chunkTTL {
+			delete(c.chunks, stored)
+		} else if oldest == "" || pending.stored.Before(c.chunks[oldest].stored) {
+			oldest = stored
+		}
+	}
+	if len(c.chunks) >= maxPendingChunks {
+		delete(c.chunks, oldest)
+	}
+	c.chunks[token] = pendingChunk{rest, now}
+	return token
+}
+
+// cutAt returns the longest prefix of s of at most n bytes that does
+// not split a UTF-8 sequence, and never less than one rune.
+func cutAt(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		cut = size
+	}
+	return s[:cut]
+}
@@ -0,0 +1,61 @@
+package lambda
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/rpc"
+)
+
+func TestFetchResult(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	ctx := rpc.WithSession(context.Background())
+	c := s.connection(ctx)
+	evaluate := func() string {
+		t.Helper()
+		var result evaluateResult
+		decodeResult(t, s.ServeRPC(ctx, Request{ID: 1, Method: "evaluate", Params: map[string]interface{}{"expression": "a b c d", "chunkBytes": 4.0}}), &result)
+		return result.Continuation
+	}
+	fetch := func(token string) Response {
+		return s.ServeRPC(ctx, Request{ID: 2, Method: "fetchResult", Params: map[string]interface{}{"continuation": token}})
+	}
+
+	first := evaluate()
+	var rest evaluateResult
+	decodeResult(t, fetch(first), &rest)
+	if !strings.HasSuffix(rest.Expression, "d)") || rest.Continuation != "" {
+		t.Errorf("fetchResult: got %+v, want the rest of the result", rest)
+	}
+	if fetch(first).Error == nil {
+		t.Error("fetchResult with a used token succeeded, want an error")
+	}
+
+	// Only the latest maxPendingChunks tokens are kept.
+	oldest := evaluate()
+	for i := 0; i < maxPendingChunks; i++ {
+		evaluate()
+	}
+	if fetch(oldest).Error == nil {
+		t.Error("fetchResult with an evicted token succeeded, want an error")
+	}
+	c.chunksMu.Lock()
+	kept := len(c.chunks)
+	c.chunksMu.Unlock()
+	if kept != maxPendingChunks {
+		t.Errorf("%d tokens kept, want %d", kept, maxPendingChunks)
+	}
+
+	// Nor are tokens past their ttl.
+	expired := evaluate()
+	c.chunksMu.Lock()
+	pending := c.chunks[expired]
+	pending.stored = pending.stored.Add(-chunkTTL - time.Second)
+	c.chunks[expired] = pending
+	c.chunksMu.Unlock()
+	if fetch(expired).Error == nil {
+		t.Error("fetchResult with an expired token succeeded, want an error")
+	}
+}
@@ -0,0 +1,258 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"example.com/rpc"
+)
+
+func TestServeWithCustomMethod(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	s.HandleFunc("double", func(ctx context.Context, request Request) Response {
+		n, _ := request.Params.(float64)
+		return Response{ID: request.ID, Result: 2 * n}
+	})
+
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- rpc.Serve(context.Background(), server, s) }()
+
+	encoder := json.NewEncoder(client)
+	decoder := json.NewDecoder(client)
+	call := func(request Request) Response {
+		t.Helper()
+		if err := encoder.Encode(request); err != nil {
+			t.Fatal(err)
+		}
+		var response Response
+		if err := decoder.Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	if got := call(Request{ID: 1, Method: "double", Params: 21}); got.Result != 42.0 {
+		t.Errorf("double: got %v, want 42", got.Result)
+	}
+
+	evaluated := call(Request{ID: 2, Method: "evaluate", Params: map[string]interface{}{"expression": `(\x.x) a`}})
+	if evaluated.Error != nil {
+		t.Fatalf("evaluate: %v", evaluated.Error.Message)
+	}
+	// History belongs to the connection, so the reference resolves.
+	recalled := call(Request{ID: 3, Method: "evaluate", Params: map[string]interface{}{"expression": "$1"}})
+	if recalled.Error != nil {
+		t.Fatalf("evaluate $1: %v", recalled.Error.Message)
+	}
+	if result := recalled.Result.(map[string]interface{}); result["expression"] != "a" {
+		t.Errorf("evaluate $1: got %v, want a", result["expression"])
+	}
+
+	client.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
+
+func TestRegisterMethod(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	handler := rpc.HandlerFunc(func(ctx context.Context, request Request) Response {
+		return Response{ID: request.ID, Result: "ok"}
+	})
+
+	if err := s.RegisterMethod("decode", handler); err != nil {
+		t.Fatalf("RegisterMethod(decode): %v", err)
+	}
+	for _, name := range []string{"decode", "evaluate", "hello", "rpc.discover", ""} {
+		if err := s.RegisterMethod(name, handler); err == nil {
+			t.Errorf("RegisterMethod(%q) succeeded, want an error", name)
+		}
+	}
+	if got := s.ServeRPC(context.Background(), Request{ID: 1, Method: "decode"}); got.Result != "ok" {
+		t.Errorf("decode: got %v, want ok", got.Result)
+	}
+}
+
+func TestAbandonedEvaluation(t *testing.T) {
+	s := NewServer(Options{Workers: 1, MaxTimeout: time.Minute})
+	before := runtime.NumGoroutine()
+
+	client, server := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		s.ServeConn(server)
+		close(served)
+	}()
+	omega := Request{ID: 1, Method: "evaluate", Params: map[string]interface{}{"expression": `(\x.x x) (\x.x x)`}}
+	if err := json.NewEncoder(client).Encode(omega); err != nil {
+		t.Fatal(err)
+	}
+	// Let the evaluation start before the client goes away.
+	time.Sleep(50 * time.Millisecond)
+	client.Close()
+
+	// ServeConn waits for the requests in flight, so returning means the
+	// evaluation stopped, long before its timeout.
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the abandoned evaluation is still running")
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, want %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The only worker is free again.
+	client, server = net.Pipe()
+	go s.ServeConn(server)
+	defer client.Close()
+	if err := json.NewEncoder(client).Encode(Request{ID: 2, Method: "evaluate", Params: map[string]interface{}{"expression": `(\x.x) a`}}); err != nil {
+		t.Fatal(err)
+	}
+	var response Response
+	if err := json.NewDecoder(client).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error != nil {
+		t.Errorf("evaluate: %v", response.Error.Message)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	if err := s.RegisterMethod("decode", rpc.HandlerFunc(func(ctx context.Context, request Request) Response {
+		return Response{ID: request.ID}
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	result := s.ServeRPC(context.Background(), Request{ID: 1, Method: "describe"}).Result.(describeResult)
+	described := map[string]describedMethod{}
+	for _, method := range result.Methods {
+		described[method.Name] = method
+	}
+	// The description keeps up with the methods: it covers every one
+	// registered, and describes no built-in one that is not.
+	for _, name := range s.methods.Methods() {
+		if _, ok := described[name]; !ok {
+			t.Errorf("%s is not described", name)
+		}
+	}
+	for _, method := range spec.Methods {
+		if _, ok := s.methods.Handler(method.Name); !ok && method.Name != "hello" {
+			t.Errorf("%s is described but not registered", method.Name)
+		}
+	}
+	if !described["decode"].Custom {
+		t.Error("decode is not marked custom")
+	}
+}
+
+// TestCancelledEvaluation checks that evaluations whose client went
+// away stop with an error rather than passing the term they got to
+// off as the result.
+func TestCancelledEvaluation(t *testing.T) {
+	s := NewServer(Options{Workers: 1, MaxTimeout: time.Minute, ExperimentalOptimal: true})
+	ctx, abandon := context.WithCancel(rpc.WithSession(context.Background()))
+	abandon()
+	omega := `(\x.x x) (\x.x x)`
+	for _, method := range []string{"evaluate", "confluence", "optimal"} {
+		response := s.ServeRPC(ctx, Request{ID: 1, Method: method, Params: map[string]interface{}{"expression": omega}})
+		if response.Error == nil {
+			t.Errorf("%s: got %v, want an error", method, response.Result)
+		}
+	}
+}
+
+// TestQuotaSteps checks that pooled requests are charged the steps
+// they take, including those that give up at their step limit.
+func TestQuotaSteps(t *testing.T) {
+	s := NewServer(Options{Workers: 1})
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+	defer client.Close()
+	encoder := json.NewEncoder(client)
+	decoder := json.NewDecoder(client)
+
+	omega := `(\x.x x) (\x.x x)`
+	charged := 0
+	for i, test := range []struct {
+		method string
+		params map[string]interface{}
+		steps  int
+	}{
+		{"evaluate", map[string]interface{}{"expression": omega, "maxSteps": 500.0}, 500},
+		{"partialEval", map[string]interface{}{"expression": omega, "opaque": []interface{}{}, "maxSteps": 300.0}, 300},
+		{"analyzeStrictness", map[string]interface{}{"expression": `\a.` + omega, "maxSteps": 200.0}, 200},
+	} {
+		if err := encoder.Encode(Request{ID: i, Method: test.method, Params: test.params}); err != nil {
+			t.Fatal(err)
+		}
+		var response Response
+		if err := decoder.Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		charged += test.steps
+		if steps, _, _ := s.quota.usage(""); steps != charged {
+			t.Errorf("after %s: charged %d steps, want %d", test.method, steps, charged)
+		}
+	}
+}
+
+// Requests without an ID are metered apart however many run at once.
+func TestQuotaStepsWithoutIDs(t *testing.T) {
+	s := NewServer(Options{Workers: 2})
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+	defer client.Close()
+	encoder := json.NewEncoder(client)
+	decoder := json.NewDecoder(client)
+
+	params := map[string]interface{}{"expression": `(\x.x x) (\x.x x)`, "maxSteps": 20000.0}
+	for i := 0; i < 2; i++ {
+		if err := encoder.Encode(Request{Method: "evaluate", Params: params}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		var response Response
+		if err := decoder.Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if steps, _, _ := s.quota.usage(""); steps != 40000 {
+		t.Errorf("charged %d steps, want 40000", steps)
+	}
+}
+
+func TestQuotaStopsEvaluation(t *testing.T) {
+	s := NewServer(Options{Workers: 1, StepQuota: 10000})
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+	defer client.Close()
+	encoder := json.NewEncoder(client)
+	decoder := json.NewDecoder(client)
+
+	if err := encoder.Encode(Request{ID: 1, Method: "evaluate", Params: map[string]interface{}{"expression": `(\x.x x) (\x.x x)`}}); err != nil {
+		t.Fatal(err)
+	}
+	var response Response
+	if err := decoder.Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error == nil || response.Error.Code != codeLimitExceeded {
+		t.Fatalf("got error %+v, want the quota exceeded", response.Error)
+	}
+	if steps, _, _ := s.quota.usage(""); steps < 10000 || steps > 10000+yieldSteps {
+		t.Errorf("charged %d steps, want the quota of 10000 overrun by at most %d", steps, yieldSteps)
+	}
+}
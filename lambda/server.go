@@ -0,0 +1,903 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/rpc"
+)
+
+// The wire types are those of the rpc package.
+type (
+	Request  = rpc.Request
+	Response = rpc.Response
+	Error    = rpc.Error
+)
+
+const (
+	codeInvalidRequest = rpc.CodeInvalidRequest
+	codeMethodNotFound = rpc.CodeMethodNotFound
+	codeInvalidParams  = rpc.CodeInvalidParams
+	codeInternalError  = rpc.CodeInternalError
+	codeTimeout        = rpc.CodeTimeout
+	codeLimitExceeded  = rpc.CodeLimitExceeded
+	codeUnauthorized   = rpc.CodeUnauthorized
+)
+
+// A Server evaluates lambda terms for clients. It serves whole
+// connections with ServeConn and, as an rpc.Handler, individual
+// requests on connections managed by someone else.
+type Server struct {
+	maxTimeout    time.Duration
+	maxSteps      int
+	pool          *pool
+	handles       *handleStore
+	contents      *contentStore
+	shutdownToken string
+	tenants       map[string]string
+	quota         *quotaTracker
+	spans         *spanExporter
+	methods       *rpc.Mux
+	middleware    []rpc.Middleware
+
+	// experimentalOptimal enables the optimal method.
+	experimentalOptimal bool
+
+	// experimentalCBPV enables the cbpv method.
+	experimentalCBPV bool
+
+	// traceDir is where evaluate writes trace files; see
+	// Options.TraceDir.
+	traceDir string
+
+	// strict enforces JSON-RPC 2.0 on ServeConn connections.
+	strict bool
+
+	// templateValues are substituted for ${NAME} placeholders in
+	// expressions; see Options.TemplateValues.
+	templateValues map[string]string
+
+	// maxMessageBytes bounds the messages of the socket protocol and
+	// of the Content-Length framed ones.
+	maxMessageBytes int
+
+	// maxTermSize, if positive, bounds the size of terms under
+	// reduction.
+	maxTermSize int
+
+	// readOnly refuses the methods in mutatingMethods.
+	readOnly bool
+
+	// conns are the connections being served by ServeConn.
+	connsMu sync.Mutex
+	conns   map[*connection]struct{}
+
+	// cpuTime is the CPU time, in nanoseconds, spent running pooled
+	// requests.
+	cpuTime int64
+
+	// acceptFailures counts the connections the listener failed to
+	// accept.
+	acceptFailures int64
+
+	// active counts requests that are queued, running or being
+	// answered, so that shutdown can let them finish.
+	active       sync.WaitGroup
+	shuttingDown chan struct{}
+	shutdownOnce sync.Once
+
+	// restartRequests carries restart method calls to whoever owns the
+	// listener.
+	restartRequests chan struct{}
+}
+
+// Options configure a Server. Zero values select the defaults of the
+// lambda command.
+type Options struct {
+	// MaxTimeout bounds a single evaluation; requests may ask for less.
+	MaxTimeout time.Duration
+
+	// MaxSteps, if positive, bounds the reduction steps of a single
+	// evaluation; requests may ask for less.
+	MaxSteps int
+
+	// Workers evaluations run at once, and QueueSize more may wait.
+	Workers   int
+	QueueSize int
+
+	// HandleTTL is how long an unused term handle is kept.
+	HandleTTL time.Duration
+
+	// ShutdownToken enables the shutdown and restart methods for
+	// clients presenting it.
+	ShutdownToken string
+
+	// ExperimentalOptimal enables the optimal method.
+	ExperimentalOptimal bool
+
+	// ExperimentalCBPV enables the cbpv method.
+	ExperimentalCBPV bool
+
+	// TraceDir, if set, is the directory evaluate writes traces to with
+	// traceFile: true, for fetchTrace to read back a page at a time.
+	// Files are never removed by the server.
+	TraceDir string
+
+	// Tenants maps access tokens to the tenants they authenticate as
+	// with the authenticate method. Tenants cannot see each other's
+	// handles; clients that do not authenticate share the "" tenant.
+	Tenants map[string]string
+
+	// StepQuota and TimeQuota, if positive, bound the reduction steps
+	// and worker time each tenant may spend on evaluations within any
+	// QuotaWindow, an hour by default.
+	StepQuota   int
+	TimeQuota   time.Duration
+	QuotaWindow time.Duration
+
+	// OTLPEndpoint, if set, is the URL of an OpenTelemetry collector's
+	// OTLP/HTTP traces endpoint, such as
+	// http://localhost:4318/v1/traces, to export a span for every
+	// connection and request to.
+	OTLPEndpoint string
+
+	// Strict rejects requests that do not follow JSON-RPC 2.0 to the
+	// letter, and marks responses as JSON-RPC 2.0 ones.
+	Strict bool
+
+	// ReadOnly refuses the methods that change state shared with other
+	// clients, and the admin methods, for serving the evaluator to the
+	// public. Each client's own handles, history and settings still
+	// work.
+	ReadOnly bool
+
+	// TemplateValues, if any, are substituted for ${NAME} placeholders
+	// in incoming expressions before they are parsed, so that templated
+	// exercises can be parameterized by the server. Each value is
+	// spliced in as a parenthesized term. Without them, ${ is not
+	// special.
+	TemplateValues map[string]string
+
+	// MaxTermSize, if positive, bounds the number of nodes of a term
+	// under evaluation; requests may ask for less with maxTermSize.
+	// Clients are warned with evaluate/termSize notifications as the
+	// term grows toward it.
+	MaxTermSize int
+
+	// MaxMessageBytes bounds the size of a request, or of a Debug
+	// Adapter or Language Server Protocol message, 64 MiB if not
+	// positive.
+	MaxMessageBytes int
+}
+
+func NewServer(options Options) *Server {
+	if options.MaxTimeout <= 0 {
+		options.MaxTimeout = 30 * time.Second
+	}
+	if options.Workers <= 0 {
+		options.Workers = runtime.NumCPU()
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = 1024
+	}
+	if options.HandleTTL <= 0 {
+		options.HandleTTL = 10 * time.Minute
+	}
+	if options.MaxMessageBytes <= 0 {
+		options.MaxMessageBytes = 64 << 20
+	}
+
+	s := &Server{
+		maxTimeout:          options.MaxTimeout,
+		maxSteps:            options.MaxSteps,
+		pool:                newPool(options.Workers, options.QueueSize),
+		handles:             newHandleStore(options.HandleTTL),
+		contents:            newContentStore(),
+		shutdownToken:       options.ShutdownToken,
+		tenants:             options.Tenants,
+		quota:               newQuotaTracker(options.QuotaWindow, options.StepQuota, options.TimeQuota),
+		methods:             rpc.NewMux(),
+		experimentalOptimal: options.ExperimentalOptimal,
+		experimentalCBPV:    options.ExperimentalCBPV,
+		traceDir:            options.TraceDir,
+		readOnly:            options.ReadOnly,
+		maxTermSize:         options.MaxTermSize,
+		maxMessageBytes:     options.MaxMessageBytes,
+		templateValues:      options.TemplateValues,
+		strict:              options.Strict,
+		conns:               map[*connection]struct{}{},
+		shuttingDown:        make(chan struct{}),
+		restartRequests:     make(chan struct{}, 1),
+	}
+	if options.OTLPEndpoint != "" {
+		s.spans = newSpanExporter(options.OTLPEndpoint)
+	}
+	s.registerMethods()
+	return s
+}
+
+// mutatingMethods are refused in read-only mode: the admin methods,
+// and put, which adds to the content store all clients share.
+var mutatingMethods = map[string]bool{
+	"listTenants": true,
+	"purgeTenant": true,
+	"restart":     true,
+	"shutdown":    true,
+	"put":         true,
+}
+
+// handle registers a method, or, in read-only mode, refuses it if it is
+// one of mutatingMethods.
+func (s *Server) handle(name string, handler rpc.HandlerFunc) {
+	if s.readOnly && mutatingMethods[name] {
+		handler = func(ctx context.Context, request Request) Response {
+			return errorResponse(request.ID, codeMethodNotFound, name+" is disabled in read-only mode")
+		}
+	}
+	s.methods.Handle(name, handler)
+}
+
+func (s *Server) registerMethods() {
+	// Unknown methods echo their params back.
+	s.methods.NotFound = rpc.HandlerFunc(func(ctx context.Context, request Request) Response {
+		return Response{ID: request.ID, Result: request.Params}
+	})
+
+	for name, method := range map[string]func(Request) Response{
+		"lint":           s.lint,
+		"format":         s.format,
+		"listTenants":    s.listTenants,
+		"purgeTenant":    s.purgeTenant,
+		"restart":        s.restartMethod,
+		"metrics":        s.metricsMethod,
+		"listStrategies": listStrategies,
+		"decodeTerm":     decodeTerm,
+		"get":            s.getMethod,
+		"fetchTrace":     s.fetchTrace,
+		"describe":       s.describe,
+	} {
+		method := method
+		s.handle(name, func(ctx context.Context, request Request) Response {
+			return method(s.connection(ctx).applySettings(request))
+		})
+	}
+
+	for name, method := range map[string]func(*connection, Request) Response{
+		"evaluate":             s.evaluate,
+		"estimate":             (*connection).estimate,
+		"parse":                (*connection).parseMethod,
+		"subterm":              (*connection).subterm,
+		"replaceAt":            (*connection).replaceAtMethod,
+		"cps":                  (*connection).cps,
+		"lift":                 (*connection).lift,
+		"codegen":              (*connection).codegen,
+		"history":              (*connection).historyMethod,
+		"recall":               (*connection).recall,
+		"fetchResult":          (*connection).fetchResult,
+		"configure":            (*connection).configure,
+		"release":              (*connection).releaseMethod,
+		"authenticate":         s.authenticate,
+		"usage":                (*connection).usageMethod,
+		"diffTrace":            s.diffTrace,
+		"diff":                 (*connection).diff,
+		"stats":                (*connection).stats,
+		"analyzeStrictness":    (*connection).analyzeStrictness,
+		"substitute":           (*connection).substituteMethod,
+		"encodeTerm":           (*connection).encodeTerm,
+		"put":                  (*connection).putMethod,
+		"compare":              (*connection).compare,
+		"partialEval":          (*connection).partialEval,
+		"minimize":             (*connection).minimize,
+		"confluence":           (*connection).confluence,
+		"optimal":              (*connection).optimal,
+		"reduceCombinators":    (*connection).reduceCombinators,
+		"translateCombinators": (*connection).translateCombinators,
+		"explicitSubstitution": (*connection).explicitSubstitution,
+		"cbpv":                 (*connection).cbpv,
+		"checkLinear":          (*connection).checkLinear,
+		"bohmTree":             (*connection).bohmTree,
+		"levyLongoTree":        (*connection).levyLongoTree,
+		"solvable":             (*connection).solvable,
+
+		"debugStart":          (*connection).debugStart,
+		"debugSetBreakpoints": (*connection).debugSetBreakpoints,
+		"debugContinue":       s.debugResume,
+		"debugStepInto":       s.debugResume,
+		"debugStepOver":       s.debugResume,
+		"debugStop":           (*connection).debugStop,
+	} {
+		method := method
+		s.handle(name, func(ctx context.Context, request Request) Response {
+			c := s.connection(ctx)
+			return method(c, c.applySettings(request.WithContext(ctx)))
+		})
+	}
+
+	s.handle("shutdown", func(ctx context.Context, request Request) Response {
+		response := s.shutdownMethod(request)
+		if response.Error == nil {
+			s.BeginShutdown()
+		}
+		return response
+	})
+}
+
+// Handle registers a custom method. It panics if the method is
+// already taken, including by a built-in one.
+func (s *Server) Handle(method string, handler rpc.Handler) {
+	s.methods.Handle(method, handler)
+}
+
+func (s *Server) HandleFunc(method string, handler func(ctx context.Context, request Request) Response) {
+	s.methods.HandleFunc(method, handler)
+}
+
+// RegisterMethod registers a custom method like Handle, but reports
+// instead of panicking when name cannot be used: when it is taken, is
+// hello, which ServeConn answers itself, or starts with "rpc.", which
+// JSON-RPC 2.0 reserves. Custom methods go through the middleware added
+// with Use, as built-in ones do.
+func (s *Server) RegisterMethod(name string, handler rpc.Handler) error {
+	switch {
+	case name == "":
+		return errors.New("method name is empty")
+	case name == "hello" || strings.HasPrefix(name, "rpc."):
+		return fmt.Errorf("method name %q is reserved", name)
+	}
+	if _, taken := s.methods.Handler(name); taken {
+		return fmt.Errorf("method %q is already registered", name)
+	}
+	s.methods.Handle(name, handler)
+	return nil
+}
+
+// Use adds middleware around every method but hello, including custom
+// ones. Middleware added first sees requests first. Use must be called
+// before the server starts serving.
+func (s *Server) Use(middleware ...rpc.Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// ServeRPC answers a single request. Session state such as history is
+// kept in the rpc.Session of ctx; without one, each request starts
+// afresh. The hello method, which changes how a connection is encoded,
+// is only available under ServeConn.
+func (s *Server) ServeRPC(ctx context.Context, request Request) Response {
+	serve := func() Response {
+		return recoverResponse(request, func() Response {
+			return rpc.Chain(s.methods, s.middleware...).ServeRPC(ctx, request)
+		})
+	}
+	var response Response
+	if s.spans != nil {
+		response = s.traceRequest(ctx, request, serve)
+	} else {
+		response = serve()
+	}
+	response.Traceparent = request.Traceparent
+	return s.connection(ctx).withConnectionInfo(request, response)
+}
+
+// connection returns the state of the session of ctx.
+func (s *Server) connection(ctx context.Context) *connection {
+	session := rpc.SessionFrom(ctx)
+	if session == nil {
+		return &connection{server: s}
+	}
+	return session.Load(s, func() interface{} {
+		return &connection{server: s}
+	}).(*connection)
+}
+
+// RestartRequests delivers calls of the restart method.
+func (s *Server) RestartRequests() <-chan struct{} {
+	return s.restartRequests
+}
+
+type expression interface {
+	String() string
+}
+
+// span is the byte range [Start, End) of the source text a node was
+// parsed from. Nodes built during reduction keep the span of the node
+// they were derived from, or have the zero span if there is none.
+type span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+func (s span) known() bool {
+	return s.End > s.Start
+}
+
+type variable struct {
+	name string
+	span span
+}
+
+func (v *variable) String() string {
+	return v.name
+}
+
+type abstraction struct {
+	parameter variable
+	body      expression
+	span      span
+}
+
+func (a *abstraction) String() string {
+	return printExplicit(a)
+}
+
+type application struct {
+	left  expression
+	right expression
+	span  span
+}
+
+func (app *application) String() string {
+	return printExplicit(app)
+}
+
+// step performs a single normal-order (leftmost-outermost) beta
+// reduction. It reports false when expr is already in normal form.
+func step(expr expression) (expression, bool) {
+	next, _, ok := normalOrder{}.step(expr)
+	return next, ok
+}
+
+// normalize reduces expr to normal form, giving up once ctx is done.
+// It returns the number of beta steps performed.
+func normalize(ctx context.Context, expr expression) (expression, int, error) {
+	return reduce(ctx, normalOrder{}, expr, 0, nil)
+}
+
+// substitute replaces the free occurrences of _variable in expr with
+// value, renaming binders that would otherwise capture free variables
+// of value.
+func substitute(expr expression, _variable variable, value expression) expression {
+	return substituteCounting(expr, _variable, value, nil)
+}
+
+// substitutionCounts tallies the work of substitutions: the variable
+// occurrences replaced, the binders renamed to avoid capture and the
+// term nodes built.
+type substitutionCounts struct {
+	replaced int
+	renamed  int
+	built    int
+}
+
+// substituteCounting is substitute, adding its work to counts unless
+// counts is nil.
+func substituteCounting(expr expression, _variable variable, value expression, counts *substitutionCounts) expression {
+	switch e := expr.(type) {
+	case *variable:
+		if e.name == _variable.name {
+			if counts != nil {
+				counts.replaced++
+			}
+			return value
+		}
+		return e
+	case *abstraction:
+		if e.parameter.name == _variable.name {
+			return e
+		}
+		if !freeVariables(e.body)[_variable.name] {
+			return e
+		}
+		if counts != nil {
+			counts.built++
+		}
+		if free := freeVariables(value); free[e.parameter.name] {
+			used := freeVariables(e.body)
+			for name := range free {
+				used[name] = true
+			}
+			fresh := variable{freshName(e.parameter.name, used), e.parameter.span}
+			// Renaming builds terms too, but replaces no argument.
+			var renaming *substitutionCounts
+			if counts != nil {
+				renaming = &substitutionCounts{}
+			}
+			body := substituteCounting(e.body, e.parameter, &variable{fresh.name, fresh.span}, renaming)
+			if counts != nil {
+				counts.renamed += 1 + renaming.renamed
+				counts.built += 1 + renaming.built
+			}
+			return &abstraction{fresh, substituteCounting(body, _variable, value, counts), e.span}
+		}
+		return &abstraction{e.parameter, substituteCounting(e.body, _variable, value, counts), e.span}
+	case *application:
+		if counts != nil {
+			counts.built++
+		}
+		return &application{substituteCounting(e.left, _variable, value, counts), substituteCounting(e.right, _variable, value, counts), e.span}
+	default:
+		panic("Invalid expression")
+	}
+}
+
+// spanOf returns the source span of expr.
+func spanOf(expr expression) span {
+	switch e := expr.(type) {
+	case *variable:
+		return e.span
+	case *abstraction:
+		return e.span
+	case *application:
+		return e.span
+	default:
+		return span{}
+	}
+}
+
+func freeVariables(expr expression) map[string]bool {
+	free := map[string]bool{}
+	var walk func(expression, map[string]bool)
+	walk = func(expr expression, bound map[string]bool) {
+		switch e := expr.(type) {
+		case *variable:
+			if !bound[e.name] {
+				free[e.name] = true
+			}
+		case *abstraction:
+			if bound[e.parameter.name] {
+				walk(e.body, bound)
+				return
+			}
+			bound[e.parameter.name] = true
+			walk(e.body, bound)
+			delete(bound, e.parameter.name)
+		case *application:
+			walk(e.left, bound)
+			walk(e.right, bound)
+		}
+	}
+	walk(expr, map[string]bool{})
+	return free
+}
+
+// freshName derives a name from base that does not occur in used.
+func freshName(base string, used map[string]bool) string {
+	for i := 1; ; i++ {
+		name := base + strconv.Itoa(i)
+		if !used[name] {
+			return name
+		}
+	}
+}
+
+func (s *Server) evaluate(c *connection, request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	if _, many := params["expressions"]; many {
+		return s.evaluateMany(c, request, params)
+	}
+	definitions, err := c.definitionsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	macros, err := c.macrosParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	return s.evaluateWith(c, request, params, definitions, macros)
+}
+
+// evaluateWith evaluates the expression parameter of request, with the
+// names in definitions standing for their terms and those in macros
+// expanded before evaluation.
+func (s *Server) evaluateWith(c *connection, request Request, params map[string]interface{}, definitions, macros map[string]expression) Response {
+	expression, ok := params["expression"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid expression parameter")
+	}
+
+	timeout, err := s.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := s.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	print, err := printStyleParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	maxResultBytes, _, err := positiveInt(params, "maxResultBytes")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	chunkBytes, _, err := positiveInt(params, "chunkBytes")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	summary, _ := params["summary"].(bool)
+	keep, _ := params["handle"].(bool)
+	wantWarnings, _ := params["warnings"].(bool)
+	wantTrace, _ := params["trace"].(bool)
+	wantTraceFile, _ := params["traceFile"].(bool)
+	if wantTraceFile && s.traceDir == "" {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid traceFile parameter: the server has no trace directory; start it with -trace-dir")
+	}
+	wantProfile, _ := params["profile"].(bool)
+	typeCheck, _ := params["typeCheck"].(bool)
+	maxTermSize, sizeWarnings, err := s.sizeLimitsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	traceOptions, err := traceOptionsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	strategy, err := strategyParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	summaryPrefixBytes, present, err := positiveInt(params, "summaryPrefixBytes")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if !present {
+		summaryPrefixBytes = defaultSummaryPrefixBytes
+	}
+
+	parse, err := c.syntaxParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	express, warnings, err := parse(expression, c.resolve)
+	if !wantWarnings {
+		warnings = nil
+	}
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	express = expandDefinitions(express, definitions)
+	var expansion *macroExpansion
+	if len(macros) > 0 {
+		expansion = newMacroExpansion(macrosWithDefinitions(macros, definitions))
+		express = expansion.expand(express)
+	}
+	typed := typeCheck && simplyTyped(express)
+	if typed {
+		// The term normalizes, so growth is no sign of divergence, and
+		// the server's step limit is raised; one the request sets
+		// itself is kept, up to the raised limit.
+		sizeWarnings = nil
+		if s.maxSteps > 0 && s.maxSteps <= math.MaxInt/typedStepFactor {
+			requested, given, _ := positiveInt(params, "maxSteps")
+			maxSteps = s.maxSteps * typedStepFactor
+			if given && requested < maxSteps {
+				maxSteps = requested
+			}
+		}
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	result, steps := express, 0
+	var trace []traceStep
+	var traceSummary *traceSummary
+	var traceTruncated bool
+	var profile *reductionProfile
+	if wantProfile {
+		profile = newReductionProfile()
+	}
+	var guard *sizeGuard
+	if maxTermSize > 0 || len(sizeWarnings) > 0 {
+		guard = &sizeGuard{limit: maxTermSize, warnings: sizeWarnings, cancel: cancel}
+		guard.warn = func(size, step, threshold int) {
+			c.notify(request.ID, "evaluate/termSize", termSizeWarning{size, step, threshold, maxTermSize})
+		}
+	}
+	var file *traceFile
+	if wantTraceFile {
+		if file, err = s.createTraceFile(print); err != nil {
+			return errorResponse(request.ID, codeInternalError, err.Error())
+		}
+	}
+	observe := observeAll(profile.observer(), guard.observer(), file.observer())
+	if wantTrace && file == nil {
+		result, steps, trace, traceSummary, traceTruncated, err = reduceTraced(ctx, strategy, express, maxSteps, print, traceOptions, observe)
+	} else {
+		result, steps, err = reduce(ctx, strategy, express, maxSteps, observe)
+	}
+	var fileInfo *traceFileInfo
+	if file != nil {
+		// The normal form ends the trace, if reduction reached it.
+		last := result
+		if err != nil {
+			last = nil
+		}
+		info, closeErr := file.close(last)
+		if closeErr != nil {
+			return errorResponse(request.ID, codeInternalError, "writing the trace file: "+closeErr.Error())
+		}
+		fileInfo = &info
+	}
+	if guard != nil && err == nil {
+		guard.check(result)
+	}
+	if guard != nil && guard.exceeded {
+		return errorResponse(request.ID, codeLimitExceeded, fmt.Sprintf("evaluation stopped at step %d: the term grew to %d nodes, past the limit of %d", guard.step, guard.size, maxTermSize))
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorResponse(request.ID, codeTimeout, fmt.Sprintf("evaluation timed out after %s (%d steps)", timeout, steps))
+	}
+	if errors.Is(err, context.Canceled) {
+		return errorResponse(request.ID, codeTimeout, fmt.Sprintf("evaluation abandoned after %d steps: the client went away", steps))
+	}
+	if errors.Is(err, errStepLimit) {
+		return errorResponse(request.ID, codeLimitExceeded, fmt.Sprintf("evaluation stopped at the limit of %d steps", steps))
+	}
+
+	meta := map[string]interface{}{"steps": steps, "headNormalForm": isHeadNormal(result), "hash": termHash(result)}
+	if random, ok := strategy.(seeded); ok {
+		meta["seed"] = random.seed()
+	}
+	if profile != nil {
+		meta["profile"] = profile
+	}
+	if expansion != nil {
+		meta["macroSteps"] = expansion.steps
+	}
+	if typeCheck {
+		meta["simplyTyped"] = typed
+		meta["maxSteps"] = maxSteps
+	}
+	index := c.remember(expression, result, map[string]interface{}{"steps": steps})
+	var handle string
+	if keep {
+		handle, err = s.handles.put(c.tenantName(), result)
+		if err != nil {
+			return errorResponse(request.ID, codeLimitExceeded, err.Error())
+		}
+	}
+
+	if summary {
+		printed := print(result)
+		prefix := cutAt(printed, summaryPrefixBytes)
+		return Response{
+			ID: request.ID,
+			Result: evaluateResult{
+				Expression:     prefix,
+				Truncated:      len(prefix) < len(printed),
+				TotalBytes:     len(printed),
+				Summary:        summarize(result),
+				Ref:            "$" + strconv.Itoa(index),
+				Handle:         handle,
+				Warnings:       warnings,
+				Trace:          trace,
+				TraceTruncated: traceTruncated,
+				TraceSummary:   traceSummary,
+				TraceFile:      fileInfo,
+			},
+			Meta: meta,
+		}
+	}
+
+	shaped := c.shapeResult(print(result), maxResultBytes, chunkBytes)
+	shaped.Ref = "$" + strconv.Itoa(index)
+	shaped.Handle = handle
+	shaped.Warnings = warnings
+	shaped.Trace = trace
+	shaped.TraceTruncated = traceTruncated
+	shaped.TraceSummary = traceSummary
+	shaped.TraceFile = fileInfo
+	return Response{
+		ID:     request.ID,
+		Result: shaped,
+		Meta:   meta,
+	}
+}
+
+// parseMethod parses an expression without evaluating it and returns
+// its printed form, plus parser warnings when asked for with
+// warnings: true.
+func (c *connection) parseMethod(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	source, ok := params["expression"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid expression parameter")
+	}
+	wantWarnings, _ := params["warnings"].(bool)
+	parse, err := c.syntaxParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	expr, warnings, err := parse(source, c.resolve)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if !wantWarnings {
+		warnings = nil
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Expression string         `json:"expression"`
+			Warnings   []parseWarning `json:"warnings,omitempty"`
+		}{
+			Expression: expr.String(),
+			Warnings:   warnings,
+		},
+	}
+}
+
+// positiveInt reads an optional positive integer parameter. A missing
+// parameter yields zero.
+func positiveInt(params map[string]interface{}, name string) (int, bool, error) {
+	raw, present := params[name]
+	if !present {
+		return 0, false, nil
+	}
+	value, ok := raw.(float64)
+	if !ok || value < 1 || value != float64(int(value)) {
+		return 0, true, fmt.Errorf("Invalid %s parameter", name)
+	}
+	return int(value), true, nil
+}
+
+// timeoutParam reads the optional timeoutMs parameter, capped at the
+// server's maximum.
+func (s *Server) timeoutParam(params map[string]interface{}) (time.Duration, error) {
+	timeout := s.maxTimeout
+	if raw, present := params["timeoutMs"]; present {
+		ms, ok := raw.(float64)
+		if !ok || ms <= 0 {
+			return 0, errors.New("Invalid timeoutMs parameter")
+		}
+		if requested := time.Duration(ms * float64(time.Millisecond)); requested < timeout {
+			timeout = requested
+		}
+	}
+	return timeout, nil
+}
+
+// maxStepsParam reads the optional maxSteps parameter, capped at the
+// server's maximum. Zero means no limit.
+func (s *Server) maxStepsParam(params map[string]interface{}) (int, error) {
+	maxSteps, present, err := positiveInt(params, "maxSteps")
+	if err != nil {
+		return 0, err
+	}
+	if !present || s.maxSteps > 0 && maxSteps > s.maxSteps {
+		return s.maxSteps, nil
+	}
+	return maxSteps, nil
+}
+
+func errorResponse(id interface{}, code int, message string) Response {
+	return rpc.ErrorResponse(id, code, message)
+}
+
+// invalidParams answers a request whose params are wrong with err, with
+// the offending input rendered for a syntax error.
+func invalidParams(id interface{}, err error) Response {
+	response := errorResponse(id, codeInvalidParams, err.Error())
+	var syntax *syntaxError
+	if errors.As(err, &syntax) && syntax.source != "" {
+		response.Error.Data = syntax.data()
+	}
+	return response
+}
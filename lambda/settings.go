@@ -0,0 +1,182 @@
+package lambda
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// configurable lists the params a session can set defaults for, each
+// with a check that a value is valid.
+var configurable = map[string]func(s *Server, params map[string]interface{}) error{
+	"strategy": func(s *Server, params map[string]interface{}) error {
+		_, err := strategyParam(params)
+		return err
+	},
+	"maxSteps": func(s *Server, params map[string]interface{}) error {
+		_, err := s.maxStepsParam(params)
+		return err
+	},
+	"timeoutMs": func(s *Server, params map[string]interface{}) error {
+		_, err := s.timeoutParam(params)
+		return err
+	},
+	"maxTermSize": func(s *Server, params map[string]interface{}) error {
+		_, _, err := s.sizeLimitsParam(params)
+		return err
+	},
+	"termSizeWarnings": func(s *Server, params map[string]interface{}) error {
+		_, _, err := s.sizeLimitsParam(params)
+		return err
+	},
+	"format": func(s *Server, params map[string]interface{}) error {
+		_, err := printStyleParam(params)
+		return err
+	},
+	"style": func(s *Server, params map[string]interface{}) error {
+		_, err := printStyleParam(params)
+		return err
+	},
+	"syntax": func(s *Server, params map[string]interface{}) error {
+		_, err := syntaxParam(params)
+		return err
+	},
+	"trace": func(s *Server, params map[string]interface{}) error {
+		if _, ok := params["trace"].(bool); !ok {
+			return errors.New("Invalid trace parameter")
+		}
+		return nil
+	},
+	"profile": func(s *Server, params map[string]interface{}) error {
+		if _, ok := params["profile"].(bool); !ok {
+			return errors.New("Invalid profile parameter")
+		}
+		return nil
+	},
+	"typeCheck": func(s *Server, params map[string]interface{}) error {
+		if _, ok := params["typeCheck"].(bool); !ok {
+			return errors.New("Invalid typeCheck parameter")
+		}
+		return nil
+	},
+	"connectionInfo": func(s *Server, params map[string]interface{}) error {
+		if _, ok := params["connectionInfo"].(bool); !ok {
+			return errors.New("Invalid connectionInfo parameter")
+		}
+		return nil
+	},
+}
+
+// configure sets defaults for params of later requests in the session,
+// for one method or, without a method parameter, for all of them. A
+// null value removes a default. Limits such as maxSteps are still
+// capped by the server when a request is served.
+func (c *connection) configure(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	method := ""
+	if raw, present := params["method"]; present {
+		method, _ = raw.(string)
+		if _, ok := c.server.methods.Handler(method); !ok {
+			return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid method parameter: unknown method %q", method))
+		}
+	}
+	settings, ok := params["settings"].(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid settings parameter")
+	}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		check, ok := configurable[name]
+		if !ok {
+			return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid settings parameter: %s cannot be configured", name))
+		}
+		if value := settings[name]; value != nil {
+			if err := check(c.server, map[string]interface{}{name: value}); err != nil {
+				return invalidParams(request.ID, err)
+			}
+		}
+	}
+
+	c.settingsMu.Lock()
+	defer c.settingsMu.Unlock()
+	if c.settings == nil {
+		c.settings = map[string]map[string]interface{}{}
+	}
+	scoped := c.settings[method]
+	if scoped == nil {
+		scoped = map[string]interface{}{}
+		c.settings[method] = scoped
+	}
+	for name, value := range settings {
+		if value == nil {
+			delete(scoped, name)
+		} else {
+			scoped[name] = value
+		}
+	}
+
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Settings map[string]map[string]interface{} `json:"settings"`
+		}{
+			Settings: copySettings(c.settings),
+		},
+	}
+}
+
+func copySettings(settings map[string]map[string]interface{}) map[string]map[string]interface{} {
+	copied := map[string]map[string]interface{}{}
+	for method, scoped := range settings {
+		if len(scoped) == 0 {
+			continue
+		}
+		copied[method] = map[string]interface{}{}
+		for name, value := range scoped {
+			copied[method][name] = value
+		}
+	}
+	return copied
+}
+
+// applySettings fills in the session's defaults for params the request
+// leaves out, preferring those configured for its method.
+func (c *connection) applySettings(request Request) Request {
+	c.settingsMu.Lock()
+	defer c.settingsMu.Unlock()
+	if len(c.settings[""]) == 0 && len(c.settings[request.Method]) == 0 {
+		return request
+	}
+
+	params, ok := request.Params.(map[string]interface{})
+	if !ok && request.Params != nil {
+		return request
+	}
+	merged := map[string]interface{}{}
+	for _, layer := range []map[string]interface{}{c.settings[""], c.settings[request.Method], params} {
+		for name, value := range layer {
+			if current, ok := paramAliases[name]; ok {
+				if _, both := layer[current]; both {
+					continue
+				}
+				name = current
+			}
+			merged[name] = value
+		}
+	}
+	request.Params = merged
+	return request
+}
+
+// paramAliases maps the older names of params to their current ones,
+// under which settings are merged, so that a request overrides a
+// default given by either name.
+var paramAliases = map[string]string{"style": "format"}
@@ -0,0 +1,138 @@
+package lambda
+
+import (
+	"crypto/subtle"
+	"log"
+	"time"
+)
+
+// BeginShutdown stops the server from accepting connections. It is
+// safe to call more than once.
+func (s *Server) BeginShutdown() {
+	s.shutdownOnce.Do(func() {
+		close(s.shuttingDown)
+	})
+}
+
+// ShuttingDown is closed once shutdown begins.
+func (s *Server) ShuttingDown() <-chan struct{} {
+	return s.shuttingDown
+}
+
+func (s *Server) IsShuttingDown() bool {
+	select {
+	case <-s.shuttingDown:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain waits for queued and running evaluations to be answered, but
+// no longer than grace. It first sends a server/shuttingDown
+// notification with the deadline on every open connection, so that
+// clients stop sending requests and reconnect elsewhere.
+func (s *Server) Drain(grace time.Duration) {
+	s.announceShutdown(time.Now().Add(grace))
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		log.Println("Shutdown grace period expired with evaluations still running")
+	}
+	if s.spans != nil {
+		s.spans.flush()
+	}
+}
+
+// Close stops the goroutines NewServer started: the workers, once they
+// have run the requests queued, the collector of expired handles and
+// the span exporter, which first sends the spans it holds. Requests
+// still pooled after Close run on the connection's own goroutine. It
+// must be called only once.
+func (s *Server) Close() error {
+	s.pool.close()
+	s.handles.close()
+	if s.spans != nil {
+		s.spans.close()
+	}
+	return nil
+}
+
+func (s *Server) announceShutdown(deadline time.Time) {
+	s.connsMu.Lock()
+	conns := make([]*connection, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.connsMu.Unlock()
+
+	params := struct {
+		Deadline string `json:"deadline"`
+	}{
+		Deadline: deadline.UTC().Format(time.RFC3339Nano),
+	}
+	for _, c := range conns {
+		c.notify(nil, "server/shuttingDown", params)
+	}
+}
+
+// shutdownMethod lets a client stop the server, typically a test
+// harness that spawned it. It is only enabled when the server was
+// started with -shutdown-token, and the request must present the same
+// token.
+func (s *Server) shutdownMethod(request Request) Response {
+	if s.shutdownToken == "" {
+		return errorResponse(request.ID, codeMethodNotFound, "shutdown is disabled; start the server with -shutdown-token")
+	}
+
+	if !s.authorized(request) {
+		return errorResponse(request.ID, codeUnauthorized, "Invalid shutdown token")
+	}
+
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			ShuttingDown bool `json:"shuttingDown"`
+		}{
+			ShuttingDown: true,
+		},
+	}
+}
+
+// restartMethod asks the server to re-execute itself without dropping
+// the socket, as SIGUSR2 does. It takes the same token as shutdown.
+func (s *Server) restartMethod(request Request) Response {
+	if s.shutdownToken == "" {
+		return errorResponse(request.ID, codeMethodNotFound, "restart is disabled; start the server with -shutdown-token")
+	}
+	if !s.authorized(request) {
+		return errorResponse(request.ID, codeUnauthorized, "Invalid shutdown token")
+	}
+
+	select {
+	case s.restartRequests <- struct{}{}:
+	default:
+		// A restart is already pending.
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Restarting bool `json:"restarting"`
+		}{
+			Restarting: true,
+		},
+	}
+}
+
+func (s *Server) authorized(request Request) bool {
+	params, _ := request.Params.(map[string]interface{})
+	token, _ := params["token"].(string)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.shutdownToken)) == 1
+}
@@ -0,0 +1,456 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// This file holds the λσ calculus of explicit substitutions, after
+// Abadi, Cardelli, Curien and Lévy. Terms use de Bruijn indices and
+// substitution is part of the term language: beta leaves a closure
+// a[s] behind, and the σ rules push it through the term one rewrite at
+// a time, so a trace shows every step ordinary substitution takes at
+// once. Substitutions are id, the shift ↑, a·s, which replaces index 1
+// by a and the others by s, and compositions s∘t.
+
+const defaultSigmaSteps = 10000
+
+type sigmaTerm interface{ isSigmaTerm() }
+
+type sigmaSub interface{ isSigmaSub() }
+
+// sigmaOne is the index 1; index n is written 1[↑∘…∘↑] with n-1
+// shifts.
+type sigmaOne struct{}
+
+type sigmaLambda struct{ body sigmaTerm }
+
+type sigmaApply struct{ left, right sigmaTerm }
+
+type sigmaClosure struct {
+	term sigmaTerm
+	sub  sigmaSub
+}
+
+type sigmaID struct{}
+
+type sigmaShift struct{}
+
+type sigmaCons struct {
+	term sigmaTerm
+	sub  sigmaSub
+}
+
+type sigmaCompose struct{ left, right sigmaSub }
+
+func (sigmaOne) isSigmaTerm()     {}
+func (sigmaLambda) isSigmaTerm()  {}
+func (sigmaApply) isSigmaTerm()   {}
+func (sigmaClosure) isSigmaTerm() {}
+func (sigmaID) isSigmaSub()       {}
+func (sigmaShift) isSigmaSub()    {}
+func (sigmaCons) isSigmaSub()     {}
+func (sigmaCompose) isSigmaSub()  {}
+
+// toSigma translates expr, with free lists its free variables, which
+// take the indices after those of the binders around them.
+func toSigma(expr expression, bound, free []string) sigmaTerm {
+	switch e := expr.(type) {
+	case *abstraction:
+		return sigmaLambda{toSigma(e.body, append(bound, e.parameter.name), free)}
+	case *application:
+		return sigmaApply{toSigma(e.left, bound, free), toSigma(e.right, bound, free)}
+	case *variable:
+		for i := len(bound) - 1; i >= 0; i-- {
+			if bound[i] == e.name {
+				return sigmaIndex(len(bound) - i)
+			}
+		}
+		return sigmaIndex(len(bound) + 1 + sort.SearchStrings(free, e.name))
+	}
+	panic("Invalid expression")
+}
+
+func sigmaIndex(n int) sigmaTerm {
+	if n == 1 {
+		return sigmaOne{}
+	}
+	var shifts sigmaSub = sigmaShift{}
+	for i := 2; i < n; i++ {
+		shifts = sigmaCompose{sigmaShift{}, shifts}
+	}
+	return sigmaClosure{sigmaOne{}, shifts}
+}
+
+// sigmaRoot rewrites the redex at the root of t, returning the rule
+// applied.
+func sigmaRoot(t sigmaTerm) (sigmaTerm, string, bool) {
+	switch e := t.(type) {
+	case sigmaApply:
+		if fn, ok := e.left.(sigmaLambda); ok {
+			return sigmaClosure{fn.body, sigmaCons{e.right, sigmaID{}}}, "Beta", true
+		}
+	case sigmaClosure:
+		switch a := e.term.(type) {
+		case sigmaApply:
+			return sigmaApply{sigmaClosure{a.left, e.sub}, sigmaClosure{a.right, e.sub}}, "App", true
+		case sigmaLambda:
+			return sigmaLambda{sigmaClosure{a.body, sigmaCons{sigmaOne{}, sigmaCompose{e.sub, sigmaShift{}}}}}, "Abs", true
+		case sigmaClosure:
+			return sigmaClosure{a.term, sigmaCompose{a.sub, e.sub}}, "Clos", true
+		case sigmaOne:
+			switch s := e.sub.(type) {
+			case sigmaID:
+				return sigmaOne{}, "VarId", true
+			case sigmaCons:
+				return s.term, "VarCons", true
+			}
+		}
+	}
+	return t, "", false
+}
+
+func sigmaSubRoot(s sigmaSub) (sigmaSub, string, bool) {
+	c, ok := s.(sigmaCompose)
+	if !ok {
+		return s, "", false
+	}
+	switch l := c.left.(type) {
+	case sigmaID:
+		return c.right, "IdL", true
+	case sigmaShift:
+		switch r := c.right.(type) {
+		case sigmaID:
+			return sigmaShift{}, "ShiftId", true
+		case sigmaCons:
+			return r.sub, "ShiftCons", true
+		}
+	case sigmaCons:
+		return sigmaCons{sigmaClosure{l.term, c.right}, sigmaCompose{l.sub, c.right}}, "Map", true
+	case sigmaCompose:
+		return sigmaCompose{l.left, sigmaCompose{l.right, c.right}}, "Ass", true
+	}
+	return s, "", false
+}
+
+// sigmaStep rewrites the leftmost-outermost redex of t, of beta or of
+// any σ rule alike.
+func sigmaStep(t sigmaTerm) (sigmaTerm, string, bool) {
+	if next, rule, ok := sigmaRoot(t); ok {
+		return next, rule, true
+	}
+	switch e := t.(type) {
+	case sigmaLambda:
+		if body, rule, ok := sigmaStep(e.body); ok {
+			return sigmaLambda{body}, rule, true
+		}
+	case sigmaApply:
+		if left, rule, ok := sigmaStep(e.left); ok {
+			return sigmaApply{left, e.right}, rule, true
+		}
+		if right, rule, ok := sigmaStep(e.right); ok {
+			return sigmaApply{e.left, right}, rule, true
+		}
+	case sigmaClosure:
+		if term, rule, ok := sigmaStep(e.term); ok {
+			return sigmaClosure{term, e.sub}, rule, true
+		}
+		if sub, rule, ok := sigmaSubStep(e.sub); ok {
+			return sigmaClosure{e.term, sub}, rule, true
+		}
+	}
+	return t, "", false
+}
+
+func sigmaSubStep(s sigmaSub) (sigmaSub, string, bool) {
+	if next, rule, ok := sigmaSubRoot(s); ok {
+		return next, rule, true
+	}
+	switch e := s.(type) {
+	case sigmaCons:
+		if term, rule, ok := sigmaStep(e.term); ok {
+			return sigmaCons{term, e.sub}, rule, true
+		}
+		if sub, rule, ok := sigmaSubStep(e.sub); ok {
+			return sigmaCons{e.term, sub}, rule, true
+		}
+	case sigmaCompose:
+		if left, rule, ok := sigmaSubStep(e.left); ok {
+			return sigmaCompose{left, e.right}, rule, true
+		}
+		if right, rule, ok := sigmaSubStep(e.right); ok {
+			return sigmaCompose{e.left, right}, rule, true
+		}
+	}
+	return s, "", false
+}
+
+// fromSigma reads a normal form back as a lambda term, naming binders
+// x1, x2, … apart from the free variables.
+func fromSigma(t sigmaTerm, free []string) (expression, error) {
+	used := map[string]bool{}
+	for _, name := range free {
+		used[name] = true
+	}
+	var read func(sigmaTerm, []string) (expression, error)
+	read = func(t sigmaTerm, bound []string) (expression, error) {
+		switch e := t.(type) {
+		case sigmaLambda:
+			name := freshName("x", used)
+			used[name] = true
+			body, err := read(e.body, append(bound, name))
+			delete(used, name)
+			if err != nil {
+				return nil, err
+			}
+			return &abstraction{parameter: variable{name: name}, body: body}, nil
+		case sigmaApply:
+			left, err := read(e.left, bound)
+			if err != nil {
+				return nil, err
+			}
+			right, err := read(e.right, bound)
+			if err != nil {
+				return nil, err
+			}
+			return &application{left: left, right: right}, nil
+		}
+		n, ok := sigmaIndexOf(t)
+		if !ok {
+			return nil, fmt.Errorf("%s is not in σ-normal form", printSigma(t))
+		}
+		if n <= len(bound) {
+			return &variable{name: bound[len(bound)-n]}, nil
+		}
+		return &variable{name: free[n-len(bound)-1]}, nil
+	}
+	return read(t, nil)
+}
+
+// sigmaIndexOf reads 1[↑∘…∘↑] as its index.
+func sigmaIndexOf(t sigmaTerm) (int, bool) {
+	if _, ok := t.(sigmaOne); ok {
+		return 1, true
+	}
+	c, ok := t.(sigmaClosure)
+	if !ok {
+		return 0, false
+	}
+	if _, ok := c.term.(sigmaOne); !ok {
+		return 0, false
+	}
+	n := 2
+	s := c.sub
+	for {
+		switch e := s.(type) {
+		case sigmaShift:
+			return n, true
+		case sigmaCompose:
+			if _, ok := e.left.(sigmaShift); !ok {
+				return 0, false
+			}
+			n, s = n+1, e.right
+			continue
+		}
+		return 0, false
+	}
+}
+
+func printSigma(t sigmaTerm) string {
+	var b strings.Builder
+	writeSigma(&b, t)
+	return b.String()
+}
+
+// writeSigma prints closures tightest, then application, then
+// abstraction; in substitutions · binds looser than ∘ and both group
+// to the right.
+func writeSigma(b *strings.Builder, t sigmaTerm) {
+	switch e := t.(type) {
+	case sigmaOne:
+		b.WriteString("1")
+	case sigmaLambda:
+		b.WriteString("λ")
+		writeSigma(b, e.body)
+	case sigmaApply:
+		writeSigmaOperand(b, e.left, false)
+		b.WriteString(" ")
+		writeSigmaOperand(b, e.right, true)
+	case sigmaClosure:
+		writeSigmaOperand(b, e.term, true)
+		b.WriteString("[")
+		writeSigmaSub(b, e.sub)
+		b.WriteString("]")
+	}
+}
+
+// writeSigmaOperand parenthesizes abstractions, and applications too
+// when inner.
+func writeSigmaOperand(b *strings.Builder, t sigmaTerm, inner bool) {
+	_, lambda := t.(sigmaLambda)
+	_, app := t.(sigmaApply)
+	if lambda || inner && app {
+		b.WriteString("(")
+		writeSigma(b, t)
+		b.WriteString(")")
+		return
+	}
+	writeSigma(b, t)
+}
+
+func writeSigmaSub(b *strings.Builder, s sigmaSub) {
+	switch e := s.(type) {
+	case sigmaID:
+		b.WriteString("id")
+	case sigmaShift:
+		b.WriteString("↑")
+	case sigmaCons:
+		writeSigmaOperand(b, e.term, true)
+		b.WriteString("·")
+		writeSigmaSub(b, e.sub)
+	case sigmaCompose:
+		if _, ok := e.left.(sigmaShift); ok || isSigmaID(e.left) {
+			writeSigmaSub(b, e.left)
+		} else {
+			b.WriteString("(")
+			writeSigmaSub(b, e.left)
+			b.WriteString(")")
+		}
+		b.WriteString("∘")
+		if _, ok := e.right.(sigmaCons); ok {
+			b.WriteString("(")
+			writeSigmaSub(b, e.right)
+			b.WriteString(")")
+		} else {
+			writeSigmaSub(b, e.right)
+		}
+	}
+}
+
+func isSigmaID(s sigmaSub) bool {
+	_, ok := s.(sigmaID)
+	return ok
+}
+
+type sigmaStepRecord struct {
+	Step int    `json:"step"`
+	Term string `json:"term"`
+
+	// Rule is the rule applied to get to the next step; the last step
+	// has none.
+	Rule string `json:"rule,omitempty"`
+}
+
+type sigmaResult struct {
+	Expression string `json:"expression"`
+
+	// Term is the normal form in λσ notation, whose indices past the
+	// binders stand for Free in order.
+	Term  string            `json:"term"`
+	Free  []string          `json:"free"`
+	Trace []sigmaStepRecord `json:"trace"`
+
+	// Truncated is set when the trace stopped at maxTraceSteps before
+	// reduction did.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Rules counts the rewrites by rule.
+	Rules map[string]int `json:"rules"`
+}
+
+// explicitSubstitution reduces an expression in the λσ calculus,
+// leftmost-outermost over beta and the σ rules alike, tracing every
+// rewrite.
+func (c *connection) explicitSubstitution(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := c.server.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if maxSteps == 0 {
+		maxSteps = defaultSigmaSteps
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	free := []string{}
+	for name := range freeVariables(expr) {
+		free = append(free, name)
+	}
+	sort.Strings(free)
+	result, steps, err := reduceSigma(ctx, toSigma(expr, nil, free), maxSteps)
+	if errors.Is(err, errStepLimit) {
+		return errorResponse(request.ID, codeLimitExceeded, fmt.Sprintf("reduction stopped at the limit of %d steps", steps))
+	}
+	if err != nil {
+		return errorResponse(request.ID, codeTimeout, fmt.Sprintf("reduction timed out after %s (%d steps)", timeout, steps))
+	}
+	normal, err := fromSigma(result.term, free)
+	if err != nil {
+		return errorResponse(request.ID, codeInternalError, err.Error())
+	}
+	return Response{
+		ID: request.ID,
+		Result: sigmaResult{
+			Expression: printCompact(normal),
+			Term:       printSigma(result.term),
+			Free:       free,
+			Trace:      result.trace,
+			Truncated:  result.truncated,
+			Rules:      result.rules,
+		},
+		Meta: map[string]interface{}{"steps": steps},
+	}
+}
+
+type sigmaReduction struct {
+	term      sigmaTerm
+	trace     []sigmaStepRecord
+	truncated bool
+	rules     map[string]int
+}
+
+// reduceSigma rewrites t to normal form, recording the first
+// maxTraceSteps terms.
+func reduceSigma(ctx context.Context, t sigmaTerm, maxSteps int) (sigmaReduction, int, error) {
+	done := ctx.Done()
+	r := sigmaReduction{term: t, rules: map[string]int{}}
+	steps := 0
+	defer func() { meterSteps(ctx, steps) }()
+	for ; ; steps++ {
+		select {
+		case <-done:
+			return r, steps, ctx.Err()
+		default:
+		}
+		next, rule, ok := sigmaStep(r.term)
+		if len(r.trace) < maxTraceSteps {
+			r.trace = append(r.trace, sigmaStepRecord{Step: steps, Term: printSigma(r.term), Rule: rule})
+		} else {
+			r.truncated = true
+		}
+		if !ok {
+			return r, steps, nil
+		}
+		if steps == maxSteps {
+			return r, steps, errStepLimit
+		}
+		r.rules[rule]++
+		r.term = next
+	}
+}
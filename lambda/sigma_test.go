@@ -0,0 +1,43 @@
+package lambda
+
+import (
+	"context"
+	"sort"
+	"testing"
+)
+
+// TestSigma checks that reduction in λσ reads back to the beta normal
+// form, free variables included.
+func TestSigma(t *testing.T) {
+	for _, source := range []string{
+		`(\x y.x) y`,
+		`(\n f x.f (n f x)) (\f x.f (f x))`,
+		`(\x.\y.x y) (\z.z w)`,
+		`(\f.f (f a)) (\x.\y.x)`,
+	} {
+		expr, err := parseLambdaExpression(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _, err := normalize(context.Background(), expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var free []string
+		for name := range freeVariables(expr) {
+			free = append(free, name)
+		}
+		sort.Strings(free)
+		result, _, err := reduceSigma(context.Background(), toSigma(expr, nil, free), defaultSigmaSteps)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		got, err := fromSigma(result.term, free)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		if !alphaEquivalent(got, want) {
+			t.Errorf("%s: reduces to %s in λσ, want %s", source, printCompact(got), printCompact(want))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package lambda
+
+import "errors"
+
+const defaultSolvableSteps = 10000
+
+// A headSpine is a term λBinders.Head Arguments. In a head normal form
+// Head is a variable; otherwise it is the abstraction of the head
+// redex.
+type headSpine struct {
+	Binders   []string `json:"binders"`
+	Head      string   `json:"head"`
+	Arguments []string `json:"arguments"`
+}
+
+func spineOf(expr expression) headSpine {
+	spine := headSpine{Binders: []string{}, Arguments: []string{}}
+	for abs, ok := expr.(*abstraction); ok; abs, ok = expr.(*abstraction) {
+		spine.Binders = append(spine.Binders, abs.parameter.name)
+		expr = abs.body
+	}
+	for app, ok := expr.(*application); ok; app, ok = expr.(*application) {
+		spine.Arguments = append([]string{printCompact(app.right)}, spine.Arguments...)
+		expr = app.left
+	}
+	spine.Head = printCompact(expr)
+	return spine
+}
+
+// solvable head-reduces an expression within maxSteps to tell whether
+// it has a head normal form. Unsolvability cannot be decided, so a
+// term that runs out of steps is only reported as not solved yet,
+// with the spine it got to.
+func (c *connection) solvable(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := c.server.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if maxSteps == 0 {
+		maxSteps = defaultSolvableSteps
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	result, steps, err := reduce(ctx, headReduction{}, withoutSpans(expr), maxSteps, nil)
+	var stopped string
+	switch {
+	case errors.Is(err, errStepLimit):
+		stopped = "stepLimit"
+	case err != nil:
+		stopped = "timeout"
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Solvable bool `json:"solvable"`
+
+			// Stopped says why a term not known to be solvable was left
+			// at Spine: stepLimit or timeout.
+			Stopped string    `json:"stopped,omitempty"`
+			Spine   headSpine `json:"spine"`
+		}{stopped == "", stopped, spineOf(result)},
+		Meta: map[string]interface{}{"steps": steps},
+	}
+}
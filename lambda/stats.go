@@ -0,0 +1,56 @@
+package lambda
+
+type termStats struct {
+	Size         int `json:"size"`
+	Depth        int `json:"depth"`
+	Abstractions int `json:"abstractions"`
+	Applications int `json:"applications"`
+	Variables    int `json:"variables"`
+
+	// BinderNesting is the largest number of binders enclosing any
+	// subterm.
+	BinderNesting int `json:"binderNesting"`
+
+	FreeVariables int `json:"freeVariables"`
+}
+
+func statsOf(expr expression) termStats {
+	stats := termStats{
+		Size:          termSize(expr),
+		Depth:         termDepth(expr),
+		FreeVariables: len(freeVariables(expr)),
+	}
+	var walk func(expression, int)
+	walk = func(expr expression, binders int) {
+		if binders > stats.BinderNesting {
+			stats.BinderNesting = binders
+		}
+		switch e := expr.(type) {
+		case *variable:
+			stats.Variables++
+		case *abstraction:
+			stats.Abstractions++
+			walk(e.body, binders+1)
+		case *application:
+			stats.Applications++
+			walk(e.left, binders)
+			walk(e.right, binders)
+		}
+	}
+	walk(expr, 0)
+	return stats
+}
+
+// stats measures the size and shape of an expression without
+// evaluating it.
+func (c *connection) stats(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	return Response{ID: request.ID, Result: statsOf(expr)}
+}
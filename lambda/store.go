@@ -0,0 +1,111 @@
+package lambda
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// maxContentTerms bounds the content store, which never forgets a term.
+const maxContentTerms = 100000
+
+var errContentStoreFull = errors.New("content store is full")
+
+// contentStore keeps terms by their hash, so that clients can share a
+// term by its hash alone and storing it twice costs nothing. Unlike
+// handles, stored terms are shared by all tenants: a hash names the
+// same term whoever computes it.
+type contentStore struct {
+	mu    sync.Mutex
+	terms map[string]expression
+}
+
+func newContentStore() *contentStore {
+	return &contentStore{terms: map[string]expression{}}
+}
+
+// put stores term under its hash, reporting whether it was new. A term
+// already stored under another name is kept as first stored.
+func (cs *contentStore) put(term expression) (string, bool, error) {
+	hash := termHash(term)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if _, ok := cs.terms[hash]; ok {
+		return hash, false, nil
+	}
+	if len(cs.terms) == maxContentTerms {
+		return hash, false, errContentStoreFull
+	}
+	cs.terms[hash] = term
+	return hash, true, nil
+}
+
+// get looks up a term by its hash, with or without the sha256: prefix,
+// or by a #hash reference.
+func (cs *contentStore) get(hash string) (expression, bool) {
+	hash = strings.TrimPrefix(hash, "#")
+	if !strings.HasPrefix(hash, "sha256:") {
+		hash = "sha256:" + hash
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	term, ok := cs.terms[hash]
+	return term, ok
+}
+
+// contentReference is how an expression refers to the term stored
+// under hash.
+func contentReference(hash string) string {
+	return "#" + strings.TrimPrefix(hash, "sha256:")
+}
+
+// putMethod stores an expression in the content store.
+func (c *connection) putMethod(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	hash, stored, err := c.server.contents.put(expr)
+	if err != nil {
+		return errorResponse(request.ID, codeLimitExceeded, err.Error())
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Hash      string `json:"hash"`
+			Reference string `json:"reference"`
+			Stored    bool   `json:"stored"`
+		}{
+			Hash:      hash,
+			Reference: contentReference(hash),
+			Stored:    stored,
+		},
+	}
+}
+
+// getMethod prints the term stored under a hash.
+func (s *Server) getMethod(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	hash, ok := params["hash"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid hash parameter")
+	}
+	print, err := printStyleParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	term, ok := s.contents.get(hash)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid hash parameter: no term stored under "+hash)
+	}
+	return Response{ID: request.ID, Result: struct {
+		Expression string `json:"expression"`
+	}{print(term)}}
+}
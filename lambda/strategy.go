@@ -0,0 +1,195 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+)
+
+// A strategy decides which redex to contract next. Strategies register
+// themselves in init so that evaluate can select them by name.
+type strategy interface {
+	name() string
+	description() string
+
+	// step contracts one redex, returning the result and the path of
+	// the redex, or reports false if the strategy has nothing left to
+	// contract.
+	step(expr expression) (expression, path, bool)
+
+	// isNormal reports whether reduction under the strategy stops at
+	// expr.
+	isNormal(expr expression) bool
+}
+
+var strategies = map[string]strategy{}
+
+const defaultStrategy = "normal"
+
+// yieldSteps is how often reduce yields to other goroutines.
+const yieldSteps = 4096
+
+func registerStrategy(s strategy) {
+	if _, taken := strategies[s.name()]; taken {
+		panic("strategy " + s.name() + " registered twice")
+	}
+	strategies[s.name()] = s
+}
+
+// errStepLimit is returned by reduce when it stops at maxSteps with
+// redexes left.
+var errStepLimit = errors.New("step limit reached")
+
+// reduce applies strategy s to expr until it stops, ctx is done or,
+// if maxSteps is positive, that many steps were taken. If observe is
+// not nil it is called with each term before the redex at the given
+// path is contracted.
+func reduce(ctx context.Context, s strategy, expr expression, maxSteps int, observe func(expression, path)) (expression, int, error) {
+	// Polling Done, unlike calling Err, takes no lock, so cancellation
+	// is checked before every step and a cancelled reduction takes at
+	// most the step under way.
+	done := ctx.Done()
+	steps, metered := 0, 0
+	defer func() { meterSteps(ctx, steps-metered) }()
+	for {
+		select {
+		case <-done:
+			return expr, steps, ctx.Err()
+		default:
+		}
+
+		next, at, ok := s.step(expr)
+		if !ok {
+			return expr, steps, nil
+		}
+		if maxSteps > 0 && steps == maxSteps {
+			return expr, steps, errStepLimit
+		}
+		if observe != nil {
+			observe(expr, at)
+		}
+		expr = next
+		steps++
+
+		// Without preemption, as under js/wasm, the timer behind a
+		// deadline only fires if evaluation lets it run. Steps are
+		// charged to the quota as often, so that a long reduction is
+		// stopped once the tenant's quota is spent.
+		if steps%yieldSteps == 0 {
+			meterSteps(ctx, steps-metered)
+			metered = steps
+			runtime.Gosched()
+		}
+	}
+}
+
+// observeAll combines reduce observers, leaving out nil ones.
+func observeAll(observers ...func(expression, path)) func(expression, path) {
+	var all []func(expression, path)
+	for _, observe := range observers {
+		if observe != nil {
+			all = append(all, observe)
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	return func(before expression, at path) {
+		for _, observe := range all {
+			observe(before, at)
+		}
+	}
+}
+
+// listStrategies describes the registered strategies.
+func listStrategies(request Request) Response {
+	type described struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	list := []described{}
+	for _, s := range strategies {
+		list = append(list, described{s.name(), s.description()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Strategies []described `json:"strategies"`
+		}{
+			Strategies: list,
+		},
+	}
+}
+
+// strategyParam reads the optional strategy parameter of a request,
+// and the seed for a seeded strategy.
+func strategyParam(params map[string]interface{}) (strategy, error) {
+	name := defaultStrategy
+	if raw, present := params["strategy"]; present {
+		name, _ = raw.(string)
+	}
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("Invalid strategy parameter: unknown strategy %q", name)
+	}
+	if template, ok := s.(seeded); ok {
+		s = template.withSeed(seedParam(params))
+	}
+	return s, nil
+}
+
+type normalOrder struct{}
+
+func init() {
+	registerStrategy(normalOrder{})
+}
+
+func (normalOrder) name() string {
+	return "normal"
+}
+
+func (normalOrder) description() string {
+	return "leftmost-outermost; finds the normal form whenever one exists"
+}
+
+func (normalOrder) step(expr expression) (expression, path, bool) {
+	at, ok := leftmostRedex(expr)
+	if !ok {
+		return expr, nil, false
+	}
+	next, _ := contractAt(expr, at)
+	return next, at, true
+}
+
+func (normalOrder) isNormal(expr expression) bool {
+	_, ok := leftmostRedex(expr)
+	return !ok
+}
+
+// leftmostRedex finds the redex normal order contracts next.
+func leftmostRedex(expr expression) (path, bool) {
+	at := path{}
+	for {
+		switch e := expr.(type) {
+		case *abstraction:
+			at = append(at, 0)
+			expr = e.body
+			continue
+		case *application:
+			if _, ok := e.left.(*abstraction); ok {
+				return at, true
+			}
+			if p, ok := leftmostRedex(e.left); ok {
+				return append(append(at, 0), p...), true
+			}
+			at = append(at, 1)
+			expr = e.right
+			continue
+		}
+		return nil, false
+	}
+}
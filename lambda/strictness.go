@@ -0,0 +1,124 @@
+package lambda
+
+import (
+	"runtime"
+)
+
+const defaultStrictnessSteps = 10000
+
+type parameterStrictness struct {
+	Name string `json:"name"`
+
+	// Demanded reports whether applying the term to arguments for all
+	// of its parameters certainly evaluates this one.
+	Demanded bool `json:"demanded"`
+}
+
+type strictnessResult struct {
+	Parameters []parameterStrictness `json:"parameters"`
+
+	// Undetermined is set when the body did not reach a weak head
+	// normal form within the step limit; no parameter is then reported
+	// demanded, though if the body diverges all of them are.
+	Undetermined bool `json:"undetermined,omitempty"`
+	Steps        int  `json:"steps"`
+}
+
+// weakHeadRedex finds the redex at the bottom of the application spine
+// of expr, the one call-by-name contracts next, without going under
+// abstractions.
+func weakHeadRedex(expr expression) (path, bool) {
+	at := path{}
+	for {
+		app, ok := expr.(*application)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := app.left.(*abstraction); ok {
+			return at, true
+		}
+		at = append(at, 0)
+		expr = app.left
+	}
+}
+
+// spineHead returns the term at the bottom of the application spine of
+// expr.
+func spineHead(expr expression) expression {
+	for {
+		app, ok := expr.(*application)
+		if !ok {
+			return expr
+		}
+		expr = app.left
+	}
+}
+
+// analyzeStrictness reports which of the leading parameters of a term
+// its body certainly demands: evaluated by name to weak head normal
+// form with the parameters unknown, the body gets stuck on at most one
+// of them, at its head, and that one is demanded whatever the
+// arguments.
+func (c *connection) analyzeStrictness(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	maxSteps, err := c.server.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if maxSteps == 0 {
+		maxSteps = defaultStrictnessSteps
+	}
+
+	result := strictnessResult{Parameters: []parameterStrictness{}}
+	body := expr
+	for {
+		abs, ok := body.(*abstraction)
+		if !ok {
+			break
+		}
+		result.Parameters = append(result.Parameters, parameterStrictness{Name: abs.parameter.name})
+		body = abs.body
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+	defer func() { meterSteps(ctx, result.Steps) }()
+	for {
+		at, ok := weakHeadRedex(body)
+		if !ok {
+			break
+		}
+		if result.Steps == maxSteps || ctx.Err() != nil {
+			result.Undetermined = true
+			return Response{ID: request.ID, Result: result}
+		}
+		if result.Steps%yieldSteps == yieldSteps-1 {
+			runtime.Gosched()
+		}
+		body, _ = contractAt(body, at)
+		result.Steps++
+	}
+
+	// A parameter shadowed by a later one of the same name cannot be
+	// the head, so only the last one by a name is matched.
+	if head, ok := spineHead(body).(*variable); ok {
+		for i := len(result.Parameters) - 1; i >= 0; i-- {
+			if result.Parameters[i].Name == head.name {
+				result.Parameters[i].Demanded = true
+				break
+			}
+		}
+	}
+	return Response{ID: request.ID, Result: result}
+}
@@ -0,0 +1,79 @@
+package lambda
+
+// A binderRename is an abstraction substitution renamed because its
+// parameter would have captured the free variable of the same name in
+// the replacement.
+type binderRename struct {
+	Path path   `json:"path"`
+	Span *span  `json:"span,omitempty"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// renamedBinders compares a term with the result of a substitution into
+// it. The substitution keeps the shape of the term down to the replaced
+// variables, so binders at the same path are the same binder.
+func renamedBinders(before, after expression, at path, renames []binderRename) []binderRename {
+	switch b := before.(type) {
+	case *abstraction:
+		a, ok := after.(*abstraction)
+		if !ok {
+			return renames
+		}
+		if a.parameter.name != b.parameter.name {
+			rename := binderRename{Path: append(path{}, at...), From: b.parameter.name, To: a.parameter.name}
+			if s := b.span; s.known() {
+				rename.Span = &s
+			}
+			renames = append(renames, rename)
+		}
+		return renamedBinders(b.body, a.body, append(at, 0), renames)
+	case *application:
+		a, ok := after.(*application)
+		if !ok {
+			return renames
+		}
+		renames = renamedBinders(b.left, a.left, append(at, 0), renames)
+		return renamedBinders(b.right, a.right, append(at, 1), renames)
+	}
+	return renames
+}
+
+// substituteMethod replaces the free occurrences of a variable in a
+// term, reporting each binder renamed to avoid capturing a free
+// variable of the replacement.
+func (c *connection) substituteMethod(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	term, err := c.expressionParam(params, "term")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	name, ok := params["variable"].(string)
+	if !ok || !validName(name) {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid variable parameter")
+	}
+	replacement, err := c.expressionParam(params, "replacement")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	print, err := printStyleParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+
+	result := substitute(term, variable{name: name}, replacement)
+	renames := renamedBinders(term, result, path{}, []binderRename{})
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Expression string         `json:"expression"`
+			Renamed    []binderRename `json:"renamed"`
+		}{
+			Expression: print(result),
+			Renamed:    renames,
+		},
+	}
+}
@@ -0,0 +1,75 @@
+package lambda
+
+const defaultSummaryPrefixBytes = 256
+
+// termSummary describes a result too large to be worth printing in
+// full.
+type termSummary struct {
+	Nodes int    `json:"nodes"`
+	Depth int    `json:"depth"`
+	Head  string `json:"head"`
+}
+
+func summarize(expr expression) *termSummary {
+	return &termSummary{
+		Nodes: termSize(expr),
+		Depth: termDepth(expr),
+		Head:  headSymbol(expr),
+	}
+}
+
+// termSize counts the variables, abstractions and applications of expr.
+func termSize(expr expression) int {
+	switch e := expr.(type) {
+	case *abstraction:
+		return 1 + termSize(e.body)
+	case *application:
+		return 1 + termSize(e.left) + termSize(e.right)
+	default:
+		return 1
+	}
+}
+
+// termDepth is the height of the syntax tree of expr; a variable has
+// depth 1.
+func termDepth(expr expression) int {
+	switch e := expr.(type) {
+	case *abstraction:
+		return 1 + termDepth(e.body)
+	case *application:
+		left, right := termDepth(e.left), termDepth(e.right)
+		if right > left {
+			left = right
+		}
+		return 1 + left
+	default:
+		return 1
+	}
+}
+
+// headSymbol names the head of expr once its leading binders and
+// application spine are stripped: the variable h in `λx.λy.h M N`. A
+// head that is itself an abstraction (a head redex) is reported as "λ".
+func headSymbol(expr expression) string {
+	for {
+		switch e := expr.(type) {
+		case *abstraction:
+			expr = e.body
+			continue
+		case *variable:
+			return e.name
+		}
+		break
+	}
+	for {
+		app, ok := expr.(*application)
+		if !ok {
+			break
+		}
+		expr = app.left
+	}
+	if v, ok := expr.(*variable); ok {
+		return v.name
+	}
+	return "λ"
+}
@@ -0,0 +1,154 @@
+package lambda
+
+import "fmt"
+
+const defaultSyntax = "lambda"
+
+// A syntax parses input written in one notation into the core AST.
+type syntax func(src string, resolve resolver) (expression, []parseWarning, error)
+
+// syntaxes are the notations input may be written in: the core one,
+// Haskell-style `\x y -> x y`, Lisp-style S-expressions
+// `(lambda (x y) (x y))` and combinator terms such as `S K K x`.
+var syntaxes = map[string]syntax{
+	"lambda":  parseWithWarnings,
+	"haskell": parseHaskell,
+	"lisp":    parseLisp,
+	"ski":     parseSKI,
+}
+
+// syntaxParam reads the optional syntax parameter.
+func syntaxParam(params map[string]interface{}) (syntax, error) {
+	name := defaultSyntax
+	if raw, present := params["syntax"]; present {
+		name, _ = raw.(string)
+	}
+	parse, ok := syntaxes[name]
+	if !ok {
+		return nil, fmt.Errorf("Invalid syntax parameter: unknown syntax %q", name)
+	}
+	return parse, nil
+}
+
+func parseHaskell(src string, resolve resolver) (expression, []parseWarning, error) {
+	tokens, err := tokenizeSyntax(src, true)
+	if err != nil {
+		return nil, nil, withSource(err, src)
+	}
+	expr, warnings, err := parseTokens(tokens, resolve, "->")
+	return expr, warnings, withSource(err, src)
+}
+
+// parseLisp parses an S-expression: a name, a reference, a lambda
+// (lambda (x ...) body), also written with λ or \, or an application
+// (f a ...) of a function to one or more arguments.
+func parseLisp(src string, resolve resolver) (expression, []parseWarning, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, nil, withSource(err, src)
+	}
+	p := &parser{tokens: tokens, resolve: resolve}
+	expr, err := p.parseSExpression()
+	if err != nil {
+		return nil, nil, withSource(err, src)
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, nil, withSource(syntaxErrorf(t.pos, "unexpected %q", t.text), src)
+	}
+	if err := checkDepth(expr); err != nil {
+		return nil, nil, withSource(err, src)
+	}
+	return expr, p.warnings, nil
+}
+
+func (p *parser) parseSExpression() (expression, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenName:
+		return &variable{t.text, span{t.pos, t.pos + len(t.text)}}, nil
+	case tokenReference:
+		if p.resolve != nil {
+			if expr, found := p.resolve(t.text); found {
+				return expr, nil
+			}
+		}
+		return nil, unknownReference(t)
+	case tokenOpen:
+		if err := p.descend(t); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+	case tokenEOF:
+		return nil, syntaxErrorf(t.pos, "unexpected end of expression")
+	default:
+		return nil, syntaxErrorf(t.pos, "unexpected %q", t.text)
+	}
+
+	if head := p.peek(); head.kind == tokenLambda || head.kind == tokenName && head.text == "lambda" {
+		p.next()
+		return p.parseSLambda(t)
+	}
+	function, err := p.parseSExpression()
+	if err != nil {
+		return nil, err
+	}
+	expr := function
+	for p.peek().kind != tokenClose {
+		argument, err := p.parseSExpression()
+		if err != nil {
+			return nil, err
+		}
+		expr = &application{expr, argument, span{t.pos, p.lastEnd}}
+	}
+	if expr == function {
+		return nil, syntaxErrorf(p.peek().pos, "expected an argument")
+	}
+	p.next()
+	expr.(*application).span.End = p.lastEnd
+	return expr, nil
+}
+
+// parseSLambda parses the rest of a lambda whose opening parenthesis
+// is open, after the lambda keyword.
+func (p *parser) parseSLambda(open token) (expression, error) {
+	if t := p.next(); t.kind != tokenOpen {
+		return nil, syntaxErrorf(t.pos, "expected '(' before parameters")
+	}
+	var parameters []token
+	for p.peek().kind == tokenName {
+		parameter := p.next()
+		p.checkShadowing(parameter)
+		parameters = append(parameters, parameter)
+		p.scope = append(p.scope, parameter)
+	}
+	if len(parameters) == 0 {
+		return nil, syntaxErrorf(p.peek().pos, "expected parameter name")
+	}
+	if t := p.next(); t.kind != tokenClose {
+		return nil, syntaxErrorf(t.pos, "expected ')' after parameters")
+	}
+
+	body, err := p.parseSExpression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tokenClose {
+		return nil, syntaxErrorf(t.pos, "expected ')'")
+	}
+	p.scope = p.scope[:len(p.scope)-len(parameters)]
+
+	end := p.lastEnd
+	for i := len(parameters) - 1; i >= 0; i-- {
+		parameter := parameters[i]
+		start := parameter.pos
+		if i == 0 {
+			start = open.pos
+		}
+		body = &abstraction{
+			variable{parameter.text, span{parameter.pos, parameter.pos + len(parameter.text)}},
+			body,
+			span{start, end},
+		}
+	}
+	return body, nil
+}
@@ -0,0 +1,53 @@
+package lambda
+
+import "strings"
+
+// expandTemplate replaces each ${NAME} placeholder in src with the text
+// of the template value NAME, in parentheses if group is set so that
+// the value stays a term of its own. A placeholder of a name that is
+// not a template value is a syntax error.
+func expandTemplate(src string, values map[string]string, group bool) (string, error) {
+	var expanded strings.Builder
+	rest := src
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			expanded.WriteString(rest)
+			return expanded.String(), nil
+		}
+		offset := len(src) - len(rest) + start
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", withSource(syntaxErrorf(offset, "unterminated placeholder"), src)
+		}
+		name := rest[start+2 : start+end]
+		value, ok := values[name]
+		if !ok {
+			return "", withSource(syntaxErrorf(offset, "unknown template value %q", name), src)
+		}
+		if group {
+			value = "(" + value + ")"
+		}
+		expanded.WriteString(rest[:start])
+		expanded.WriteString(value)
+		rest = rest[start+end+1:]
+	}
+}
+
+// syntaxParam is the package-level syntaxParam, expanding ${NAME}
+// placeholders first when the server has template values.
+func (c *connection) syntaxParam(params map[string]interface{}) (syntax, error) {
+	parse, err := syntaxParam(params)
+	if err != nil || len(c.server.templateValues) == 0 {
+		return parse, err
+	}
+	// Parentheses apply a term in S-expressions rather than group it.
+	group := params["syntax"] != "lisp"
+	return func(src string, resolve resolver) (expression, []parseWarning, error) {
+		expanded, err := expandTemplate(src, c.server.templateValues, group)
+		if err != nil {
+			return nil, nil, err
+		}
+		return parse(expanded, resolve)
+	}, nil
+}
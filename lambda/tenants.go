@@ -0,0 +1,101 @@
+package lambda
+
+import (
+	"crypto/subtle"
+	"sort"
+)
+
+func (c *connection) tenantName() string {
+	c.tenantMu.Lock()
+	defer c.tenantMu.Unlock()
+	return c.tenant
+}
+
+// authenticate switches the connection to the tenant its token
+// belongs to.
+func (s *Server) authenticate(c *connection, request Request) Response {
+	params, _ := request.Params.(map[string]interface{})
+	token, _ := params["token"].(string)
+
+	tenant, found := "", false
+	for candidate, name := range s.tenants {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			tenant, found = name, true
+		}
+	}
+	if !found {
+		return errorResponse(request.ID, codeUnauthorized, "Invalid token")
+	}
+
+	c.tenantMu.Lock()
+	c.tenant = tenant
+	c.tenantMu.Unlock()
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Tenant string `json:"tenant"`
+		}{
+			Tenant: tenant,
+		},
+	}
+}
+
+type tenantUsage struct {
+	Tenant  string `json:"tenant"`
+	Handles int    `json:"handles"`
+}
+
+// listTenants reports the configured tenants and any others holding
+// handles, such as the anonymous "" one. Like purgeTenant, it takes
+// the shutdown token.
+func (s *Server) listTenants(request Request) Response {
+	if !s.admin(request) {
+		return errorResponse(request.ID, codeUnauthorized, "Invalid admin token")
+	}
+
+	counts := s.handles.byTenant()
+	for _, name := range s.tenants {
+		if _, ok := counts[name]; !ok {
+			counts[name] = 0
+		}
+	}
+	tenants := []tenantUsage{}
+	for name, handles := range counts {
+		tenants = append(tenants, tenantUsage{name, handles})
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Tenant < tenants[j].Tenant })
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Tenants []tenantUsage `json:"tenants"`
+		}{
+			Tenants: tenants,
+		},
+	}
+}
+
+// purgeTenant drops every handle of a tenant.
+func (s *Server) purgeTenant(request Request) Response {
+	if !s.admin(request) {
+		return errorResponse(request.ID, codeUnauthorized, "Invalid admin token")
+	}
+	params, _ := request.Params.(map[string]interface{})
+	tenant, ok := params["tenant"].(string)
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid tenant parameter")
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Purged int `json:"purged"`
+		}{
+			Purged: s.handles.purge(tenant),
+		},
+	}
+}
+
+// admin reports whether a request may use the admin methods, which
+// are disabled without a shutdown token.
+func (s *Server) admin(request Request) bool {
+	return s.shutdownToken != "" && s.authorized(request)
+}
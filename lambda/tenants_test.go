@@ -0,0 +1,59 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+
+	"example.com/rpc"
+)
+
+func TestTenants(t *testing.T) {
+	s := NewServer(Options{Workers: 1, ShutdownToken: "admin", Tenants: map[string]string{"alpha-token": "alpha", "beta-token": "beta"}})
+	alpha, beta := rpc.WithSession(context.Background()), rpc.WithSession(context.Background())
+	call := func(ctx context.Context, method string, params map[string]interface{}) Response {
+		return s.ServeRPC(ctx, Request{ID: 1, Method: method, Params: params})
+	}
+
+	if response := call(alpha, "authenticate", map[string]interface{}{"token": "wrong"}); response.Error == nil {
+		t.Error("authenticate with an unknown token succeeded")
+	}
+	for ctx, token := range map[context.Context]string{alpha: "alpha-token", beta: "beta-token"} {
+		if response := call(ctx, "authenticate", map[string]interface{}{"token": token}); response.Error != nil {
+			t.Fatalf("authenticate %s: %s", token, response.Error.Message)
+		}
+	}
+
+	var kept evaluateResult
+	decodeResult(t, call(alpha, "evaluate", map[string]interface{}{"expression": `\x.x`, "handle": true}), &kept)
+	if kept.Handle == "" {
+		t.Fatal("evaluate with handle: true returned no handle")
+	}
+	if response := call(beta, "evaluate", map[string]interface{}{"expression": kept.Handle}); response.Error == nil {
+		t.Errorf("beta used alpha's handle %s", kept.Handle)
+	}
+	if response := call(alpha, "evaluate", map[string]interface{}{"expression": kept.Handle}); response.Error != nil {
+		t.Errorf("alpha cannot use its own handle: %s", response.Error.Message)
+	}
+
+	if response := call(alpha, "listTenants", map[string]interface{}{"token": "wrong"}); response.Error == nil {
+		t.Error("listTenants with a bad token succeeded")
+	}
+	var listed struct {
+		Tenants []tenantUsage `json:"tenants"`
+	}
+	decodeResult(t, call(alpha, "listTenants", map[string]interface{}{"token": "admin"}), &listed)
+	if len(listed.Tenants) != 2 || listed.Tenants[0] != (tenantUsage{"alpha", 1}) || listed.Tenants[1] != (tenantUsage{"beta", 0}) {
+		t.Errorf("listTenants: got %+v, want alpha with 1 handle and beta with none", listed.Tenants)
+	}
+
+	var purged struct {
+		Purged int `json:"purged"`
+	}
+	decodeResult(t, call(beta, "purgeTenant", map[string]interface{}{"token": "admin", "tenant": "alpha"}), &purged)
+	if purged.Purged != 1 {
+		t.Errorf("purgeTenant: got %d purged, want 1", purged.Purged)
+	}
+	if response := call(alpha, "evaluate", map[string]interface{}{"expression": kept.Handle}); response.Error == nil {
+		t.Error("alpha's handle survived purgeTenant")
+	}
+}
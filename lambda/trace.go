@@ -0,0 +1,254 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+)
+
+// maxTraceSteps caps the number of steps a trace records; reduction
+// carries on past it, but the trace is marked truncated.
+const maxTraceSteps = 10000
+
+type traceStep struct {
+	Step int    `json:"step"`
+	Term string `json:"term,omitempty"`
+
+	// Delta replaces Term in delta traces, but for the first step.
+	Delta *termDelta `json:"delta,omitempty"`
+
+	// Redex locates the redex contracted to get to the next step. The
+	// last step, the normal form, has none.
+	Redex *redexLocation `json:"redex,omitempty"`
+}
+
+// A traceSummary is the cost of a traced reduction. Substitutions
+// counts the variable occurrences replaced by arguments, Renames the
+// binders renamed to avoid capturing a free variable of an argument,
+// and Allocations the term nodes built, which substitution shares with
+// the terms it copies from wherever it can.
+type traceSummary struct {
+	Steps         int `json:"steps"`
+	PeakSize      int `json:"peakSize"`
+	Substitutions int `json:"substitutions"`
+	Renames       int `json:"renames"`
+	Allocations   int `json:"allocations"`
+}
+
+// A termDelta gives a term by how it differs from the one of the
+// previous step: the subterm at Path is replaced by Term.
+type termDelta struct {
+	Path path   `json:"path"`
+	Term string `json:"term"`
+}
+
+type redexLocation struct {
+	Path path `json:"path"`
+
+	// Span is omitted for redexes that were created during reduction
+	// and so have no counterpart in the input.
+	Span *span `json:"span,omitempty"`
+}
+
+// traceOptions selects which steps a trace records: the first and
+// last keep steps, and of the others every every-th, up to limit steps
+// in all. A delta trace records every term after the first as a
+// termDelta.
+type traceOptions struct {
+	delta bool
+	limit int
+	every int
+	keep  int
+}
+
+// A tracedTerm is a step kept for the trace, printed once reduction is
+// over and it is known which steps precede it.
+type tracedTerm struct {
+	step  int
+	term  expression
+	redex *redexLocation
+}
+
+// reduceTraced is reduce recording the intermediate terms selected by
+// options together with the location of the redex contracted from
+// each. observe, if not nil, is passed on to reduce.
+func reduceTraced(ctx context.Context, s strategy, expr expression, maxSteps int, print func(expression) string, options traceOptions, observe func(expression, path)) (expression, int, []traceStep, *traceSummary, bool, error) {
+	var kept, tail []tracedTerm
+	truncated := false
+	record := func(term tracedTerm) {
+		if term.step < options.keep {
+			kept = append(kept, term)
+			return
+		}
+		// The last keep steps wait in tail until later steps push them
+		// out, to be sampled like any other.
+		if options.keep > 0 {
+			tail = append(tail, term)
+			if len(tail) <= options.keep {
+				return
+			}
+			term, tail = tail[0], tail[1:]
+		}
+		if term.step%options.every == 0 && len(kept) < options.limit-options.keep {
+			kept = append(kept, term)
+		} else {
+			truncated = true
+		}
+	}
+
+	step := 0
+	summary := &traceSummary{}
+	var counts substitutionCounts
+	result, steps, err := reduce(ctx, s, expr, maxSteps, func(before expression, at path) {
+		record(tracedTerm{step, before, locateRedex(before, at)})
+		step++
+
+		if size := termSize(before); size > summary.PeakSize {
+			summary.PeakSize = size
+		}
+		countContraction(before, at, &counts)
+		if observe != nil {
+			observe(before, at)
+		}
+	})
+	if err == nil {
+		record(tracedTerm{step, result, nil})
+	}
+	if size := termSize(result); size > summary.PeakSize {
+		summary.PeakSize = size
+	}
+	summary.Steps = steps
+	summary.Substitutions = counts.replaced
+	summary.Renames = counts.renamed
+	summary.Allocations = counts.built
+	kept = append(kept, tail...)
+
+	trace := make([]traceStep, len(kept))
+	for i, t := range kept {
+		trace[i] = traceStep{Step: t.step, Redex: t.redex}
+		if !options.delta || i == 0 {
+			trace[i].Term = print(t.term)
+			continue
+		}
+		// Only the subterm at the redex changes in one step; across
+		// steps left out, anything may have.
+		previous, at := kept[i-1], path{}
+		if previous.step == t.step-1 {
+			at = previous.redex.Path
+		}
+		trace[i].Delta = deltaAt(previous.term, t.term, at, print)
+	}
+	return result, steps, trace, summary, truncated, err
+}
+
+// countContraction adds the work of contracting the redex of before at
+// at to counts, returning the redex's binder. The strategies' own
+// contractions are not instrumented, so it is done again here,
+// counting. Putting the contractum in place rebuilds the applications
+// and abstractions above the redex.
+func countContraction(before expression, at path, counts *substitutionCounts) (variable, bool) {
+	redex, _ := subtermAt(before, at)
+	app, ok := redex.(*application)
+	if !ok {
+		return variable{}, false
+	}
+	fn, ok := app.left.(*abstraction)
+	if !ok {
+		return variable{}, false
+	}
+	substituteCounting(fn.body, fn.parameter, app.right, counts)
+	counts.built += len(at)
+	return fn.parameter, true
+}
+
+func locateRedex(expr expression, at path) *redexLocation {
+	location := &redexLocation{Path: at}
+	if redex, ok := subtermAt(expr, at); ok {
+		if s := spanOf(redex); s.known() {
+			location.Span = &s
+		}
+	}
+	return location
+}
+
+// deltaAt describes after, which differs from before only within the
+// subterm at at, by the smallest subterm that changed.
+func deltaAt(before, after expression, at path, print func(expression) string) *termDelta {
+	b, _ := subtermAt(before, at)
+	a, _ := subtermAt(after, at)
+	p := append(path{}, at...)
+	for {
+		switch x := a.(type) {
+		case *abstraction:
+			if y, ok := b.(*abstraction); ok && x.parameter.name == y.parameter.name {
+				a, b, p = x.body, y.body, append(p, 0)
+				continue
+			}
+		case *application:
+			if y, ok := b.(*application); ok {
+				if sameTerm(x.left, y.left) {
+					a, b, p = x.right, y.right, append(p, 1)
+					continue
+				}
+				if sameTerm(x.right, y.right) {
+					a, b, p = x.left, y.left, append(p, 0)
+					continue
+				}
+			}
+		}
+		return &termDelta{Path: p, Term: print(a)}
+	}
+}
+
+// sameTerm reports whether a and b are identical, names included.
+func sameTerm(a, b expression) bool {
+	switch x := a.(type) {
+	case *variable:
+		y, ok := b.(*variable)
+		return ok && x.name == y.name
+	case *abstraction:
+		y, ok := b.(*abstraction)
+		return ok && x.parameter.name == y.parameter.name && sameTerm(x.body, y.body)
+	case *application:
+		y, ok := b.(*application)
+		return ok && sameTerm(x.left, y.left) && sameTerm(x.right, y.right)
+	}
+	return false
+}
+
+// traceOptionsParam reads the optional traceFormat, traceLimit,
+// traceSample and traceKeep parameters.
+func traceOptionsParam(params map[string]interface{}) (traceOptions, error) {
+	options := traceOptions{limit: maxTraceSteps, every: 1}
+	if raw, present := params["traceFormat"]; present {
+		switch format, _ := raw.(string); format {
+		case "full":
+		case "delta":
+			options.delta = true
+		default:
+			return options, errors.New("Invalid traceFormat parameter")
+		}
+	}
+	limit, present, err := positiveInt(params, "traceLimit")
+	if err != nil {
+		return options, err
+	}
+	if present && limit < options.limit {
+		options.limit = limit
+	}
+	every, present, err := positiveInt(params, "traceSample")
+	if err != nil {
+		return options, err
+	}
+	if present {
+		options.every = every
+	}
+	keep, _, err := positiveInt(params, "traceKeep")
+	if err != nil {
+		return options, err
+	}
+	if 2*keep > options.limit {
+		return options, errors.New("Invalid traceKeep parameter: more steps than traceLimit")
+	}
+	options.keep = keep
+	return options, nil
+}
@@ -0,0 +1,184 @@
+package lambda
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// maxTraceFileBytes bounds a trace file; steps past it are left out
+	// and the trace is marked truncated.
+	maxTraceFileBytes = 1 << 30
+
+	defaultTracePage = 100
+	maxTracePage     = maxTraceSteps
+)
+
+// A traceFileInfo names a trace evaluate wrote to the server's trace
+// directory with traceFile: true, one traceStep per line, for
+// fetchTrace to page through.
+type traceFileInfo struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	Steps     int    `json:"steps"`
+	Bytes     int64  `json:"bytes"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// A traceFile writes the steps of one evaluation as they are taken,
+// so traces of any length cost no more memory than a single step.
+type traceFile struct {
+	file  *os.File
+	w     *bufio.Writer
+	print func(expression) string
+	info  traceFileInfo
+	err   error
+}
+
+func (s *Server) createTraceFile(print func(expression) string) (*traceFile, error) {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+	path := filepath.Join(s.traceDir, id+".jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &traceFile{file: file, w: bufio.NewWriter(file), print: print, info: traceFileInfo{ID: id, Path: path}}, nil
+}
+
+// observer records each step before its redex is contracted, until
+// the file is truncated. A nil traceFile has no observer.
+func (t *traceFile) observer() func(expression, path) {
+	if t == nil {
+		return nil
+	}
+	return func(before expression, at path) {
+		// Printing the term is most of the cost of a step.
+		if t.err != nil || t.info.Truncated {
+			return
+		}
+		t.write(traceStep{Step: t.info.Steps, Term: t.print(before), Redex: locateRedex(before, at)})
+	}
+}
+
+func (t *traceFile) write(step traceStep) {
+	if t.err != nil || t.info.Truncated {
+		return
+	}
+	line, err := json.Marshal(step)
+	if err != nil {
+		t.err = err
+		return
+	}
+	line = append(line, '\n')
+	if t.info.Bytes+int64(len(line)) > maxTraceFileBytes {
+		t.info.Truncated = true
+		return
+	}
+	if _, err := t.w.Write(line); err != nil {
+		t.err = err
+		return
+	}
+	t.info.Bytes += int64(len(line))
+	t.info.Steps++
+}
+
+// close records result, the normal form, if reduction reached one, and
+// closes the file.
+func (t *traceFile) close(result expression) (traceFileInfo, error) {
+	if result != nil {
+		t.write(traceStep{Step: t.info.Steps, Term: t.print(result)})
+	}
+	if err := t.w.Flush(); err != nil && t.err == nil {
+		t.err = err
+	}
+	if err := t.file.Close(); err != nil && t.err == nil {
+		t.err = err
+	}
+	return t.info, t.err
+}
+
+// fetchTrace returns up to limit steps of a trace file from cursor, a
+// byte offset, on: 0 or a next returned before. The last page comes
+// without a next.
+func (s *Server) fetchTrace(request Request) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	if s.traceDir == "" {
+		return errorResponse(request.ID, codeMethodNotFound, "trace files are disabled; start the server with -trace-dir")
+	}
+	id, _ := params["id"].(string)
+	if decoded, err := hex.DecodeString(id); err != nil || len(decoded) != 16 {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid id parameter")
+	}
+	var cursor int64
+	if raw, present := params["cursor"]; present {
+		value, ok := raw.(float64)
+		if !ok || value < 0 || value != float64(int64(value)) {
+			return errorResponse(request.ID, codeInvalidParams, "Invalid cursor parameter")
+		}
+		cursor = int64(value)
+	}
+	limit, present, err := positiveInt(params, "limit")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if !present {
+		limit = defaultTracePage
+	}
+	if limit > maxTracePage {
+		return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid limit parameter: at most %d", maxTracePage))
+	}
+
+	file, err := os.Open(filepath.Join(s.traceDir, id+".jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid id parameter: no trace "+id)
+	}
+	if err != nil {
+		return errorResponse(request.ID, codeInternalError, err.Error())
+	}
+	defer file.Close()
+	if _, err := file.Seek(cursor, io.SeekStart); err != nil {
+		return errorResponse(request.ID, codeInternalError, err.Error())
+	}
+
+	r := bufio.NewReader(file)
+	steps := []json.RawMessage{}
+	next := cursor
+	for len(steps) < limit {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errorResponse(request.ID, codeInternalError, err.Error())
+		}
+		// A cursor that is not at the start of a line gives a partial
+		// one, which is no step.
+		if !json.Valid(line) {
+			return errorResponse(request.ID, codeInvalidParams, "Invalid cursor parameter: not at the start of a step")
+		}
+		steps = append(steps, json.RawMessage(line[:len(line)-1]))
+		next += int64(len(line))
+	}
+	result := struct {
+		Steps []json.RawMessage `json:"steps"`
+
+		// Next is the cursor of the following page.
+		Next *int64 `json:"next,omitempty"`
+	}{Steps: steps}
+	if _, err := r.Peek(1); err == nil {
+		result.Next = &next
+	}
+	return Response{ID: request.ID, Result: result}
+}
@@ -0,0 +1,86 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// decodeResult turns a result into its JSON form, as a client gets it.
+func decodeResult(t *testing.T, response Response, into interface{}) {
+	t.Helper()
+	if response.Error != nil {
+		t.Fatalf("%v", response.Error.Message)
+	}
+	encoded, err := json.Marshal(response.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(encoded, into); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTraceFile(t *testing.T) {
+	s := NewServer(Options{Workers: 1, TraceDir: t.TempDir()})
+	ctx := context.Background()
+
+	var evaluated struct {
+		TraceFile traceFileInfo `json:"traceFile"`
+	}
+	decodeResult(t, s.ServeRPC(ctx, Request{ID: 1, Method: "evaluate", Params: map[string]interface{}{
+		"expression": `(\x.x) ((\y.y) a)`,
+		"traceFile":  true,
+	}}), &evaluated)
+	if evaluated.TraceFile.Steps != 3 {
+		t.Fatalf("traceFile: got %d steps, want 3", evaluated.TraceFile.Steps)
+	}
+
+	// The two steps and the normal form, two at a time.
+	var terms []string
+	params := map[string]interface{}{"id": evaluated.TraceFile.ID, "limit": 2.0}
+	for page := 0; ; page++ {
+		var fetched struct {
+			Steps []traceStep `json:"steps"`
+			Next  *int64      `json:"next"`
+		}
+		decodeResult(t, s.ServeRPC(ctx, Request{ID: 2, Method: "fetchTrace", Params: params}), &fetched)
+		for _, step := range fetched.Steps {
+			terms = append(terms, step.Term)
+		}
+		if fetched.Next == nil {
+			if page != 1 {
+				t.Errorf("fetchTrace: got %d pages, want 2", page+1)
+			}
+			break
+		}
+		params["cursor"] = float64(*fetched.Next)
+	}
+	want := []string{"((!x.x) ((!y.y) a))", "((!y.y) a)", "a"}
+	if len(terms) != len(want) {
+		t.Fatalf("fetchTrace: got %q, want %q", terms, want)
+	}
+	for i := range want {
+		if terms[i] != want[i] {
+			t.Errorf("fetchTrace step %d: got %q, want %q", i, terms[i], want[i])
+		}
+	}
+
+	params["cursor"] = 1.0
+	if response := s.ServeRPC(ctx, Request{ID: 3, Method: "fetchTrace", Params: params}); response.Error == nil {
+		t.Error("fetchTrace from the middle of a step succeeded, want an error")
+	}
+}
+
+func TestTruncatedTraceFileObserver(t *testing.T) {
+	printed := 0
+	file := &traceFile{print: func(expr expression) string {
+		printed++
+		return expr.String()
+	}}
+	file.info.Truncated = true
+	file.observer()(&variable{name: "a"}, path{})
+	if printed != 0 {
+		t.Errorf("a truncated trace file printed %d terms, want none", printed)
+	}
+}
@@ -0,0 +1,201 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	defaultTreeDepth = 5
+	maxTreeDepth     = 100
+
+	// defaultTreeSteps is the reduction budget of each node, past which
+	// the subterm is taken to be unsolvable.
+	defaultTreeSteps = 1000
+
+	// maxTreeNodes bounds the nodes of a tree, which may branch widely
+	// well within its depth.
+	maxTreeNodes = 10000
+)
+
+// weakHeadReduction contracts the redex at the head of an application
+// spine, stopping at an abstraction or a variable applied to
+// arguments. Unlike head reduction it never reduces under a lambda.
+// It is not registered, being of use only to levyLongoTree.
+type weakHeadReduction struct{}
+
+func (weakHeadReduction) name() string { return "weakHead" }
+
+func (weakHeadReduction) description() string {
+	return "contracts the head redex outside any abstraction; stops at a weak head normal form"
+}
+
+func (r weakHeadReduction) isNormal(expr expression) bool {
+	_, _, ok := r.step(expr)
+	return !ok
+}
+
+func (weakHeadReduction) step(expr expression) (expression, path, bool) {
+	at := path{}
+	for e := expr; ; {
+		app, ok := e.(*application)
+		if !ok {
+			return expr, nil, false
+		}
+		if _, ok := app.left.(*abstraction); ok {
+			next, _ := contractAt(expr, at)
+			return next, at, true
+		}
+		at = append(at, 0)
+		e = app.left
+	}
+}
+
+// A treeNode is a node of a Böhm or Lévy-Longo tree: λBinders.Head
+// applied to the subtrees Children, or, with Bottom, λBinders.⊥ for a
+// subterm with no head normal form within the budget. Truncated nodes
+// stand for the subtrees past the depth asked for, after the binders
+// within it.
+type treeNode struct {
+	Binders   []string    `json:"binders,omitempty"`
+	Head      string      `json:"head,omitempty"`
+	Children  []*treeNode `json:"children,omitempty"`
+	Bottom    bool        `json:"bottom,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// A treeBuilder unfolds a tree node by node, spending up to budget
+// steps on each.
+type treeBuilder struct {
+	ctx      context.Context
+	weak     bool
+	maxDepth int
+	budget   int
+	nodes    int
+	steps    int
+}
+
+func (b *treeBuilder) build(expr expression, depth int) (*treeNode, error) {
+	if depth > b.maxDepth || b.nodes == maxTreeNodes {
+		return &treeNode{Truncated: true}, nil
+	}
+	b.nodes++
+
+	node := &treeNode{}
+	var s strategy = headReduction{}
+	if b.weak {
+		s = weakHeadReduction{}
+	}
+	for {
+		normal, steps, err := reduce(b.ctx, s, expr, b.budget, nil)
+		b.steps += steps
+		if errors.Is(err, errStepLimit) {
+			node.Bottom = true
+			return node, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for abs, ok := normal.(*abstraction); ok; abs, ok = normal.(*abstraction) {
+			node.Binders = append(node.Binders, abs.parameter.name)
+			normal = abs.body
+			added++
+		}
+		expr = normal
+		// A head normal form is one under its binders too, while a
+		// weak head normal form needs its body reduced anew. Each
+		// abstraction of a Lévy-Longo tree counts as a level, as Y K
+		// has infinitely many.
+		if !b.weak || added == 0 {
+			break
+		}
+		if depth += added; depth > b.maxDepth {
+			node.Truncated = true
+			return node, nil
+		}
+	}
+
+	var args []expression
+	for {
+		app, ok := expr.(*application)
+		if !ok {
+			break
+		}
+		args = append([]expression{app.right}, args...)
+		expr = app.left
+	}
+	node.Head = expr.(*variable).name
+	for _, arg := range args {
+		child, err := b.build(arg, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// bohmTree unfolds the Böhm tree of an expression to a depth, reducing
+// each subterm to head normal form.
+func (c *connection) bohmTree(request Request) Response {
+	return c.tree(request, false)
+}
+
+// levyLongoTree unfolds the Lévy-Longo tree of an expression to a
+// depth. Subterms are reduced to weak head normal form, one
+// abstraction at a time, so it tells apart unsolvable terms by how
+// many abstractions they reduce to, which the Böhm tree equates.
+func (c *connection) levyLongoTree(request Request) Response {
+	return c.tree(request, true)
+}
+
+func (c *connection) tree(request Request, weak bool) Response {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return errorResponse(request.ID, codeInvalidParams, "Invalid request parameters")
+	}
+	expr, err := c.expressionParam(params, "expression")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	depth, present, err := positiveInt(params, "depth")
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if !present {
+		depth = defaultTreeDepth
+	}
+	if depth > maxTreeDepth {
+		return errorResponse(request.ID, codeInvalidParams, fmt.Sprintf("Invalid depth parameter: at most %d", maxTreeDepth))
+	}
+	timeout, err := c.server.timeoutParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	budget, err := c.server.maxStepsParam(params)
+	if err != nil {
+		return invalidParams(request.ID, err)
+	}
+	if budget == 0 {
+		budget = defaultTreeSteps
+	}
+
+	ctx, cancel := c.evaluationContext(request, timeout)
+	defer cancel()
+
+	b := &treeBuilder{ctx: ctx, weak: weak, maxDepth: depth, budget: budget}
+	tree, err := b.build(withoutSpans(expr), 0)
+	if err != nil {
+		return errorResponse(request.ID, codeTimeout, fmt.Sprintf("unfolding timed out after %s (%d steps)", timeout, b.steps))
+	}
+	return Response{
+		ID: request.ID,
+		Result: struct {
+			Tree  *treeNode `json:"tree"`
+			Nodes int       `json:"nodes"`
+		}{tree, b.nodes},
+		Meta: map[string]interface{}{"steps": b.steps},
+	}
+}
@@ -0,0 +1,106 @@
+package lambda
+
+// Every simply typed term has a normal form, and an untyped term is
+// simply typable exactly when unifying the constraints its applications
+// put on the types of its variables succeeds, free variables included.
+// evaluate can check this first, with the typeCheck parameter, to allow
+// a typable term more steps than others and skip the warnings that
+// guess at divergence.
+
+// typedStepFactor is how many times the server's step limit a simply
+// typed term gets; without one, evaluations have no step limit to
+// raise. Normalization is guaranteed but may take very many steps, so
+// the timeout and the size limit still apply.
+const typedStepFactor = 10
+
+// maxTypeCheckSize bounds the terms checked, which keeps the check
+// quick; larger terms are treated as untyped.
+const maxTypeCheckSize = 100000
+
+// A simpleType is a type variable, when from is nil, or an arrow. A
+// variable bound by unification links to its type.
+type simpleType struct {
+	from, to *simpleType
+	link     *simpleType
+}
+
+func (t *simpleType) resolve() *simpleType {
+	for t.link != nil {
+		t = t.link
+	}
+	return t
+}
+
+func (t *simpleType) occurs(v *simpleType) bool {
+	t = t.resolve()
+	if t == v {
+		return true
+	}
+	return t.from != nil && (t.from.occurs(v) || t.to.occurs(v))
+}
+
+func unify(a, b *simpleType) bool {
+	a, b = a.resolve(), b.resolve()
+	switch {
+	case a == b:
+		return true
+	case a.from == nil:
+		if b.occurs(a) {
+			return false
+		}
+		a.link = b
+		return true
+	case b.from == nil:
+		return unify(b, a)
+	}
+	return unify(a.from, b.from) && unify(a.to, b.to)
+}
+
+// simplyTyped reports whether expr is simply typable, and false for
+// terms too large to check.
+func simplyTyped(expr expression) bool {
+	if termSize(expr) > maxTypeCheckSize {
+		return false
+	}
+	free := map[string]*simpleType{}
+	_, ok := inferType(expr, map[string]*simpleType{}, free)
+	return ok
+}
+
+// inferType infers the type of expr, with the types of the variables
+// bound around it in bound and of free ones in free.
+func inferType(expr expression, bound, free map[string]*simpleType) (*simpleType, bool) {
+	switch e := expr.(type) {
+	case *variable:
+		if t, ok := bound[e.name]; ok {
+			return t, true
+		}
+		if _, ok := free[e.name]; !ok {
+			free[e.name] = &simpleType{}
+		}
+		return free[e.name], true
+	case *abstraction:
+		parameter := &simpleType{}
+		shadowed, wasBound := bound[e.parameter.name]
+		bound[e.parameter.name] = parameter
+		body, ok := inferType(e.body, bound, free)
+		if wasBound {
+			bound[e.parameter.name] = shadowed
+		} else {
+			delete(bound, e.parameter.name)
+		}
+		return &simpleType{from: parameter, to: body}, ok
+	case *application:
+		fn, ok := inferType(e.left, bound, free)
+		if !ok {
+			return nil, false
+		}
+		arg, ok := inferType(e.right, bound, free)
+		if !ok {
+			return nil, false
+		}
+		result := &simpleType{}
+		return result, unify(fn, &simpleType{from: arg, to: result})
+	}
+	return nil, false
+}
@@ -0,0 +1,27 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTypedStepLimit(t *testing.T) {
+	s := NewServer(Options{Workers: 1, MaxSteps: 10})
+	// 3 applied to 3, simply typed, normalizes in 26 steps.
+	const expression = `(\f x.f (f (f x))) (\f x.f (f (f x)))`
+	for _, test := range []struct {
+		params map[string]interface{}
+		ok     bool
+	}{
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"typeCheck": true}, true},
+		{map[string]interface{}{"typeCheck": true, "maxSteps": 50.0}, true},
+		{map[string]interface{}{"typeCheck": true, "maxSteps": 20.0}, false},
+	} {
+		test.params["expression"] = expression
+		response := s.ServeRPC(context.Background(), Request{ID: 1, Method: "evaluate", Params: test.params})
+		if ok := response.Error == nil; ok != test.ok {
+			t.Errorf("%v: got error %v, want success %v", test.params, response.Error, test.ok)
+		}
+	}
+}
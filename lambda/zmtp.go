@@ -0,0 +1,212 @@
+package lambda
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Just enough of ZMTP 3.0, the ZeroMQ wire protocol, with the NULL
+// security mechanism, for a Jupyter kernel to talk to its frontends
+// without a ZeroMQ dependency. Each peer connection is served on its
+// own, so a ROUTER socket replies to a message on the connection it
+// came in on; a PUB socket sends every message to every subscriber,
+// ignoring subscriptions, as Jupyter frontends subscribe to all.
+
+// zmtpGreeting is the greeting of ZMTP 3.0 with the NULL mechanism, as
+// a server.
+var zmtpGreeting = func() []byte {
+	g := make([]byte, 64)
+	g[0], g[9] = 0xff, 0x7f
+	g[10], g[11] = 3, 0
+	copy(g[12:32], "NULL")
+	return g
+}()
+
+const (
+	zmtpMore    = 0x01
+	zmtpLong    = 0x02
+	zmtpCommand = 0x04
+
+	// zmtpMaxFrame bounds the size of a frame read from a peer.
+	zmtpMaxFrame = 64 << 20
+)
+
+type zmtpConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+}
+
+// zmtpHandshake exchanges greetings and READY commands with a peer,
+// announcing socketType.
+func zmtpHandshake(conn net.Conn, socketType string) (*zmtpConn, error) {
+	z := &zmtpConn{conn: conn, reader: bufio.NewReader(conn)}
+	if _, err := conn.Write(zmtpGreeting); err != nil {
+		return nil, err
+	}
+	greeting := make([]byte, 64)
+	if _, err := io.ReadFull(z.reader, greeting); err != nil {
+		return nil, err
+	}
+	if greeting[0] != 0xff || greeting[9] != 0x7f || greeting[10] < 3 {
+		return nil, errors.New("peer does not speak ZMTP 3")
+	}
+	if mechanism := string(bytes.TrimRight(greeting[12:32], "\x00")); mechanism != "NULL" {
+		return nil, fmt.Errorf("unsupported security mechanism %q", mechanism)
+	}
+
+	var ready bytes.Buffer
+	ready.WriteByte(5)
+	ready.WriteString("READY")
+	ready.WriteByte(byte(len("Socket-Type")))
+	ready.WriteString("Socket-Type")
+	binary.Write(&ready, binary.BigEndian, uint32(len(socketType)))
+	ready.WriteString(socketType)
+	if err := z.writeFrame(zmtpCommand, ready.Bytes()); err != nil {
+		return nil, err
+	}
+
+	flags, body, err := z.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	if flags&zmtpCommand == 0 || len(body) < 6 || string(body[1:6]) != "READY" {
+		return nil, errors.New("peer did not send READY")
+	}
+	return z, nil
+}
+
+func (z *zmtpConn) readFrame() (byte, []byte, error) {
+	flags, err := z.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var size uint64
+	if flags&zmtpLong != 0 {
+		if err := binary.Read(z.reader, binary.BigEndian, &size); err != nil {
+			return 0, nil, err
+		}
+	} else {
+		b, err := z.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if size > zmtpMaxFrame {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(z.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+func (z *zmtpConn) writeFrame(flags byte, body []byte) error {
+	var header []byte
+	if len(body) > 255 {
+		header = make([]byte, 9)
+		header[0] = flags | zmtpLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+	if _, err := z.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := z.conn.Write(body)
+	return err
+}
+
+// receive reads the next message, skipping commands such as the
+// SUBSCRIBE of ZMTP 3.1 peers.
+func (z *zmtpConn) receive() ([][]byte, error) {
+	var message [][]byte
+	for {
+		flags, body, err := z.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&zmtpCommand != 0 {
+			continue
+		}
+		message = append(message, body)
+		if flags&zmtpMore == 0 {
+			return message, nil
+		}
+	}
+}
+
+func (z *zmtpConn) send(message [][]byte) error {
+	z.writeMu.Lock()
+	defer z.writeMu.Unlock()
+	for i, frame := range message {
+		var flags byte
+		if i < len(message)-1 {
+			flags = zmtpMore
+		}
+		if err := z.writeFrame(flags, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zmtpListen accepts peers on listener, handing each to serve once the
+// handshake is done.
+func zmtpListen(listener net.Listener, socketType string, serve func(*zmtpConn)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			z, err := zmtpHandshake(conn, socketType)
+			if err != nil {
+				return
+			}
+			serve(z)
+		}()
+	}
+}
+
+// zmtpPublisher is a PUB socket.
+type zmtpPublisher struct {
+	mu          sync.Mutex
+	subscribers map[*zmtpConn]struct{}
+}
+
+func (p *zmtpPublisher) serve(z *zmtpConn) {
+	p.mu.Lock()
+	p.subscribers[z] = struct{}{}
+	p.mu.Unlock()
+
+	// Subscriptions come in as messages; the connection is done when
+	// reading fails.
+	for {
+		if _, err := z.receive(); err != nil {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	delete(p.subscribers, z)
+	p.mu.Unlock()
+}
+
+func (p *zmtpPublisher) publish(message [][]byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for z := range p.subscribers {
+		z.send(message)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows && !js
+
+package main
+
+import "syscall"
+
+// reservedFiles are the file descriptors kept free of connections for
+// the listener, logs and the like.
+const reservedFiles = 64
+
+// defaultConnectionLimit leaves reservedFiles of the open files limit
+// free, so that accepting stops short of failing with EMFILE.
+func defaultConnectionLimit() int {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil || limit.Cur > 1<<20 {
+		return 0
+	}
+	if int(limit.Cur) <= 2*reservedFiles {
+		return int(limit.Cur) / 2
+	}
+	return int(limit.Cur) - reservedFiles
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// notifyReady tells a parent process that the socket is accepting
+// connections: by writing a single byte to readyFD when it is
+// non-negative, and by sending READY=1 to systemd when NOTIFY_SOCKET is
+// set.
+func notifyReady(readyFD int) error {
+	if readyFD >= 0 {
+		f := os.NewFile(uintptr(readyFD), "ready-fd")
+		if f == nil {
+			return fmt.Errorf("invalid -ready-fd %d", readyFD)
+		}
+		_, err := f.Write([]byte{'\n'})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write to -ready-fd: %w", err)
+		}
+	}
+
+	if socket := os.Getenv("NOTIFY_SOCKET"); socket != "" {
+		// As with sd_notify(3), a leading @ names an abstract socket.
+		if strings.HasPrefix(socket, "@") {
+			socket = "\x00" + socket[1:]
+		}
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+		if err != nil {
+			return fmt.Errorf("failed to connect to NOTIFY_SOCKET: %w", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("READY=1")); err != nil {
+			return fmt.Errorf("failed to notify systemd: %w", err)
+		}
+	}
+
+	return nil
+}
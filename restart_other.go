@@ -0,0 +1,21 @@
+//go:build windows || js
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"time"
+)
+
+var restartSignals []os.Signal
+
+func inheritedListener() (net.Listener, error) {
+	return nil, nil
+}
+
+func reexec(listener net.Listener, timeout time.Duration) error {
+	return errors.New("restart is not supported on " + runtime.GOOS)
+}
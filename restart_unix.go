@@ -0,0 +1,108 @@
+//go:build !windows && !js
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// listenFDEnv tells a re-executed server which inherited descriptor is
+// its listening socket.
+const listenFDEnv = "LAMBDA_LISTEN_FD"
+
+var restartSignals = []os.Signal{syscall.SIGUSR2}
+
+// inheritedListener returns the listener passed down by a parent that
+// re-executed itself, if any.
+func inheritedListener() (net.Listener, error) {
+	raw := os.Getenv(listenFDEnv)
+	if raw == "" {
+		return nil, nil
+	}
+	os.Unsetenv(listenFDEnv)
+
+	fd, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", listenFDEnv, err)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use inherited listener: %w", err)
+	}
+	return listener, nil
+}
+
+// reexec starts a new copy of the running binary that takes over
+// listener, and returns once the new process reports it is ready. The
+// caller then shuts down without removing the socket file, which now
+// belongs to the new process.
+func reexec(listener net.Listener, timeout time.Duration) error {
+	filer, ok := listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return errors.New("listener cannot be passed to a new process")
+	}
+	if unix, ok := listener.(*net.UnixListener); ok {
+		// Closing our copy must not unlink the socket from under the
+		// new process.
+		unix.SetUnlinkOnClose(false)
+	}
+
+	listenerFile, err := filer.File()
+	if err != nil {
+		return fmt.Errorf("failed to duplicate listener: %w", err)
+	}
+	defer listenerFile.Close()
+
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ready pipe: %w", err)
+	}
+	defer readyRead.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	// ExtraFiles start at descriptor 3. A trailing -ready-fd overrides
+	// any the parent itself was given.
+	cmd := exec.Command(executable, append(os.Args[1:], "-ready-fd=4")...)
+	cmd.Env = append(os.Environ(), listenFDEnv+"=3")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{listenerFile, readyWrite}
+
+	err = cmd.Start()
+	readyWrite.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	go cmd.Wait()
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyRead.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			return fmt.Errorf("new process exited before becoming ready: %w", err)
+		}
+		return nil
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return errors.New("new process did not become ready in time")
+	}
+}
@@ -0,0 +1,387 @@
+// Package rpc implements the line-delimited JSON protocol spoken by the
+// lambda server, so that its methods can be served on any connection
+// and extended with custom ones.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Request struct {
+	JSONRPC string      `json:"jsonrpc,omitempty"`
+	ID      interface{} `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+
+	// Traceparent correlates the request with the caller's own
+	// distributed trace, in the format of the W3C traceparent header.
+	// Responses and logs echo it.
+	Traceparent string `json:"traceparent,omitempty"`
+
+	// ctx is the context the request is served in; see WithContext.
+	ctx context.Context
+}
+
+// Context returns the context the request is served in, as set with
+// WithContext, or the background context.
+func (r Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a copy of r served in ctx, so that handlers
+// passing the request on need not pass ctx along with it.
+func (r Request) WithContext(ctx context.Context) Request {
+	r.ctx = ctx
+	return r
+}
+
+type Response struct {
+	JSONRPC     string                 `json:"jsonrpc,omitempty"`
+	ID          interface{}            `json:"id"`
+	Result      interface{}            `json:"result"`
+	Error       *Error                 `json:"error,omitempty"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+	Traceparent string                 `json:"traceparent,omitempty"`
+}
+
+// A Notification is a message the server sends unprompted; it has no
+// ID and gets no response. RequestID names the request it is about, if
+// any, and Seq numbers the notifications of a connection from 1, so
+// that clients can put streamed ones in order and notice any missing.
+type Notification struct {
+	JSONRPC   string      `json:"jsonrpc,omitempty"`
+	Method    string      `json:"method"`
+	Params    interface{} `json:"params"`
+	RequestID interface{} `json:"requestId,omitempty"`
+	Seq       uint64      `json:"seq"`
+}
+
+// Error is the error object of a failed response, following the
+// JSON-RPC 2.0 error codes.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+
+	// Data holds details of the error, if any.
+	Data interface{} `json:"data,omitempty"`
+}
+
+const (
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeTimeout        = -32001
+	CodeLimitExceeded  = -32002
+	CodeUnauthorized   = -32003
+)
+
+// ErrorResponse builds the response to a request that failed.
+func ErrorResponse(id interface{}, code int, message string) Response {
+	return Response{
+		ID:    id,
+		Error: &Error{Code: code, Message: message},
+	}
+}
+
+// CheckStrict reports how a raw request departs from JSON-RPC 2.0: a
+// jsonrpc member other than "2.0", a missing method, params that are
+// neither an object nor an array, or any other member but traceparent.
+func CheckStrict(raw []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return errors.New("request is not an object")
+	}
+	for name, value := range members {
+		switch name {
+		case "jsonrpc":
+			var version string
+			if json.Unmarshal(value, &version) != nil || version != "2.0" {
+				return errors.New(`jsonrpc must be "2.0"`)
+			}
+		case "method":
+			var method string
+			if json.Unmarshal(value, &method) != nil {
+				return errors.New("method must be a string")
+			}
+		case "params":
+			if len(value) == 0 || value[0] != '{' && value[0] != '[' {
+				return errors.New("params must be an object or an array")
+			}
+		case "traceparent":
+			var traceparent string
+			if json.Unmarshal(value, &traceparent) != nil {
+				return errors.New("traceparent must be a string")
+			}
+		case "id":
+		default:
+			return fmt.Errorf("unknown member %q", name)
+		}
+	}
+	if _, ok := members["jsonrpc"]; !ok {
+		return errors.New(`missing jsonrpc member; want "2.0"`)
+	}
+	if _, ok := members["method"]; !ok {
+		return errors.New("missing method member")
+	}
+	return nil
+}
+
+// ValidID reports whether id is a string, number or null, the request
+// IDs JSON-RPC 2.0 allows.
+func ValidID(id interface{}) bool {
+	switch id.(type) {
+	case nil, string, float64, json.Number:
+		return true
+	}
+	return false
+}
+
+// An IDSet holds the IDs of the requests of a connection that have not
+// been answered yet, to catch clients reusing one, which would make
+// the responses impossible to tell apart. Null IDs are never tracked.
+type IDSet struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// idKey tells apart IDs of different types, such as 1 and "1".
+func idKey(id interface{}) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
+// Claim adds id to the set, reporting false if it was already there.
+func (s *IDSet) Claim(id interface{}) bool {
+	if id == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids == nil {
+		s.ids = map[string]bool{}
+	}
+	key := idKey(id)
+	if s.ids[key] {
+		return false
+	}
+	s.ids[key] = true
+	return true
+}
+
+// Release removes id from the set once its request is answered.
+func (s *IDSet) Release(id interface{}) {
+	if id == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, idKey(id))
+}
+
+// A Handler answers requests. Under Serve, the context is cancelled
+// once the connection the request arrived on is done with.
+type Handler interface {
+	ServeRPC(ctx context.Context, request Request) Response
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ctx context.Context, request Request) Response
+
+func (f HandlerFunc) ServeRPC(ctx context.Context, request Request) Response {
+	return f(ctx, request)
+}
+
+// Mux dispatches requests to the handler registered for their method.
+type Mux struct {
+	mu      sync.RWMutex
+	methods map[string]Handler
+
+	// NotFound answers methods without a handler. If nil, they fail
+	// with CodeMethodNotFound.
+	NotFound Handler
+}
+
+func NewMux() *Mux {
+	return &Mux{methods: map[string]Handler{}}
+}
+
+// Handle registers the handler for a method. It panics if the method
+// already has one.
+func (m *Mux) Handle(method string, handler Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, taken := m.methods[method]; taken {
+		panic("rpc: multiple registrations for " + method)
+	}
+	m.methods[method] = handler
+}
+
+func (m *Mux) HandleFunc(method string, handler func(ctx context.Context, request Request) Response) {
+	m.Handle(method, HandlerFunc(handler))
+}
+
+// Handler returns the handler registered for a method.
+func (m *Mux) Handler(method string) (Handler, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	handler, ok := m.methods[method]
+	return handler, ok
+}
+
+// Methods returns the methods with a handler, sorted.
+func (m *Mux) Methods() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	methods := make([]string, 0, len(m.methods))
+	for method := range m.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func (m *Mux) ServeRPC(ctx context.Context, request Request) Response {
+	if handler, ok := m.Handler(request.Method); ok {
+		return handler.ServeRPC(ctx, request)
+	}
+	if m.NotFound != nil {
+		return m.NotFound.ServeRPC(ctx, request)
+	}
+	return ErrorResponse(request.ID, CodeMethodNotFound, fmt.Sprintf("unknown method %q", request.Method))
+}
+
+// Serve reads requests from conn until it is closed or ctx is done,
+// answering each on its own goroutine, so responses may come back out
+// of order. Requests with an invalid ID, or the ID of one still being
+// answered, fail with CodeInvalidRequest. Handlers see a context
+// carrying a Session for the connection. Serve closes conn and waits
+// for running handlers before returning.
+func Serve(ctx context.Context, conn io.ReadWriteCloser, handler Handler) error {
+	ctx, cancel := context.WithCancel(WithSession(ctx))
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var (
+		writeMu  sync.Mutex
+		encoder  = json.NewEncoder(conn)
+		inFlight sync.WaitGroup
+		pending  IDSet
+	)
+	defer inFlight.Wait()
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var request Request
+		if err := decoder.Decode(&request); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("decoding request: %w", err)
+		}
+
+		var response Response
+		switch {
+		case !ValidID(request.ID):
+			response = ErrorResponse(nil, CodeInvalidRequest, "Invalid id: must be a string, number or null")
+		case !pending.Claim(request.ID):
+			response = ErrorResponse(request.ID, CodeInvalidRequest, fmt.Sprintf("Duplicate id %v: a request with it is still being answered", request.ID))
+		}
+
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			if response.Error == nil {
+				response = handler.ServeRPC(ctx, request)
+				pending.Release(request.ID)
+			}
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := encoder.Encode(response); err != nil {
+				// The connection is broken or the result cannot be
+				// encoded; either way the client would wait forever.
+				cancel()
+			}
+		}()
+	}
+}
+
+type sessionKey struct{}
+
+// A Session holds the state handlers keep for one connection, such as
+// its history.
+type Session struct {
+	mu     sync.Mutex
+	values map[interface{}]interface{}
+}
+
+// WithSession returns a context carrying a new, empty session.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &Session{values: map[interface{}]interface{}{}})
+}
+
+// SessionFrom returns the session of ctx, or nil if it has none.
+func SessionFrom(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionKey{}).(*Session)
+	return session
+}
+
+// Load returns the value stored under key, storing the result of
+// create first if there is none.
+func (s *Session) Load(key interface{}, create func() interface{}) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		value = create()
+		s.values[key] = value
+	}
+	return value
+}
+
+// Middleware wraps a handler to add behaviour around every request,
+// such as logging, authentication or rate limiting.
+type Middleware func(Handler) Handler
+
+// Chain wraps handler in middleware, the first of which sees requests
+// first.
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Logging logs the method, outcome and duration of every request with
+// logf.
+func Logging(logf func(format string, args ...interface{})) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, request Request) Response {
+			start := time.Now()
+			response := next.ServeRPC(ctx, request)
+			outcome := "ok"
+			if response.Error != nil {
+				outcome = fmt.Sprintf("error %d", response.Error.Code)
+			}
+			if request.Traceparent != "" {
+				logf("%s (id %v, traceparent %s): %s in %s", request.Method, request.ID, request.Traceparent, outcome, time.Since(start))
+			} else {
+				logf("%s (id %v): %s in %s", request.Method, request.ID, outcome, time.Since(start))
+			}
+			return response
+		})
+	}
+}
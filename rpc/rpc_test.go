@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, request Request) Response {
+				order = append(order, name)
+				return next.ServeRPC(ctx, request)
+			})
+		}
+	}
+
+	mux := NewMux()
+	mux.HandleFunc("ping", func(ctx context.Context, request Request) Response {
+		order = append(order, "ping")
+		return Response{ID: request.ID, Result: "pong"}
+	})
+
+	response := Chain(mux, trace("outer"), trace("inner")).ServeRPC(context.Background(), Request{ID: 1, Method: "ping"})
+	if response.Result != "pong" {
+		t.Errorf("got result %v, want pong", response.Result)
+	}
+	if got := len(order); got != 3 || order[0] != "outer" || order[1] != "inner" || order[2] != "ping" {
+		t.Errorf("got order %v, want [outer inner ping]", order)
+	}
+}
+
+func TestMuxUnknownMethod(t *testing.T) {
+	response := NewMux().ServeRPC(context.Background(), Request{ID: 1, Method: "missing"})
+	if response.Error == nil || response.Error.Code != CodeMethodNotFound {
+		t.Errorf("got %+v, want a method-not-found error", response)
+	}
+}
+
+func TestIDSet(t *testing.T) {
+	var ids IDSet
+	if !ids.Claim(1.0) || !ids.Claim("1") {
+		t.Fatal("claiming distinct ids failed")
+	}
+	if ids.Claim(1.0) {
+		t.Error("claimed id 1 twice")
+	}
+	if !ids.Claim(nil) || !ids.Claim(nil) {
+		t.Error("null ids must never count as duplicates")
+	}
+	ids.Release(1.0)
+	if !ids.Claim(1.0) {
+		t.Error("released id 1 cannot be claimed again")
+	}
+}
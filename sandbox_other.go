@@ -0,0 +1,12 @@
+//go:build !linux && !js
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func sandbox(allowConnect bool, writableDir string) error {
+	return fmt.Errorf("sandboxing is not supported on %s", runtime.GOOS)
+}
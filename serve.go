@@ -0,0 +1,271 @@
+//go:build !js
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"example.com/lambda"
+	"example.com/rpc"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	var options lambda.Options
+	socketPath := flag.String("socket", defaultSocketPath, "path of the socket to listen on; on Linux, a leading @ selects the abstract namespace, and tcp:host:port listens on TCP instead")
+	flag.DurationVar(&options.MaxTimeout, "max-timeout", 30*time.Second, "upper bound for a single evaluation; requests may ask for less with timeoutMs")
+	flag.IntVar(&options.MaxSteps, "max-steps", 0, "upper bound for the reduction steps of a single evaluation, or 0 for none; requests may ask for less with maxSteps")
+	flag.IntVar(&options.MaxTermSize, "max-term-size", 0, "upper bound for the number of nodes of a term under evaluation, or 0 for none; requests may ask for less with maxTermSize")
+	flag.IntVar(&options.MaxMessageBytes, "max-message-bytes", 0, "upper bound for the size of a request, or of a message in -dap and -lsp modes, or 0 for 64 MiB")
+	flag.IntVar(&options.Workers, "workers", runtime.NumCPU(), "number of evaluations run concurrently")
+	flag.IntVar(&options.QueueSize, "queue-size", 1024, "number of evaluations that may wait for a worker before reads block")
+	flag.DurationVar(&options.HandleTTL, "handle-ttl", 10*time.Minute, "how long an unused term handle is kept")
+	flag.StringVar(&options.ShutdownToken, "shutdown-token", "", "enable the shutdown method for clients presenting this token")
+	shutdownGrace := flag.Duration("shutdown-grace", 10*time.Second, "how long shutdown waits for running evaluations")
+	flag.BoolVar(&options.ExperimentalOptimal, "experimental-optimal", false, "enable the optimal method, an experimental optimal reduction engine that may give wrong results for some terms")
+	flag.BoolVar(&options.ExperimentalCBPV, "experimental-cbpv", false, "enable the cbpv method, an experimental call-by-push-value calculus")
+	flag.StringVar(&options.TraceDir, "trace-dir", "", "directory evaluate writes traces to, one JSON step per line, when asked with traceFile: true; fetchTrace reads them back a page at a time, and they are never removed by the server")
+	tenantsPath := flag.String("tenants", "", "file of tenants, one `name token` pair per line, that clients authenticate as to keep their handles apart")
+	flag.IntVar(&options.StepQuota, "quota-steps", 0, "reduction steps each tenant may spend within the quota window, or 0 for no limit")
+	flag.DurationVar(&options.TimeQuota, "quota-time", 0, "evaluation time each tenant may spend within the quota window, or 0 for no limit")
+	flag.DurationVar(&options.QuotaWindow, "quota-window", time.Hour, "the rolling window quotas apply to")
+	flag.StringVar(&options.OTLPEndpoint, "otlp-endpoint", "", "OTLP/HTTP traces endpoint of an OpenTelemetry collector to export connection and request spans to, such as http://localhost:4318/v1/traces")
+	flag.BoolVar(&options.Strict, "strict", false, "reject requests that do not follow JSON-RPC 2.0 exactly, such as ones without a jsonrpc member or with unknown members")
+	flag.BoolVar(&options.ReadOnly, "read-only", false, "refuse the admin methods and the ones that change state shared between clients, such as put, for exposing the evaluator publicly")
+	templateEnv := flag.String("template-env", "", "comma-separated environment variables whose values replace ${NAME} placeholders in expressions")
+	logRequests := flag.Bool("log-requests", false, "log the method, outcome and duration of every request")
+	readyFD := flag.Int("ready-fd", -1, "file descriptor to write a byte to, then close, once the socket is listening")
+	dap := flag.Bool("dap", false, "speak the Debug Adapter Protocol on standard input and output instead of listening on a socket")
+	lsp := flag.Bool("lsp", false, "speak the Language Server Protocol for .lam files on standard input and output instead of listening on a socket")
+	jupyter := flag.String("jupyter", "", "run as a Jupyter kernel on the ports of this connection file instead of listening on a socket; see the kernelspec command")
+	container := flag.Bool("container", false, "run as in a container: log JSON to standard output, listen on "+containerSocketPath+" and serve health checks on "+containerHealthAddr+" unless told otherwise")
+	healthAddr := flag.String("health-addr", "", "address to serve HTTP health checks on, at /healthz")
+	sandboxed := flag.Bool("sandbox", false, "once listening, restrict the process on Linux with Landlock to the files and sockets it has open, so that it can no longer open files outside -trace-dir or listen on new ports; restarts then fail, as they execute the binary")
+	maxConnections := flag.Int("max-connections", 0, "number of connections served at once, beyond which new ones wait to be accepted; 0 leaves room below the open files limit")
+	flag.Parse()
+
+	// Every flag may also be set in the environment, as LAMBDA_ and its
+	// name in upper case with underscores, such as LAMBDA_MAX_TIMEOUT.
+	if err := flagsFromEnv(os.LookupEnv); err != nil {
+		log.Fatal(err)
+	}
+	if *container {
+		log.SetFlags(0)
+		log.SetOutput(jsonLog{os.Stdout})
+		if !isSet("socket") {
+			*socketPath = containerSocketPath
+		}
+		if !isSet("health-addr") {
+			*healthAddr = containerHealthAddr
+		}
+	}
+
+	if options.HandleTTL <= 0 {
+		log.Fatal("-handle-ttl must be positive")
+	}
+	if *tenantsPath != "" {
+		tenants, err := loadTenants(*tenantsPath)
+		if err != nil {
+			log.Fatal("Failed to load tenants:", err)
+		}
+		options.Tenants = tenants
+	}
+
+	if *templateEnv != "" {
+		options.TemplateValues = map[string]string{}
+		for _, name := range strings.Split(*templateEnv, ",") {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				log.Fatalf("-template-env: %s is not set", name)
+			}
+			options.TemplateValues[name] = value
+		}
+	}
+
+	s := lambda.NewServer(options)
+	if *logRequests {
+		s.Use(rpc.Logging(log.Printf))
+	}
+
+	if *dap {
+		if err := s.ServeDAP(os.Stdin, os.Stdout); err != nil {
+			log.Fatal("Failed to serve debug adapter:", err)
+		}
+		return
+	}
+	if *lsp {
+		if err := s.ServeLSP(os.Stdin, os.Stdout); err != nil {
+			log.Fatal("Failed to serve language server:", err)
+		}
+		return
+	}
+	if *jupyter != "" {
+		if err := s.ServeJupyter(*jupyter); err != nil {
+			log.Fatal("Failed to serve Jupyter kernel:", err)
+		}
+		return
+	}
+
+	listener, err := inheritedListener()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if listener == nil {
+		listener, err = listenAddress(*socketPath)
+		if err != nil {
+			log.Fatal("Failed to listen on local socket:", err)
+		}
+	}
+
+	if *healthAddr != "" {
+		healthListener, err := net.Listen("tcp", *healthAddr)
+		if err != nil {
+			log.Fatal("Failed to listen for health checks:", err)
+		}
+		go serveHealth(healthListener, s)
+	}
+
+	// Evaluating untrusted input, the server needs nothing but the
+	// sockets and the trace directory from here on.
+	if *sandboxed {
+		if err := sandbox(options.OTLPEndpoint != "", options.TraceDir); err != nil {
+			log.Fatal("Failed to sandbox:", err)
+		}
+	}
+
+	// Termination signals and the shutdown method both stop the accept
+	// loop; running evaluations then get a grace period before the
+	// socket file is cleaned up. A restart (SIGUSR2 or the restart
+	// method) hands the listener to a new process first, which then
+	// keeps the socket file.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	restartChan := make(chan os.Signal, 1)
+	if len(restartSignals) > 0 {
+		signal.Notify(restartChan, restartSignals...)
+	}
+
+	// handedOver is set, before shutdown begins, when a new process
+	// has taken over the listener.
+	var handedOver bool
+	go func() {
+		for {
+			select {
+			case <-sigChan:
+				s.BeginShutdown()
+			case <-restartChan:
+				handedOver = restart(listener, *shutdownGrace)
+			case <-s.RestartRequests():
+				handedOver = restart(listener, *shutdownGrace)
+			case <-s.ShuttingDown():
+			}
+			if handedOver {
+				s.BeginShutdown()
+			}
+			if s.IsShuttingDown() {
+				listener.Close()
+				return
+			}
+		}
+	}()
+
+	log.Println("Server started. Listening on", *socketPath)
+
+	if err := notifyReady(*readyFD); err != nil {
+		log.Println("Failed to send ready notification:", err)
+	}
+
+	acceptConnections(listener, s, *maxConnections)
+
+	log.Println("Shutting down")
+	s.Drain(*shutdownGrace)
+	if !handedOver && !strings.HasPrefix(*socketPath, tcpPrefix) {
+		cleanupSocket(*socketPath)
+	}
+}
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// acceptConnections serves the connections of listener until shutdown
+// begins, at most limit at a time. Accept errors, such as running out
+// of file descriptors, are retried with exponential backoff rather
+// than in a tight loop.
+func acceptConnections(listener net.Listener, s *lambda.Server, limit int) {
+	if limit <= 0 {
+		limit = defaultConnectionLimit()
+	}
+	var slots chan struct{}
+	if limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+
+	backoff := time.Duration(0)
+	for {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-s.ShuttingDown():
+				return
+			}
+		}
+
+		conn, err := listener.Accept()
+		if err != nil {
+			if slots != nil {
+				<-slots
+			}
+			if s.IsShuttingDown() {
+				return
+			}
+			s.AcceptFailed()
+			if backoff == 0 {
+				backoff = minAcceptBackoff
+			} else if backoff *= 2; backoff > maxAcceptBackoff {
+				backoff = maxAcceptBackoff
+			}
+			log.Printf("Failed to accept connection: %v; retrying in %s", err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-s.ShuttingDown():
+				return
+			}
+			continue
+		}
+		backoff = 0
+
+		go func() {
+			s.ServeConn(conn)
+			if slots != nil {
+				<-slots
+			}
+		}()
+	}
+}
+
+// restart hands listener over to a freshly executed copy of the
+// server, reporting whether it did. On failure the current process
+// keeps serving.
+func restart(listener net.Listener, timeout time.Duration) bool {
+	log.Println("Restarting")
+	if err := reexec(listener, timeout); err != nil {
+		log.Println("Failed to restart:", err)
+		return false
+	}
+	return true
+}
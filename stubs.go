@@ -0,0 +1,317 @@
+//go:build !js
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"example.com/lambda"
+)
+
+// stubSpec is the part of the protocol description that stubs are
+// generated from, as the describe method returns it.
+type stubSpec struct {
+	Methods []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Params      []struct {
+			Name     string `json:"name"`
+			Type     string `json:"type"`
+			Required bool   `json:"required"`
+		} `json:"params"`
+	} `json:"methods"`
+}
+
+// stubLanguages generate a client from a protocol description.
+var stubLanguages = map[string]func(w io.Writer, spec stubSpec){
+	"python": pythonStubs,
+	"node":   nodeStubs,
+}
+
+// stubsCommand prints a thin client for another language, generated
+// from the description of the protocol built into the server or, given
+// a file, from a describe result saved from a running server.
+func stubsCommand(args []string) int {
+	flags := flag.NewFlagSet("stubs", flag.ExitOnError)
+	language := flags.String("lang", "python", "language of the client: python or node")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: lambda stubs [-lang python|node] [spec.json]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	generate, ok := stubLanguages[*language]
+	if !ok || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	data := lambda.ProtocolSpec()
+	if flags.NArg() == 1 {
+		var err error
+		if data, err = os.ReadFile(flags.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	var spec stubSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid protocol description:", err)
+		return 1
+	}
+	// hello changes how the rest of the connection is encoded, which
+	// the stubs do not support.
+	methods := spec.Methods[:0]
+	for _, method := range spec.Methods {
+		if method.Name != "hello" {
+			methods = append(methods, method)
+		}
+	}
+	spec.Methods = methods
+
+	generate(os.Stdout, spec)
+	return 0
+}
+
+// snakeCase turns camelCase names into Python's snake_case.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+const pythonHeader = `# Code generated by "lambda stubs -lang python"; DO NOT EDIT.
+"""A client for the lambda server."""
+
+import itertools
+import json
+import socket
+
+
+class Error(Exception):
+    """An error response."""
+
+    def __init__(self, error):
+        super().__init__(error.get("message", ""))
+        self.code = error.get("code")
+        self.data = error.get("data")
+
+
+def _params(params):
+    return {name: value for name, value in params.items() if value is not None}
+
+
+class Client:
+    """Calls the server one request at a time. Notifications received
+    while waiting for a response are appended to notifications."""
+
+    def __init__(self, address):
+        """Connects to address: a socket path, @name for an abstract
+        socket, or tcp:host:port."""
+        if address.startswith("tcp:"):
+            host, _, port = address[len("tcp:"):].rpartition(":")
+            self._socket = socket.create_connection((host or "localhost", int(port)))
+        else:
+            self._socket = socket.socket(socket.AF_UNIX)
+            self._socket.connect("\0" + address[1:] if address.startswith("@") else address)
+        self._file = self._socket.makefile("rwb")
+        self._ids = itertools.count(1)
+        self.notifications = []
+
+    def close(self):
+        self._file.close()
+        self._socket.close()
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        self.close()
+
+    def call(self, method, params=None):
+        """Sends a request and returns its result, raising Error for an
+        error response."""
+        id = next(self._ids)
+        request = {"id": id, "method": method, "params": params or {}}
+        self._file.write(json.dumps(request).encode() + b"\n")
+        self._file.flush()
+        while True:
+            line = self._file.readline()
+            if not line:
+                raise ConnectionError("the server closed the connection")
+            message = json.loads(line)
+            if "id" not in message:
+                self.notifications.append(message)
+                continue
+            if message.get("error"):
+                raise Error(message["error"])
+            return message.get("result")
+`
+
+func pythonStubs(w io.Writer, spec stubSpec) {
+	io.WriteString(w, pythonHeader)
+	for _, method := range spec.Methods {
+		// Required params come first, as positional arguments.
+		params := append(method.Params[:0:0], method.Params...)
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].Required && !params[j].Required
+		})
+		var args, fields []string
+		keywordOnly := false
+		for _, param := range params {
+			arg := snakeCase(param.Name)
+			if !param.Required {
+				if !keywordOnly {
+					args = append(args, "*")
+					keywordOnly = true
+				}
+				arg += "=None"
+			}
+			args = append(args, arg)
+			fields = append(fields, fmt.Sprintf("%q: %s", param.Name, snakeCase(param.Name)))
+		}
+		fmt.Fprintf(w, "\n    def %s(%s):\n", snakeCase(method.Name), strings.Join(append([]string{"self"}, args...), ", "))
+		fmt.Fprintf(w, "        %q\n", method.Description)
+		fmt.Fprintf(w, "        return self.call(%q, _params({%s}))\n", method.Name, strings.Join(fields, ", "))
+	}
+}
+
+const nodeHeader = `// Code generated by "lambda stubs -lang node"; DO NOT EDIT.
+'use strict';
+
+const net = require('net');
+const { EventEmitter } = require('events');
+
+/** An error response. */
+class RPCError extends Error {
+  constructor(error) {
+    super(error.message);
+    this.code = error.code;
+    this.data = error.data;
+  }
+}
+
+/**
+ * A client for the lambda server. Requests may be in flight together;
+ * notifications are emitted as 'notification' events.
+ */
+class Client extends EventEmitter {
+  /**
+   * Connects to address: a socket path or tcp:host:port. Node cannot
+   * connect to abstract sockets.
+   * @returns {Promise<Client>}
+   */
+  static connect(address) {
+    let options = { path: address };
+    if (address.startsWith('tcp:')) {
+      const hostPort = address.slice('tcp:'.length);
+      const colon = hostPort.lastIndexOf(':');
+      options = { host: hostPort.slice(0, colon) || 'localhost', port: Number(hostPort.slice(colon + 1)) };
+    }
+    return new Promise((resolve, reject) => {
+      const socket = net.createConnection(options, () => {
+        socket.off('error', reject);
+        resolve(new Client(socket));
+      });
+      socket.once('error', reject);
+    });
+  }
+
+  constructor(socket) {
+    super();
+    this.socket = socket;
+    this.pending = new Map();
+    this.nextId = 1;
+    let buffered = '';
+    socket.setEncoding('utf8');
+    socket.on('data', (data) => {
+      buffered += data;
+      let newline;
+      while ((newline = buffered.indexOf('\n')) >= 0) {
+        const line = buffered.slice(0, newline);
+        buffered = buffered.slice(newline + 1);
+        if (line.trim() !== '') {
+          this.receive(JSON.parse(line));
+        }
+      }
+    });
+    socket.on('close', () => {
+      for (const { reject } of this.pending.values()) {
+        reject(new Error('the server closed the connection'));
+      }
+      this.pending.clear();
+    });
+  }
+
+  receive(message) {
+    if (!('id' in message)) {
+      this.emit('notification', message);
+      return;
+    }
+    const waiting = this.pending.get(message.id);
+    if (!waiting) {
+      return;
+    }
+    this.pending.delete(message.id);
+    if (message.error) {
+      waiting.reject(new RPCError(message.error));
+    } else {
+      waiting.resolve(message.result);
+    }
+  }
+
+  /** Sends a request and resolves to its result. */
+  call(method, params = {}) {
+    const id = this.nextId++;
+    return new Promise((resolve, reject) => {
+      this.pending.set(id, { resolve, reject });
+      this.socket.write(JSON.stringify({ id, method, params }) + '\n');
+    });
+  }
+
+  close() {
+    this.socket.end();
+  }
+`
+
+func nodeStubs(w io.Writer, spec stubSpec) {
+	io.WriteString(w, nodeHeader)
+	for _, method := range spec.Methods {
+		fmt.Fprintf(w, "\n  /**\n   * %s\n", method.Description)
+		fmt.Fprintf(w, "   * @param {object} [params]\n")
+		for _, param := range method.Params {
+			name := "params." + param.Name
+			if !param.Required {
+				name = "[" + name + "]"
+			}
+			fmt.Fprintf(w, "   * @param {%s} %s\n", nodeType(param.Type), name)
+		}
+		fmt.Fprintf(w, "   */\n  %s(params = {}) {\n    return this.call(%q, params);\n  }\n", method.Name, method.Name)
+	}
+	io.WriteString(w, "}\n\nmodule.exports = { Client, RPCError };\n")
+}
+
+// nodeType is the JSDoc type of a JSON type.
+func nodeType(jsonType string) string {
+	switch jsonType {
+	case "integer":
+		return "number"
+	case "array":
+		return "Array"
+	}
+	return jsonType
+}
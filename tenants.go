@@ -0,0 +1,39 @@
+//go:build !js
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadTenants reads a tenants file: lines of a tenant name and its
+// access token separated by whitespace, with blank lines and lines
+// starting with # ignored. It returns the tenants by token.
+func loadTenants(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tenants := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a tenant name and token", path, line)
+		}
+		if _, taken := tenants[fields[1]]; taken {
+			return nil, fmt.Errorf("%s:%d: token already used by another tenant", path, line)
+		}
+		tenants[fields[1]] = fields[0]
+	}
+	return tenants, scanner.Err()
+}
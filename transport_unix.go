@@ -0,0 +1,68 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const defaultSocketPath = "/var/run/dev-test/sock"
+
+// listen opens the local transport: a UNIX domain socket at socketPath.
+// A path starting with @ names a Linux abstract socket, which has no
+// filesystem entry to create or clean up.
+func listen(socketPath string) (net.Listener, error) {
+	if isAbstract(socketPath) {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("abstract socket %s requires Linux", socketPath)
+		}
+		return net.Listen("unix", socketPath)
+	}
+
+	// Create the UNIX domain socket
+	err := createSocket(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket: %w", err)
+	}
+	return listener, nil
+}
+
+func createSocket(socketPath string) error {
+	err := os.RemoveAll(socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to remove existing socket file: %w", err)
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to create socket: %w", err)
+	}
+	defer l.Close()
+
+	return nil
+}
+
+func cleanupSocket(socketPath string) {
+	if isAbstract(socketPath) {
+		return
+	}
+
+	err := os.RemoveAll(socketPath)
+	if err != nil {
+		log.Println("Failed to remove socket file:", err)
+	}
+}
+
+func isAbstract(socketPath string) bool {
+	return strings.HasPrefix(socketPath, "@")
+}
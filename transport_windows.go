@@ -0,0 +1,254 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const defaultSocketPath = `\\.\pipe\lambda`
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW    = kernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe    = kernel32.NewProc("ConnectNamedPipe")
+	procCreateEventW        = kernel32.NewProc("CreateEventW")
+	procGetOverlappedResult = kernel32.NewProc("GetOverlappedResult")
+)
+
+const (
+	pipeAccessDuplex        = 0x3
+	fileFlagOverlapped      = 0x40000000
+	pipeRejectRemoteClients = 0x8
+	pipeUnlimitedInstances  = 255
+	pipeBufferSize          = 64 * 1024
+	errorInvalidHandle      = syscall.Errno(6)
+	errorBrokenPipe         = syscall.Errno(109)
+	errorPipeConnected      = syscall.Errno(535)
+	errorOperationAborted   = syscall.Errno(995)
+)
+
+// listen opens the local transport: a named pipe such as \\.\pipe\lambda.
+// Each Accept creates a fresh pipe instance and blocks until a client
+// connects to it.
+func listen(socketPath string) (net.Listener, error) {
+	name, err := syscall.UTF16PtrFromString(socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipe name: %w", err)
+	}
+
+	l := &pipeListener{path: socketPath, name: name}
+
+	// Create the first instance up front so that a bad name or a pipe
+	// owned by another server is reported at startup.
+	h, err := l.createInstance()
+	if err != nil {
+		return nil, err
+	}
+	l.next = h
+	return l, nil
+}
+
+// defaultConnectionLimit is 0, for none: Windows has no open files
+// limit to stay below.
+func defaultConnectionLimit() int {
+	return 0
+}
+
+func cleanupSocket(socketPath string) {
+	// Named pipes disappear with their last handle; nothing to remove.
+}
+
+type pipeListener struct {
+	path string
+	name *uint16
+
+	mu     sync.Mutex
+	next   syscall.Handle
+	closed bool
+}
+
+func (l *pipeListener) createInstance() (syscall.Handle, error) {
+	h, _, err := procCreateNamedPipeW.Call(
+		uintptr(unsafe.Pointer(l.name)),
+		pipeAccessDuplex|fileFlagOverlapped,
+		pipeRejectRemoteClients,
+		pipeUnlimitedInstances,
+		pipeBufferSize,
+		pipeBufferSize,
+		0,
+		0,
+	)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return syscall.InvalidHandle, fmt.Errorf("failed to create named pipe: %w", err)
+	}
+	return syscall.Handle(h), nil
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	h := l.next
+	l.next = syscall.InvalidHandle
+	l.mu.Unlock()
+
+	if h == syscall.InvalidHandle {
+		var err error
+		h, err = l.createInstance()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := overlappedIO(h, func(o *syscall.Overlapped) error {
+		ok, _, err := procConnectNamedPipe.Call(uintptr(h), uintptr(unsafe.Pointer(o)))
+		if ok != 0 {
+			return nil
+		}
+		return err
+	})
+	if err != nil && !errors.Is(err, errorPipeConnected) {
+		syscall.CloseHandle(h)
+		return nil, fmt.Errorf("failed to connect named pipe: %w", err)
+	}
+
+	l.mu.Lock()
+	closed := l.closed
+	if !closed {
+		// Have the next instance ready so clients connecting before
+		// the following Accept are not refused with ERROR_PIPE_BUSY.
+		l.next, _ = l.createInstance()
+	}
+	l.mu.Unlock()
+	if closed {
+		syscall.CloseHandle(h)
+		return nil, net.ErrClosed
+	}
+
+	addr := pipeAddr(l.path)
+	return &pipeConn{handle: h, addr: addr}, nil
+}
+
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	if l.next != syscall.InvalidHandle {
+		syscall.CloseHandle(l.next)
+		l.next = syscall.InvalidHandle
+	}
+	l.mu.Unlock()
+
+	// Wake an Accept blocked in ConnectNamedPipe by connecting to it.
+	if f, err := os.OpenFile(l.path, os.O_RDWR, 0); err == nil {
+		f.Close()
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// overlappedIO starts an operation on a handle opened for overlapped
+// I/O and waits for it to complete. Each operation has an event of its
+// own, so that a read pending on a pipe does not hold up writes to it,
+// as it would on a synchronous handle.
+func overlappedIO(h syscall.Handle, start func(*syscall.Overlapped) error) (int, error) {
+	event, _, err := procCreateEventW.Call(0, 1, 0, 0)
+	if event == 0 {
+		return 0, fmt.Errorf("failed to create event: %w", err)
+	}
+	defer syscall.CloseHandle(syscall.Handle(event))
+
+	o := &syscall.Overlapped{HEvent: syscall.Handle(event)}
+	if err := start(o); err != nil && !errors.Is(err, syscall.ERROR_IO_PENDING) {
+		return 0, err
+	}
+	var n uint32
+	ok, _, err := procGetOverlappedResult.Call(uintptr(h), uintptr(unsafe.Pointer(o)), uintptr(unsafe.Pointer(&n)), 1)
+	if ok == 0 {
+		return int(n), err
+	}
+	return int(n), nil
+}
+
+// pipeConn adapts a connected pipe handle to net.Conn. Deadlines are
+// not supported.
+type pipeConn struct {
+	handle    syscall.Handle
+	addr      pipeAddr
+	closeOnce sync.Once
+}
+
+func (c *pipeConn) Read(p []byte) (int, error) {
+	n, err := overlappedIO(c.handle, func(o *syscall.Overlapped) error {
+		var done uint32
+		return syscall.ReadFile(c.handle, p, &done, o)
+	})
+	return n, pipeError(err)
+}
+
+func (c *pipeConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := overlappedIO(c.handle, func(o *syscall.Overlapped) error {
+			var done uint32
+			return syscall.WriteFile(c.handle, p[written:], &done, o)
+		})
+		written += n
+		if err != nil {
+			return written, pipeError(err)
+		}
+	}
+	return written, nil
+}
+
+// pipeError maps the errors of a pipe's operations to those of a
+// net.Conn.
+func pipeError(err error) error {
+	switch {
+	case errors.Is(err, errorBrokenPipe):
+		return io.EOF
+	case errors.Is(err, errorOperationAborted), errors.Is(err, errorInvalidHandle):
+		return net.ErrClosed
+	}
+	return err
+}
+
+// Close cancels the operations pending on the pipe before closing it,
+// so that they return.
+func (c *pipeConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		syscall.CancelIoEx(c.handle, nil)
+		err = syscall.CloseHandle(c.handle)
+	})
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *pipeConn) SetDeadline(t time.Time) error      { return os.ErrNoDeadline }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return os.ErrNoDeadline }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return os.ErrNoDeadline }
@@ -0,0 +1,120 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/lambda"
+)
+
+func TestNamedPipeListener(t *testing.T) {
+	path := fmt.Sprintf(`\\.\pipe\lambda-test-%d`, os.Getpid())
+	l, err := listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Addr().String(); got != path {
+		t.Errorf("Addr: got %s, want %s", got, path)
+	}
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			accepted <- err
+			return
+		}
+		defer conn.Close()
+		_, err = io.Copy(conn, io.LimitReader(conn, 5))
+		accepted <- err
+	}()
+
+	client, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	echoed := make([]byte, 5)
+	if _, err := io.ReadFull(client, echoed); err != nil {
+		t.Fatal(err)
+	}
+	if string(echoed) != "hello" {
+		t.Errorf("got %q, want hello", echoed)
+	}
+	if err := <-accepted; err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	// Close wakes an Accept waiting for a client.
+	go func() {
+		_, err := l.Accept()
+		accepted <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	l.Close()
+	select {
+	case err := <-accepted:
+		if err == nil {
+			t.Error("Accept after Close succeeded, want an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept is still blocked after Close")
+	}
+}
+
+// A pooled evaluation is answered from a worker while the connection
+// waits to read the next request; the reply must not wait for one.
+func TestNamedPipePooledReply(t *testing.T) {
+	path := fmt.Sprintf(`\\.\pipe\lambda-test-pooled-%d`, os.Getpid())
+	l, err := listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := lambda.NewServer(lambda.Options{Workers: 1})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		s.ServeConn(conn)
+	}()
+
+	client, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := io.WriteString(client, `{"id": 1, "method": "evaluate", "params": {"expression": "(\\x.x) a"}}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	replied := make(chan string, 1)
+	go func() {
+		var response struct {
+			Result struct {
+				Expression string `json:"expression"`
+			} `json:"result"`
+		}
+		json.NewDecoder(client).Decode(&response)
+		replied <- response.Result.Expression
+	}()
+	select {
+	case got := <-replied:
+		if got != "a" {
+			t.Errorf("got %q, want a", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no reply to a pooled evaluate until the client writes again")
+	}
+}
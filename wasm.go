@@ -0,0 +1,64 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"syscall/js"
+
+	"example.com/lambda"
+	"example.com/rpc"
+)
+
+// main, in a browser, exposes the engine as a global lambda object
+// instead of serving a socket:
+//
+//	lambda.evaluate({expression: "(\\x.x) y"})
+//	lambda.parse({expression: "\\x.x", warnings: true})
+//
+// Each function takes the params of the method of the same name and
+// returns its response, holding either result or error, as a plain
+// object. Build with
+//
+//	GOOS=js GOARCH=wasm go build -o lambda.wasm .
+//
+// and load it with the wasm_exec.js shipped in the Go distribution.
+func main() {
+	s := lambda.NewServer(lambda.Options{Workers: 1})
+	ctx := rpc.WithSession(context.Background())
+	export := func(method string) js.Func {
+		return exportMethod(func(request rpc.Request) rpc.Response {
+			request.Method = method
+			return s.ServeRPC(ctx, request)
+		})
+	}
+
+	js.Global().Set("lambda", js.ValueOf(map[string]interface{}{
+		"evaluate":   export("evaluate"),
+		"parse":      export("parse"),
+		"lint":       export("lint"),
+		"strategies": export("listStrategies"),
+	}))
+	select {}
+}
+
+// exportMethod wraps a method as a JavaScript function, passing its
+// params and result through JSON.
+func exportMethod(method func(rpc.Request) rpc.Response) js.Func {
+	jsonObject := js.Global().Get("JSON")
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var request rpc.Request
+		if len(args) > 0 {
+			params := jsonObject.Call("stringify", args[0]).String()
+			if err := json.Unmarshal([]byte(params), &request.Params); err != nil {
+				return jsonObject.Call("parse", `{"error":{"code":-32600,"message":"params must be a JSON object"}}`)
+			}
+		}
+		encoded, err := json.Marshal(method(request))
+		if err != nil {
+			return jsonObject.Call("parse", `{"error":{"code":-32603,"message":"result could not be encoded"}}`)
+		}
+		return jsonObject.Call("parse", string(encoded))
+	})
+}